@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/catalogfi/cobi/pkg/cobid"
+	"github.com/catalogfi/cobi/pkg/cobid/executor"
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
+	"github.com/catalogfi/ob/model"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const approvalsUsage = `usage:
+  cobid approvals                              list the token approvals of the swap contracts
+  cobid approvals revoke <chain> <contract>    revoke the approval of the swap contract
+  cobid approvals set <chain> <contract> <amount>
+                                               approve the swap contract to spend the amount`
+
+// Approvals inspects and manages the token approvals of the configured swap contracts.
+func Approvals(key *ecdsa.PrivateKey, evms []cobid.EvmChainConfig, args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		return listApprovals(crypto.PubkeyToAddress(key.PublicKey), evms)
+	}
+
+	switch {
+	case args[0] == "revoke" && len(args) == 3:
+		return setApproval(key, evms, model.Chain(args[1]), args[2], big.NewInt(0))
+	case args[0] == "set" && len(args) == 4:
+		amount, ok := new(big.Int).SetString(args[3], 10)
+		if !ok || amount.Sign() < 0 {
+			return fmt.Errorf("invalid amount = %v", args[3])
+		}
+		return setApproval(key, evms, model.Chain(args[1]), args[2], amount)
+	default:
+		return fmt.Errorf("%v", approvalsUsage)
+	}
+}
+
+func listApprovals(owner common.Address, evms []cobid.EvmChainConfig) error {
+	fmt.Printf("owner = %v\n", owner.Hex())
+	for _, evm := range evms {
+		swapAddr := common.HexToAddress(evm.SwapAddress)
+		if evm.Native {
+			fmt.Printf("%v %v native, no approval needed\n", evm.Chain, swapAddr.Hex())
+			continue
+		}
+
+		client, err := ethswap.DialMulti(evm.URLs, ethswap.DefaultMultiClientOptions)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		token, allowance, err := ethswap.TokenAllowance(ctx, client, swapAddr, owner)
+		cancel()
+		client.Close()
+		if err != nil {
+			return fmt.Errorf("%v %v, %v", evm.Chain, swapAddr.Hex(), err)
+		}
+		amount := allowance.String()
+		if allowance.Cmp(math.MaxBig256) == 0 {
+			amount = "unlimited"
+		}
+		fmt.Printf("%v %v token = %v, allowance = %v\n", evm.Chain, swapAddr.Hex(), token.Hex(), amount)
+	}
+	return nil
+}
+
+func setApproval(key *ecdsa.PrivateKey, evms []cobid.EvmChainConfig, chain model.Chain, contract string, amount *big.Int) error {
+	if !common.IsHexAddress(contract) {
+		return fmt.Errorf("invalid contract address = %v", contract)
+	}
+	swapAddr := common.HexToAddress(contract)
+
+	for _, evm := range evms {
+		if evm.Chain != chain || common.HexToAddress(evm.SwapAddress) != swapAddr {
+			continue
+		}
+		if evm.Native {
+			return fmt.Errorf("native swap contract doesn't need approvals")
+		}
+		chainID, err := evm.GetChainID()
+		if err != nil {
+			return err
+		}
+		client, err := ethswap.DialMulti(evm.URLs, ethswap.DefaultMultiClientOptions)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		// Share the nonces with cobid if we have access to its storage
+		options := ethswap.NewOptions(chainID, swapAddr)
+		if redisURL := os.Getenv("REDISCLOUD_URL"); redisURL != "" {
+			store, err := executor.NewRedisStore(redisURL)
+			if err != nil {
+				return err
+			}
+			options = options.WithNonceStore(store)
+		}
+		wallet, err := ethswap.NewWallet(options, key, client)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		tx, err := wallet.Approve(ctx, amount)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("approval tx = %v\n", tx.Hash().Hex())
+		receipt, err := bind.WaitMined(ctx, client, tx)
+		if err != nil {
+			return err
+		}
+		if receipt.Status == 0 {
+			return fmt.Errorf("tx reverted, hash = %v", receipt.TxHash.Hex())
+		}
+		fmt.Printf("allowance of %v on %v set to %v\n", swapAddr.Hex(), chain, amount)
+		return nil
+	}
+	return fmt.Errorf("swap contract %v on %v is not configured", swapAddr.Hex(), chain)
+}
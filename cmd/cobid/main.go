@@ -2,12 +2,15 @@ package main
 
 import (
 	"encoding/hex"
+	_ "expvar"
 	"fmt"
 	"log"
 	"math/big"
+	"net/http"
 	"os"
 	"os/signal"
 	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -17,7 +20,9 @@ import (
 	"github.com/bwmarrin/discordgo"
 	"github.com/catalogfi/blockchain/btc"
 	"github.com/catalogfi/cobi/pkg/cobid"
+	"github.com/catalogfi/cobi/pkg/cobid/executor"
 	"github.com/catalogfi/cobi/pkg/cobid/filler"
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
 	"github.com/catalogfi/cobi/pkg/util"
 	"github.com/catalogfi/ob/model"
 	"github.com/ethereum/go-ethereum/common"
@@ -88,6 +93,26 @@ func main() {
 		panic(err)
 	}
 
+	// Manage the token approvals instead of running cobid
+	if len(os.Args) > 1 && os.Args[1] == "approvals" {
+		if err := Approvals(key, evmConfigs, os.Args[2:]); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	// Manage the maker reputation instead of running cobid
+	makerPolicy, err := ParseMakerPolicy()
+	if err != nil {
+		panic(err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "makers" {
+		if err := Makers(makerPolicy, os.Args[2:]); err != nil {
+			panic(err)
+		}
+		return
+	}
+
 	// Get addresses for filler strategy
 	ethAddr := crypto.PubkeyToAddress(key.PublicKey)
 	keyBytesHash := btcutil.Hash160(util.EcdsaToBtcec(key).PubKey().SerializeCompressed())
@@ -107,6 +132,30 @@ func main() {
 		panic(fmt.Sprintf("unknown network = %v", btcConfig.Chain.Params().Name))
 	}
 
+	skew, err := ParseSkew()
+	if err != nil {
+		panic(err)
+	}
+	for i := range strategies {
+		strategies[i].Skew = skew
+	}
+	if err := ParseRates(strategies); err != nil {
+		panic(err)
+	}
+	exposure, err := ParseExposureLimits(strategies)
+	if err != nil {
+		panic(err)
+	}
+
+	// Serve the metrics at /debug/vars
+	if addr := os.Getenv("METRICS_ADDR"); addr != "" {
+		go func() {
+			if err := http.ListenAndServe(addr, nil); err != nil {
+				logger.Error("metrics server", zap.Error(err))
+			}
+		}()
+	}
+
 	// Init and start cobid
 	config := cobid.Config{
 		Key:              parseRequiredEnv("PRIVATE_KEY"),
@@ -115,6 +164,12 @@ func main() {
 		Btc:              btcConfig,
 		Evms:             evmConfigs,
 		FillerStrategies: strategies,
+		Makers:           makerPolicy,
+		Exposure:         exposure,
+	}
+	config.NativePrices, err = ParseNativePrices(evmConfigs)
+	if err != nil {
+		panic(err)
 	}
 	estimator := InitFeeEstimator(btcConfig.Chain.Params())
 	cobi, err := cobid.NewCobi(config, logger, estimator)
@@ -221,6 +276,9 @@ func ParseChainConfig() (cobid.BtcChainConfig, []cobid.EvmChainConfig, error) {
 	if network == "mainnet" {
 		btcConfig.Chain = model.Bitcoin
 	}
+	if err := parseBitcoinPolicies(&btcConfig); err != nil {
+		return cobid.BtcChainConfig{}, nil, err
+	}
 
 	// Parse evms config
 	evms := parseRequiredEnv("EVMS")
@@ -234,16 +292,476 @@ func ParseChainConfig() (cobid.BtcChainConfig, []cobid.EvmChainConfig, error) {
 			return cobid.BtcChainConfig{}, nil, fmt.Errorf("invalid evm chain = %v", chain)
 		}
 
+		prefix := strings.ToUpper(string(chain))
 		config := cobid.EvmChainConfig{
-			Chain:       chain,
-			SwapAddress: parseRequiredEnv(strings.ToUpper(string(chain)) + "_SWAP_CONTRACT"),
-			URL:         parseRequiredEnv(strings.ToUpper(string(chain)) + "_URL"),
+			Chain: chain,
+		}
+
+		// Multiple rpc urls of the same chain are separated by comma
+		for _, url := range strings.Split(parseRequiredEnv(prefix+"_URL"), ",") {
+			config.URLs = append(config.URLs, strings.TrimSpace(url))
+		}
+
+		// Chain ID is required for the chains which are not known by ethswap
+		if chainID := os.Getenv(prefix + "_CHAIN_ID"); chainID != "" {
+			id, ok := new(big.Int).SetString(chainID, 10)
+			if !ok {
+				return cobid.BtcChainConfig{}, nil, fmt.Errorf("invalid chain ID of %v = %v", chain, chainID)
+			}
+			config.ChainID = id
+		}
+		if blockTime := os.Getenv(prefix + "_BLOCK_TIME"); blockTime != "" {
+			config.BlockTime, err = time.ParseDuration(blockTime)
+			if err != nil {
+				return cobid.BtcChainConfig{}, nil, fmt.Errorf("invalid block time of %v, %v", chain, err)
+			}
+		}
+		if confirmations := os.Getenv(prefix + "_CONFIRMATIONS"); confirmations != "" {
+			config.Confirmations, err = strconv.ParseUint(confirmations, 10, 64)
+			if err != nil {
+				return cobid.BtcChainConfig{}, nil, fmt.Errorf("invalid confirmations of %v, %v", chain, err)
+			}
+		}
+		config.WSURL = os.Getenv(prefix + "_WS_URL")
+		config.Rollup = ethswap.Rollup(os.Getenv(prefix + "_ROLLUP"))
+		config.Height = ethswap.Height(os.Getenv(prefix + "_HEIGHT"))
+		if mode := os.Getenv(prefix + "_APPROVAL_MODE"); mode != "" {
+			approval := ethswap.ApprovalPolicy{
+				Mode:      ethswap.ApprovalMode(mode),
+				OnStartup: os.Getenv(prefix+"_APPROVE_ON_STARTUP") == "true",
+			}
+			if volume := os.Getenv(prefix + "_APPROVAL_VOLUME"); volume != "" {
+				v, ok := new(big.Int).SetString(volume, 10)
+				if !ok {
+					return cobid.BtcChainConfig{}, nil, fmt.Errorf("invalid approval volume of %v = %v", chain, volume)
+				}
+				approval.Volume = v
+			}
+			if multiple := os.Getenv(prefix + "_APPROVAL_MULTIPLE"); multiple != "" {
+				approval.Multiple, err = strconv.ParseInt(multiple, 10, 64)
+				if err != nil {
+					return cobid.BtcChainConfig{}, nil, fmt.Errorf("invalid approval multiple of %v, %v", chain, err)
+				}
+			}
+			config.Approval = &approval
+		}
+		if multicall := os.Getenv(prefix + "_MULTICALL"); multicall != "" {
+			if !common.IsHexAddress(multicall) {
+				return cobid.BtcChainConfig{}, nil, fmt.Errorf("invalid multicall address of %v = %v", chain, multicall)
+			}
+			config.Multicall = multicall
+		}
+		if window := os.Getenv(prefix + "_BATCH_WINDOW"); window != "" {
+			if config.Multicall == "" {
+				return cobid.BtcChainConfig{}, nil, fmt.Errorf("batch window of %v requires a multicall address", chain)
+			}
+			config.BatchWindow, err = time.ParseDuration(window)
+			if err != nil {
+				return cobid.BtcChainConfig{}, nil, fmt.Errorf("invalid batch window of %v, %v", chain, err)
+			}
+		}
+		config.Native = os.Getenv(prefix+"_NATIVE") == "true"
+		if reserve := os.Getenv(prefix + "_GAS_RESERVE"); reserve != "" && config.Native {
+			r, ok := new(big.Int).SetString(reserve, 10)
+			if !ok || r.Sign() < 0 {
+				return cobid.BtcChainConfig{}, nil, fmt.Errorf("invalid gas reserve of %v = %v", chain, reserve)
+			}
+			config.GasReserve = r
+		}
+		config.Fees, err = parseFeePolicy(prefix, chain)
+		if err != nil {
+			return cobid.BtcChainConfig{}, nil, err
+		}
+		if indexFrom := os.Getenv(prefix + "_INDEX_FROM"); indexFrom != "" {
+			config.IndexFrom, err = strconv.ParseUint(indexFrom, 10, 64)
+			if err != nil {
+				return cobid.BtcChainConfig{}, nil, fmt.Errorf("invalid index start block of %v, %v", chain, err)
+			}
+		}
+
+		// Multiple swap contracts on the same chain are separated by comma
+		for _, swapAddr := range strings.Split(parseRequiredEnv(prefix+"_SWAP_CONTRACT"), ",") {
+			config.SwapAddress = strings.TrimSpace(swapAddr)
+			chains = append(chains, config)
 		}
-		chains = append(chains, config)
 	}
 	return btcConfig, chains, nil
 }
 
+// parseFeePolicy parses the fee policy of an evm chain from <CHAIN>_FEE_PERCENTILE, <CHAIN>_FEE_HISTORY_BLOCKS,
+// <CHAIN>_BASE_FEE_MULTIPLIER, <CHAIN>_PRIORITY_FEE, <CHAIN>_MAX_FEE_CAP, <CHAIN>_FEE_REPLACE_AFTER and
+// <CHAIN>_FEE_BUMP_PERCENTAGE. The ones not set keep the value of ethswap.DefaultFeePolicy, and it returns nil if none
+// is set.
+func parseFeePolicy(prefix string, chain model.Chain) (*ethswap.FeePolicy, error) {
+	fees := ethswap.DefaultFeePolicy
+	set := false
+	var err error
+	if percentile := os.Getenv(prefix + "_FEE_PERCENTILE"); percentile != "" {
+		fees.Percentile, err = strconv.ParseFloat(percentile, 64)
+		if err != nil || fees.Percentile < 0 || fees.Percentile > 100 {
+			return nil, fmt.Errorf("invalid fee percentile of %v = %v", chain, percentile)
+		}
+		set = true
+	}
+	if blocks := os.Getenv(prefix + "_FEE_HISTORY_BLOCKS"); blocks != "" {
+		fees.HistoryBlocks, err = strconv.ParseUint(blocks, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fee history blocks of %v, %v", chain, err)
+		}
+		set = true
+	}
+	if multiplier := os.Getenv(prefix + "_BASE_FEE_MULTIPLIER"); multiplier != "" {
+		fees.BaseFeeMultiplier, err = strconv.ParseFloat(multiplier, 64)
+		if err != nil || fees.BaseFeeMultiplier < 1 {
+			return nil, fmt.Errorf("invalid base fee multiplier of %v = %v", chain, multiplier)
+		}
+		set = true
+	}
+	if priorityFee := os.Getenv(prefix + "_PRIORITY_FEE"); priorityFee != "" {
+		fee, ok := new(big.Int).SetString(priorityFee, 10)
+		if !ok || fee.Sign() < 0 {
+			return nil, fmt.Errorf("invalid priority fee of %v = %v", chain, priorityFee)
+		}
+		fees.PriorityFee = fee
+		set = true
+	}
+	if maxFeeCap := os.Getenv(prefix + "_MAX_FEE_CAP"); maxFeeCap != "" {
+		feeCap, ok := new(big.Int).SetString(maxFeeCap, 10)
+		if !ok || feeCap.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid max fee cap of %v = %v", chain, maxFeeCap)
+		}
+		fees.MaxFeeCap = feeCap
+		set = true
+	}
+	if replaceAfter := os.Getenv(prefix + "_FEE_REPLACE_AFTER"); replaceAfter != "" {
+		fees.ReplaceAfter, err = time.ParseDuration(replaceAfter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fee replacement delay of %v, %v", chain, err)
+		}
+		set = true
+	}
+	if bump := os.Getenv(prefix + "_FEE_BUMP_PERCENTAGE"); bump != "" {
+		fees.BumpPercentage, err = strconv.ParseInt(bump, 10, 64)
+		if err != nil || fees.BumpPercentage < 10 {
+			return nil, fmt.Errorf("invalid fee bump percentage of %v = %v", chain, bump)
+		}
+		set = true
+	}
+	if !set {
+		return nil, nil
+	}
+	return &fees, nil
+}
+
+// parseBitcoinPolicies parses the optional policies of the bitcoin executor and wallet. The deferral policy is read
+// from BITCOIN_DEFER_MAX_COST_RATIO, BITCOIN_DEFER_MIN_BATCH_SIZE, BITCOIN_DEFER_DEADLINE_BLOCKS and
+// BITCOIN_DEFER_MAX_REFUND_DELAY, the batch limits from BITCOIN_BATCH_MAX_INPUTS, BITCOIN_BATCH_MAX_OUTPUTS and
+// BITCOIN_BATCH_MAX_VSIZE, and the sweep policy from BITCOIN_SWEEP_ADDRESS, BITCOIN_SWEEP_XPUB,
+// BITCOIN_SWEEP_TARGET_BALANCE and BITCOIN_SWEEP_MIN_AMOUNT.
+func parseBitcoinPolicies(config *cobid.BtcChainConfig) error {
+	if ratio := os.Getenv("BITCOIN_DEFER_MAX_COST_RATIO"); ratio != "" {
+		deferral := &executor.DeferralPolicy{}
+		var err error
+		deferral.MaxCostRatio, err = strconv.ParseFloat(ratio, 64)
+		if err != nil || deferral.MaxCostRatio <= 0 {
+			return fmt.Errorf("invalid deferral max cost ratio = %v", ratio)
+		}
+		if size := os.Getenv("BITCOIN_DEFER_MIN_BATCH_SIZE"); size != "" {
+			deferral.MinBatchSize, err = strconv.Atoi(size)
+			if err != nil || deferral.MinBatchSize < 0 {
+				return fmt.Errorf("invalid deferral min batch size = %v", size)
+			}
+		}
+		if blocks := os.Getenv("BITCOIN_DEFER_DEADLINE_BLOCKS"); blocks != "" {
+			deferral.DeadlineBlocks, err = strconv.ParseUint(blocks, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid deferral deadline blocks, %v", err)
+			}
+		}
+		if delay := os.Getenv("BITCOIN_DEFER_MAX_REFUND_DELAY"); delay != "" {
+			deferral.MaxRefundDelay, err = strconv.ParseUint(delay, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid deferral max refund delay, %v", err)
+			}
+		}
+		config.Deferral = deferral
+	}
+
+	limits := []struct {
+		name  string
+		value *int
+	}{
+		{"BITCOIN_BATCH_MAX_INPUTS", &config.Limits.MaxInputs},
+		{"BITCOIN_BATCH_MAX_OUTPUTS", &config.Limits.MaxOutputs},
+		{"BITCOIN_BATCH_MAX_VSIZE", &config.Limits.MaxVirtualSize},
+	}
+	for _, limit := range limits {
+		value := os.Getenv(limit.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("invalid %v = %v", limit.name, value)
+		}
+		*limit.value = parsed
+	}
+
+	config.Sweep.Address = os.Getenv("BITCOIN_SWEEP_ADDRESS")
+	config.Sweep.XPub = os.Getenv("BITCOIN_SWEEP_XPUB")
+	if config.Sweep.Address != "" {
+		if _, err := btcutil.DecodeAddress(config.Sweep.Address, config.Chain.Params()); err != nil {
+			return fmt.Errorf("invalid sweep address = %v, %v", config.Sweep.Address, err)
+		}
+	}
+	amounts := []struct {
+		name  string
+		value *int64
+	}{
+		{"BITCOIN_SWEEP_TARGET_BALANCE", &config.Sweep.TargetBalance},
+		{"BITCOIN_SWEEP_MIN_AMOUNT", &config.Sweep.MinAmount},
+	}
+	for _, amount := range amounts {
+		value := os.Getenv(amount.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("invalid %v = %v", amount.name, value)
+		}
+		*amount.value = parsed
+	}
+	return nil
+}
+
+// ParseNativePrices parses the value of the native token of each evm chain in the unit of the asset of each swap
+// contract from <CHAIN>_NATIVE_PRICE, separated by comma in the order of <CHAIN>_SWAP_CONTRACT. A single price applies
+// to all the swap contracts of the chain. Cost-aware filling is disabled if no chain has a price, and all the chains
+// must have a price otherwise.
+func ParseNativePrices(evms []cobid.EvmChainConfig) (map[string]float64, error) {
+	contracts := map[model.Chain][]cobid.EvmChainConfig{}
+	chains := []model.Chain{}
+	for _, evm := range evms {
+		if _, ok := contracts[evm.Chain]; !ok {
+			chains = append(chains, evm.Chain)
+		}
+		contracts[evm.Chain] = append(contracts[evm.Chain], evm)
+	}
+
+	prices := map[string]float64{}
+	missing := []model.Chain{}
+	for _, chain := range chains {
+		name := strings.ToUpper(string(chain)) + "_NATIVE_PRICE"
+		value := os.Getenv(name)
+		if value == "" {
+			missing = append(missing, chain)
+			continue
+		}
+		values := strings.Split(value, ",")
+		if len(values) != 1 && len(values) != len(contracts[chain]) {
+			return nil, fmt.Errorf("%v has %v prices for %v swap contracts", name, len(values), len(contracts[chain]))
+		}
+		for i, evm := range contracts[chain] {
+			price := strings.TrimSpace(values[0])
+			if len(values) > 1 {
+				price = strings.TrimSpace(values[i])
+			}
+			parsed, err := strconv.ParseFloat(price, 64)
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("invalid native price of %v = %v", chain, price)
+			}
+			prices[filler.AssetKey(chain, model.Asset(evm.SwapAddress))] = parsed
+		}
+	}
+	if len(prices) == 0 {
+		return nil, nil
+	}
+	if len(missing) != 0 {
+		return nil, fmt.Errorf("native price of %v is not configured", missing)
+	}
+	return prices, nil
+}
+
+// ParseSkew parses the inventory skew pricing of the filler strategies from SKEW_MAX_FEE, SKEW_TARGET and SKEW_CURVE.
+// Skew pricing is disabled if SKEW_MAX_FEE is not set.
+func ParseSkew() (*filler.Skew, error) {
+	maxFee := os.Getenv("SKEW_MAX_FEE")
+	if maxFee == "" {
+		return nil, nil
+	}
+	skew := &filler.Skew{
+		Curve: filler.SkewCurve(os.Getenv("SKEW_CURVE")),
+	}
+	var err error
+	if skew.Max, err = strconv.Atoi(maxFee); err != nil || skew.Max < 0 {
+		return nil, fmt.Errorf("invalid skew max fee = %v", maxFee)
+	}
+	if target := os.Getenv("SKEW_TARGET"); target != "" {
+		skew.Target, err = strconv.ParseFloat(target, 64)
+		if err != nil || skew.Target <= 0 || skew.Target >= 1 {
+			return nil, fmt.Errorf("invalid skew target = %v", target)
+		}
+	}
+	switch skew.Curve {
+	case "", filler.SkewLinear, filler.SkewQuadratic, filler.SkewSqrt:
+	default:
+		return nil, fmt.Errorf("unknown skew curve = %v", skew.Curve)
+	}
+	return skew, nil
+}
+
+// ParseOracle parses the price oracle from its sources, ORACLE_PRICES for manually set prices like ETH/BTC=0.05
+// separated by comma, ORACLE_FILE for a JSON file of prices and ORACLE_URL for price APIs separated by comma, and its
+// checks from ORACLE_MAX_AGE and ORACLE_MAX_DEVIATION. It returns nil if no source is set.
+func ParseOracle() (*filler.Oracle, error) {
+	sources := []filler.PriceSource{}
+	if value := os.Getenv("ORACLE_PRICES"); value != "" {
+		prices := map[string]float64{}
+		for _, entry := range strings.Split(value, ",") {
+			pair, price, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			parsed, err := strconv.ParseFloat(price, 64)
+			if !ok || !strings.Contains(pair, "/") || err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("invalid oracle price = %v", entry)
+			}
+			prices[pair] = parsed
+		}
+		sources = append(sources, filler.NewStaticSource(prices))
+	}
+	if path := os.Getenv("ORACLE_FILE"); path != "" {
+		sources = append(sources, filler.NewFileSource(path))
+	}
+	if value := os.Getenv("ORACLE_URL"); value != "" {
+		for _, url := range strings.Split(value, ",") {
+			sources = append(sources, filler.NewHTTPSource(strings.TrimSpace(url)))
+		}
+	}
+	if len(sources) == 0 {
+		return nil, nil
+	}
+
+	opts := filler.DefaultOracleOptions
+	if value := os.Getenv("ORACLE_MAX_AGE"); value != "" {
+		maxAge, err := time.ParseDuration(value)
+		if err != nil || maxAge < 0 {
+			return nil, fmt.Errorf("invalid ORACLE_MAX_AGE = %v", value)
+		}
+		opts.MaxAge = maxAge
+	}
+	if value := os.Getenv("ORACLE_MAX_DEVIATION"); value != "" {
+		maxDeviation, err := strconv.ParseFloat(value, 64)
+		if err != nil || maxDeviation < 0 {
+			return nil, fmt.Errorf("invalid ORACLE_MAX_DEVIATION = %v", value)
+		}
+		opts.MaxDeviation = maxDeviation
+	}
+	return filler.NewOracle(opts, sources...), nil
+}
+
+// ParseRates sets the oracle rate of the strategies whose assets are not pegged. The symbols and decimals of a pair are
+// parsed from ORACLE_PAIR_<RECEIVE_CHAIN>_<SEND_CHAIN> as <symbol>:<decimals>/<symbol>:<decimals>, the asset we receive
+// first, like ETH:18/BTC:8. The pairs without it are pegged 1:1.
+func ParseRates(strategies filler.Strategies) error {
+	oracle, err := ParseOracle()
+	if err != nil {
+		return err
+	}
+	for i, strategy := range strategies {
+		receiveChain, sendChain, _, _, err := model.ParseOrderPair(strategy.OrderPair)
+		if err != nil {
+			return err
+		}
+		name := "ORACLE_PAIR_" + strings.ToUpper(string(receiveChain)) + "_" + strings.ToUpper(string(sendChain))
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		if oracle == nil {
+			return fmt.Errorf("%v is set without any oracle source", name)
+		}
+		receive, send, ok := strings.Cut(value, "/")
+		if !ok {
+			return fmt.Errorf("invalid %v = %v", name, value)
+		}
+		rate := &filler.Rate{Oracle: oracle}
+		if rate.Receive, rate.ReceiveDecimals, err = parseSymbol(receive); err != nil {
+			return fmt.Errorf("invalid %v = %v, %v", name, value, err)
+		}
+		if rate.Send, rate.SendDecimals, err = parseSymbol(send); err != nil {
+			return fmt.Errorf("invalid %v = %v, %v", name, value, err)
+		}
+		strategies[i].Rate = rate
+	}
+	return nil
+}
+
+// parseSymbol parses the symbol and decimals of an asset from <symbol>:<decimals>.
+func parseSymbol(value string) (string, int, error) {
+	symbol, decimals, ok := strings.Cut(strings.TrimSpace(value), ":")
+	if !ok || symbol == "" {
+		return "", 0, fmt.Errorf("missing the symbol or decimals of %v", value)
+	}
+	parsed, err := strconv.Atoi(decimals)
+	if err != nil || parsed < 0 {
+		return "", 0, fmt.Errorf("invalid decimals = %v", decimals)
+	}
+	return symbol, parsed, nil
+}
+
+// ParseExposureLimits parses the exposure limits of the assets we send in the strategies from
+// EXPOSURE_<CHAIN>_OUTSTANDING, EXPOSURE_<CHAIN>_PER_MAKER and EXPOSURE_<CHAIN>_PER_WINDOW, in the unit of the order
+// amount, the length of the rolling window from EXPOSURE_WINDOW and how long an order is held for room within the limits
+// from EXPOSURE_HOLD. Exposure limits are disabled if none of the limits is set.
+func ParseExposureLimits(strategies filler.Strategies) (*filler.ExposureLimits, error) {
+	limits := &filler.ExposureLimits{
+		Assets: map[string]filler.ExposureLimit{},
+	}
+	for _, strategy := range strategies {
+		_, chain, _, asset, err := model.ParseOrderPair(strategy.OrderPair)
+		if err != nil {
+			return nil, err
+		}
+		prefix := "EXPOSURE_" + strings.ToUpper(string(chain))
+		limit := filler.ExposureLimit{}
+		fields := map[string]**big.Int{
+			prefix + "_OUTSTANDING": &limit.Outstanding,
+			prefix + "_PER_MAKER":   &limit.PerMaker,
+			prefix + "_PER_WINDOW":  &limit.PerWindow,
+		}
+		set := false
+		for name, field := range fields {
+			if value := os.Getenv(name); value != "" {
+				amount, ok := new(big.Int).SetString(value, 10)
+				if !ok || amount.Sign() <= 0 {
+					return nil, fmt.Errorf("invalid %v = %v", name, value)
+				}
+				*field, set = amount, true
+			}
+		}
+		if set {
+			limits.Assets[filler.AssetKey(chain, asset)] = limit
+		}
+	}
+	if value := os.Getenv("EXPOSURE_WINDOW"); value != "" {
+		window, err := time.ParseDuration(value)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("invalid EXPOSURE_WINDOW = %v", value)
+		}
+		limits.Window = window
+	}
+	if value := os.Getenv("EXPOSURE_HOLD"); value != "" {
+		hold, err := time.ParseDuration(value)
+		if err != nil || hold <= 0 {
+			return nil, fmt.Errorf("invalid EXPOSURE_HOLD = %v", value)
+		}
+		limits.Hold = hold
+	}
+	if len(limits.Assets) == 0 {
+		return nil, nil
+	}
+	return limits, nil
+}
+
 func InitFeeEstimator(params *chaincfg.Params) btc.FeeEstimator {
 	switch params.Name {
 	case chaincfg.MainNetParams.Name:
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/catalogfi/cobi/pkg/cobid/filler"
+)
+
+const makersUsage = `usage:
+  cobid makers                       list the makers on the allow and deny lists
+  cobid makers show <maker>          show the reputation of the maker
+  cobid makers allow <maker>         always fill the orders of the maker
+  cobid makers deny <maker>          never fill the orders of the maker
+  cobid makers clear <maker>         judge the maker by its reputation again`
+
+// Makers inspects the reputation of the makers and manages the manual maker lists, changes are picked up by the running
+// cobid on the next order of the maker.
+func Makers(policy *filler.MakerPolicy, args []string) error {
+	store, err := filler.NewRedisStore(parseRequiredEnv("REDISCLOUD_URL"))
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		policy = &filler.MakerPolicy{}
+	}
+	makers := filler.NewMakers(store, *policy)
+
+	if len(args) == 0 || args[0] == "list" {
+		lists, err := store.GetMakerLists()
+		if err != nil {
+			return err
+		}
+		for maker, list := range lists {
+			fmt.Printf("%v %v\n", maker, list)
+		}
+		return nil
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("%v", makersUsage)
+	}
+
+	switch args[0] {
+	case "show":
+		stats, err := makers.Stats(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("filled = %v, initiated = %v, completed = %v, abandoned = %v, pending = %v\n",
+			stats.Filled, stats.Initiated, stats.Completed, stats.Abandoned, stats.Pending)
+		return nil
+	case "allow":
+		return makers.SetList(args[1], filler.MakerListAllow)
+	case "deny":
+		return makers.SetList(args[1], filler.MakerListDeny)
+	case "clear":
+		return makers.SetList(args[1], filler.MakerListNone)
+	default:
+		return fmt.Errorf("%v", makersUsage)
+	}
+}
+
+// ParseMakerPolicy parses the rules on the reputation of the makers from MAKER_ABANDON_AFTER, MAKER_COOLDOWN,
+// MAKER_MAX_ABANDONED, MAKER_MAX_ABANDON_RATIO, MAKER_MIN_HISTORY and MAKER_MAX_PENDING. Reputation tracking is disabled
+// if none of them is set.
+func ParseMakerPolicy() (*filler.MakerPolicy, error) {
+	policy := filler.MakerPolicy{}
+	set := false
+	durations := map[string]*time.Duration{
+		"MAKER_ABANDON_AFTER": &policy.AbandonAfter,
+		"MAKER_COOLDOWN":      &policy.Cooldown,
+	}
+	for name, field := range durations {
+		if value := os.Getenv(name); value != "" {
+			duration, err := time.ParseDuration(value)
+			if err != nil || duration < 0 {
+				return nil, fmt.Errorf("invalid %v = %v", name, value)
+			}
+			*field, set = duration, true
+		}
+	}
+	ints := map[string]*int{
+		"MAKER_MAX_ABANDONED": &policy.MaxAbandoned,
+		"MAKER_MIN_HISTORY":   &policy.MinHistory,
+		"MAKER_MAX_PENDING":   &policy.MaxPending,
+	}
+	for name, field := range ints {
+		if value := os.Getenv(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid %v = %v", name, value)
+			}
+			*field, set = n, true
+		}
+	}
+	if value := os.Getenv("MAKER_MAX_ABANDON_RATIO"); value != "" {
+		ratio, err := strconv.ParseFloat(value, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return nil, fmt.Errorf("invalid MAKER_MAX_ABANDON_RATIO = %v", value)
+		}
+		policy.MaxAbandonRatio, set = ratio, true
+	}
+	if !set {
+		return nil, nil
+	}
+	return &policy, nil
+}
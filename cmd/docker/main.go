@@ -32,12 +32,12 @@ func main() {
 		{
 			Chain:       model.EthereumLocalnet,
 			SwapAddress: "0xe7f1725E7734CE288F8367e1Bb143E90bb3F0512",
-			URL:         "http://host.docker.internal:8545",
+			URLs:        []string{"http://host.docker.internal:8545"},
 		},
 		{
 			Chain:       model.EthereumArbitrumLocalnet,
 			SwapAddress: "0xDc64a140Aa3E981100a9becA4E685f962f0cF6C9",
-			URL:         "http://host.docker.internal:8546",
+			URLs:        []string{"http://host.docker.internal:8546"},
 		},
 	}
 
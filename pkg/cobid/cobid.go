@@ -1,8 +1,12 @@
 package cobid
 
 import (
+	"context"
 	"encoding/hex"
+	"fmt"
+	"math/big"
 	"strings"
+	"time"
 
 	"github.com/catalogfi/blockchain/btc"
 	"github.com/catalogfi/cobi/pkg/cobid/creator"
@@ -23,17 +27,49 @@ type Cobid struct {
 	executors executor.Executors
 	filler    filler.Filler
 	creator   creator.Creator
+	clients   []*ethswap.MultiClient
 }
 
 type BtcChainConfig struct {
-	Chain   model.Chain
-	Indexer string
+	Chain    model.Chain
+	Indexer  string
+	Deferral *executor.DeferralPolicy // optional policy to hold uneconomic redeems and refunds
+	Limits   executor.BatchLimits     // optional size limits of a single batch tx
+	Sweep    btcswap.SweepPolicy      // optional policy to sweep the excess funds to cold storage
 }
 
+// EvmChainConfig is the config of a HTLC contract on an evm chain. Multiple HTLC contracts on the same chain are
+// configured with one entry each, they share the chain settings (URLs, chain ID, block time and confirmations) of the
+// first entry of the chain.
 type EvmChainConfig struct {
-	Chain       model.Chain
-	SwapAddress string
-	URL         string
+	Chain         model.Chain
+	SwapAddress   string
+	URLs          []string                // rpc urls of the chain, reads go to the healthiest and txs are broadcast to all
+	WSURL         string                  // optional websocket rpc to subscribe to the HTLC events, they are polled from URL otherwise
+	ChainID       *big.Int                // chain ID of the chain, only optional for the chains in ethswap.ChainIDs
+	BlockTime     time.Duration           // average block time of the chain, executor.DefaultBlockTime if not provided
+	Fees          *ethswap.FeePolicy      // optional EIP-1559 fee policy, ethswap.DefaultFeePolicy is used if not provided
+	Approval      *ethswap.ApprovalPolicy // optional token approval policy, ethswap.DefaultApprovalPolicy is used if not provided
+	Confirmations uint64                  // confirmations required for our txs to be final, default to 1
+	Multicall     string                  // optional Multicall3 address to batch our actions, usually ethswap.Multicall3Address
+	BatchWindow   time.Duration           // how long to gather actions for a batch tx, requires Multicall
+	Native        bool                    // whether the HTLC contract swaps the native asset instead of an ERC-20 token
+	GasReserve    *big.Int                // native balance kept for gas by native HTLCs, ethswap.DefaultGasReserve if not provided
+	IndexFrom     uint64                  // block to start indexing the HTLC events from, usually the deployment block, 0 disables the indexer
+	Rollup        ethswap.Rollup          // kind of rollup the chain is, used to estimate the L1 data fee of our txs
+	Height        ethswap.Height          // height the HTLC timelocks are measured in, ethswap.DefaultHeight if not provided
+}
+
+// GetChainID returns the configured chain ID, or the one of the well-known chain.
+func (evm EvmChainConfig) GetChainID() (*big.Int, error) {
+	if evm.ChainID != nil {
+		return evm.ChainID, nil
+	}
+	id, ok := ethswap.ChainIDs[evm.Chain]
+	if !ok {
+		return nil, fmt.Errorf("chain ID of %v is not configured", evm.Chain)
+	}
+	return id, nil
 }
 
 type Config struct {
@@ -42,9 +78,12 @@ type Config struct {
 	OrderbookWSURL    string
 	RedisURL          string
 	Btc               BtcChainConfig   // chain of the native bitcoin
-	Evms              []EvmChainConfig // target evm chains for wbtc
+	Evms              []EvmChainConfig // target evm chains and HTLC contracts
 	FillerStrategies  []filler.Strategy
 	CreatorStrategies []creator.Strategy
+	NativePrices      map[string]float64     // value of 1 native token in the unit of each evm asset keyed by filler.AssetKey, enables cost-aware filling
+	Makers            *filler.MakerPolicy    // optional rules on the reputation of the makers, nil fills the orders of any maker
+	Exposure          *filler.ExposureLimits // optional limits on the amounts we commit to the filled orders, nil means no limits
 }
 
 func NewCobi(config Config, logger *zap.Logger, estimator btc.FeeEstimator) (Cobid, error) {
@@ -77,35 +116,118 @@ func NewCobi(config Config, logger *zap.Logger, estimator btc.FeeEstimator) (Cob
 
 	// Bitcoin wallet and executor
 	indexer := btc.NewElectrsIndexerClient(logger, config.Btc.Indexer, btc.DefaultRetryInterval)
-	btcWalletOptions := btcswap.NewWalletOptions(config.Btc.Chain.Params())
+	btcWalletOptions := btcswap.NewWalletOptions(config.Btc.Chain.Params()).WithSweep(config.Btc.Sweep)
 	btcWallet, err := btcswap.NewWallet(btcWalletOptions, indexer, util.EcdsaToBtcec(key), estimator)
 	if err != nil {
 		return Cobid{}, err
 	}
-	btcExe := executor.NewBitcoinExecutor(config.Btc.Chain, logger, btcWallet, client, storage, strings.ToLower(addr.Hex()))
+	btcExeOptions := executor.BitcoinOptions{
+		Deferral: config.Btc.Deferral,
+		Limits:   config.Btc.Limits,
+	}
+	btcExe := executor.NewBitcoinExecutor(config.Btc.Chain, logger, btcWallet, client, storage, strings.ToLower(addr.Hex()), btcExeOptions)
 
 	// Ethereum wallet and executor
-	wallets := map[model.Chain]ethswap.Wallet{}
-	clients := map[model.Chain]*ethclient.Client{}
+	wallets := ethswap.Wallets{}
+	clients := map[model.Chain]ethswap.Backend{}
+	multiClients := []*ethswap.MultiClient{}
+	nonces := map[model.Chain]*ethswap.NonceManager{}
+	chainIDs := map[model.Chain]*big.Int{}
+	indexFrom := map[model.Chain]uint64{}
+	ethExeOptions := executor.EvmOptions{
+		Confirmations: map[model.Chain]uint64{},
+		BlockTimes:    map[model.Chain]time.Duration{},
+		BatchWindows:  map[model.Chain]time.Duration{},
+		WSClients:     map[model.Chain]ethswap.Backend{},
+		Heights:       map[model.Chain]ethswap.Height{},
+	}
 	for _, evm := range config.Evms {
-		ethClient, err := ethclient.Dial(evm.URL)
+		chainID, err := evm.GetChainID()
 		if err != nil {
 			return Cobid{}, err
 		}
 
+		// Wallets of the same chain share the client and the nonces
+		ethClient, ok := clients[evm.Chain]
+		if !ok {
+			multiClient, err := ethswap.DialMulti(evm.URLs, ethswap.DefaultMultiClientOptions)
+			if err != nil {
+				return Cobid{}, fmt.Errorf("%v, %v", evm.Chain, err)
+			}
+			multiClients = append(multiClients, multiClient)
+			ethClient = multiClient
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			nonces[evm.Chain], err = ethswap.NewNonceManager(ctx, chainID, crypto.PubkeyToAddress(key.PublicKey), ethClient, storage)
+			cancel()
+			if err != nil {
+				return Cobid{}, err
+			}
+			clients[evm.Chain] = ethClient
+			if evm.WSURL != "" {
+				ethExeOptions.WSClients[evm.Chain], err = ethclient.Dial(evm.WSURL)
+				if err != nil {
+					return Cobid{}, err
+				}
+			}
+			chainIDs[evm.Chain] = chainID
+			ethExeOptions.Confirmations[evm.Chain] = evm.Confirmations
+			ethExeOptions.BlockTimes[evm.Chain] = evm.BlockTime
+			ethExeOptions.Heights[evm.Chain] = evm.Height
+			if evm.Height == "" {
+				ethExeOptions.Heights[evm.Chain] = ethswap.DefaultHeight(evm.Chain, evm.Rollup)
+			}
+		}
+
 		swapAddr := common.HexToAddress(evm.SwapAddress)
-		ethWalletOptions := ethswap.NewOptions(evm.Chain, swapAddr)
+		if _, ok := wallets.Get(evm.Chain, swapAddr); ok {
+			return Cobid{}, fmt.Errorf("duplicate swap contract %v on %v", swapAddr.Hex(), evm.Chain)
+		}
+		ethWalletOptions := ethswap.NewOptions(chainID, swapAddr).WithNonceStore(storage).WithNonceManager(nonces[evm.Chain])
+		if evm.Fees != nil {
+			ethWalletOptions = ethWalletOptions.WithFeePolicy(*evm.Fees)
+		}
+		if evm.Approval != nil {
+			ethWalletOptions = ethWalletOptions.WithApprovalPolicy(*evm.Approval)
+		}
+		if evm.Rollup != ethswap.RollupNone {
+			ethWalletOptions = ethWalletOptions.WithRollup(evm.Rollup)
+		}
+		if evm.Native {
+			ethWalletOptions = ethWalletOptions.WithNative(evm.GasReserve)
+		}
+		if evm.Multicall != "" {
+			ethWalletOptions = ethWalletOptions.WithMulticall(common.HexToAddress(evm.Multicall))
+			ethExeOptions.BatchWindows[evm.Chain] = evm.BatchWindow
+		}
 		ethWallet, err := ethswap.NewWallet(ethWalletOptions, key, ethClient)
 		if err != nil {
 			return Cobid{}, err
 		}
-		wallets[evm.Chain] = ethWallet
-		clients[evm.Chain] = ethClient
+		wallets[ethswap.NewWalletKey(evm.Chain, swapAddr)] = ethWallet
+
+		// Index from the earliest block of the contracts on the chain
+		if from, ok := indexFrom[evm.Chain]; evm.IndexFrom != 0 && (!ok || evm.IndexFrom < from) {
+			indexFrom[evm.Chain] = evm.IndexFrom
+		}
+	}
+
+	// HTLC event indexers of the chains
+	ethExeOptions.Indexers = map[model.Chain]*ethswap.Indexer{}
+	for chain, from := range indexFrom {
+		contracts := []common.Address{}
+		for _, key := range wallets.Keys(chain) {
+			contracts = append(contracts, key.Contract)
+		}
+		indexer, err := ethswap.NewIndexer(chainIDs[chain], clients[chain], contracts, storage, ethswap.IndexerOptions{StartBlock: from})
+		if err != nil {
+			return Cobid{}, err
+		}
+		ethExeOptions.Indexers[chain] = indexer
 	}
 	dialer := func() rest.WSClient {
 		return rest.NewWSClient(config.OrderbookWSURL, logger)
 	}
-	ethExe := executor.NewEvmExecutor(logger, wallets, clients, storage, dialer)
+	ethExe := executor.NewEvmExecutor(logger, wallets, clients, storage, dialer, ethExeOptions)
 	exes := executor.Executors{btcExe, ethExe}
 
 	cStorage, err := creator.NewRedisStore(config.RedisURL)
@@ -113,10 +235,27 @@ func NewCobi(config Config, logger *zap.Logger, estimator btc.FeeEstimator) (Cob
 		return Cobid{}, err
 	}
 	signer := crypto.PubkeyToAddress(key.PublicKey)
+	var costs filler.CostEstimator
+	if len(config.NativePrices) != 0 {
+		costs = filler.NewCostEstimator(btcWallet, wallets, config.NativePrices)
+	}
+	fillerStorage, err := filler.NewRedisStore(config.RedisURL)
+	if err != nil {
+		return Cobid{}, err
+	}
+	var makers *filler.Makers
+	if config.Makers != nil {
+		makers = filler.NewMakers(fillerStorage, *config.Makers)
+	}
+	var exposure *filler.Exposure
+	if config.Exposure != nil {
+		exposure = filler.NewExposure(*config.Exposure, fillerStorage)
+	}
 	return Cobid{
 		executors: exes,
-		filler:    filler.New(config.FillerStrategies, btcWallet, wallets, client, dialer, logger),
+		filler:    filler.New(config.FillerStrategies, btcWallet, wallets, client, dialer, costs, makers, exposure, logger),
 		creator:   creator.New(signer.Hex(), config.CreatorStrategies, btcWallet, wallets, client, cStorage, logger),
+		clients:   multiClients,
 	}, nil
 }
 
@@ -132,4 +271,7 @@ func (cb Cobid) Stop() {
 	cb.executors.Stop()
 	cb.creator.Stop()
 	cb.filler.Stop()
+	for _, client := range cb.clients {
+		client.Close()
+	}
 }
@@ -30,7 +30,7 @@ type Creator interface {
 type creator struct {
 	signer     string
 	btcWallet  btcswap.Wallet
-	ethWallets map[model.Chain]ethswap.Wallet
+	ethWallets ethswap.Wallets
 	stratagies []Strategy
 	restClient rest.Client
 	store      Store
@@ -43,7 +43,7 @@ func New(
 	signer string,
 	stratagies []Strategy,
 	btcWallet btcswap.Wallet,
-	ethWallets map[model.Chain]ethswap.Wallet,
+	ethWallets ethswap.Wallets,
 	restClient rest.Client,
 	store Store,
 	logger *zap.Logger,
@@ -71,6 +71,11 @@ func (c *creator) Stop() {
 }
 
 func (c *creator) Start() error {
+	for _, strategy := range c.stratagies {
+		if err := c.checkWallets(strategy.OrderPair); err != nil {
+			return err
+		}
+	}
 	for _, strategy := range c.stratagies {
 		go func(s Strategy) {
 			if err := c.create(s); err != nil {
@@ -157,7 +162,7 @@ func (f *creator) balanceCheck(from, to model.Chain, asset model.Asset, amount *
 
 	// Check the `from` chain first, we only need to make sure we have enough eth to pay the gas if it's a evm chain
 	if from.IsEVM() {
-		ethWallet := f.ethWallets[from]
+		ethWallet, _ := f.ethWallets.Chain(from)
 		ethBalance, err := ethWallet.Balance(ctx, true)
 		if err != nil {
 			return fmt.Errorf("failed to get eth balance, %v", err)
@@ -184,7 +189,7 @@ func (f *creator) balanceCheck(from, to model.Chain, asset model.Asset, amount *
 			return fmt.Errorf("%v balance is not enough, required = %v, has = %v unexecuted =%v", to, unexecuted.Int64()+amount.Int64(), balance, unexecuted.String())
 		}
 	} else {
-		wallet := f.ethWallets[to]
+		wallet, _ := f.ethWallets.Asset(to, asset)
 
 		// Check if the balance is enough
 		balance, err := wallet.TokenBalance(ctx, true)
@@ -232,6 +237,26 @@ func (c *creator) addr(chain model.Chain) string {
 	if chain.IsBTC() {
 		return c.btcWallet.Address().EncodeAddress()
 	} else {
-		return c.ethWallets[chain].Address().Hex()
+		wallet, _ := c.ethWallets.Chain(chain)
+		return wallet.Address().Hex()
 	}
 }
+
+// checkWallets makes sure we have a wallet for the HTLC contract of each evm asset in the order pair.
+func (c *creator) checkWallets(orderPair string) error {
+	from, to, fromAsset, toAsset, err := model.ParseOrderPair(orderPair)
+	if err != nil {
+		return err
+	}
+	if from.IsEVM() {
+		if _, ok := c.ethWallets.Asset(from, fromAsset); !ok {
+			return fmt.Errorf("no wallet for %v on %v", fromAsset, from)
+		}
+	}
+	if to.IsEVM() {
+		if _, ok := c.ethWallets.Asset(to, toAsset); !ok {
+			return fmt.Errorf("no wallet for %v on %v", toAsset, to)
+		}
+	}
+	return nil
+}
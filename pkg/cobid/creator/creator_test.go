@@ -67,7 +67,7 @@ package creator_test
 
 // 			ethWallet, err := ethswap.NewWallet(ethswap.Options{}, ethKey, ethclient)
 // 			Expect(err).To(BeNil())
-// 			ethWallets := map[model.Chain]ethswap.Wallet{model.EthereumLocalnet: ethWallet}
+// 			ethWallets := ethswap.Wallets{ethswap.NewWalletKey(model.EthereumLocalnet, crypto.PubkeyToAddress(swapKey.PublicKey)): ethWallet}
 
 // 			ctr := creator.New([]creator.Strategy{sty}, btcWallet, ethWallets, obRestClient, createStore, logger)
 // 			Expect(ctr.Start()).Should(Succeed())
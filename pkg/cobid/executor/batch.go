@@ -0,0 +1,292 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/catalogfi/blockchain/btc"
+	"github.com/catalogfi/cobi/pkg/swap"
+	"github.com/catalogfi/cobi/pkg/swap/btcswap"
+	"go.uber.org/zap"
+)
+
+const (
+	// P2wshOutputVirtualSize is the virtual size of an output paying to a swap address.
+	P2wshOutputVirtualSize = 43
+
+	// P2wpkhInputVirtualSize is the virtual size of spending an utxo of our wallet.
+	P2wpkhInputVirtualSize = 68
+)
+
+// BatchLimits caps the size of a batch tx. When adding new actions would exceed any of the limits, the current batch is
+// sealed and a new batch is started.
+type BatchLimits struct {
+	MaxInputs      int // maximum number of inputs, 0 means no limit
+	MaxOutputs     int // maximum number of outputs, 0 means no limit
+	MaxVirtualSize int // maximum virtual size in vbytes, 0 means no limit
+}
+
+// batchSize is an estimate of the size of a batch tx.
+type batchSize struct {
+	inputs  int
+	outputs int
+	vsize   int
+}
+
+func estimateBatchSize(rbf btcswap.OptionRBF) batchSize {
+	size := batchSize{
+		inputs:  len(rbf.PrevRawInputs.VIN),
+		outputs: len(rbf.PrevRecipient) + 1, // including the change
+		vsize:   TxOverheadVirtualSize,
+	}
+	size.vsize += len(rbf.PrevRecipient) * P2wshOutputVirtualSize
+	size.vsize += len(rbf.PrevRawInputs.VIN)*btcswap.TxInVirtualSize + (rbf.PrevRawInputs.SegwitSize+3)/4
+	if rbf.Sweep != nil {
+		size.outputs++
+		size.vsize += P2wshOutputVirtualSize
+	}
+	if walletInputs := len(rbf.PrevInputs) - len(rbf.PrevRawInputs.VIN); walletInputs > 0 {
+		size.inputs += walletInputs
+		size.vsize += walletInputs * P2wpkhInputVirtualSize
+	}
+	return size
+}
+
+func (size batchSize) add(item btcswap.ActionItem) batchSize {
+	switch item.Action {
+	case swap.ActionInitiate:
+		size.outputs++
+		size.vsize += P2wshOutputVirtualSize
+	case swap.ActionRedeem, swap.ActionRefund:
+		size.inputs++
+		size.vsize += item.SpendVirtualSize()
+	}
+	return size
+}
+
+func (limits BatchLimits) exceeded(size batchSize) bool {
+	return (limits.MaxInputs > 0 && size.inputs > limits.MaxInputs) ||
+		(limits.MaxOutputs > 0 && size.outputs > limits.MaxOutputs) ||
+		(limits.MaxVirtualSize > 0 && size.vsize > limits.MaxVirtualSize)
+}
+
+// assignBatches adds the actions to the open batch until it reaches the limits, then seals it and continues with a new
+// batch. It returns the actions assigned to each batch by index.
+func (be *BitcoinExecutor) assignBatches(bd *BatchData, actions []btcswap.ActionItem) map[int][]btcswap.ActionItem {
+	assigned := map[int][]btcswap.ActionItem{}
+	if len(actions) == 0 {
+		return assigned
+	}
+
+	open := bd.Open()
+	size := estimateBatchSize(bd.Batches[open].RbfOptions)
+	count := len(bd.Batches[open].PrevOrders)
+	for _, action := range actions {
+		next := size.add(action)
+
+		// A single action is always allowed even if it exceeds the limits by itself.
+		if be.opts.Limits.exceeded(next) && count > 0 {
+			bd.Batches[open].Seal()
+			be.logger.Info("📦 [Batch] sealed", zap.Int("batch", open), zap.Int("actions", count), zap.Int("inputs", size.inputs), zap.Int("outputs", size.outputs), zap.Int("vsize", size.vsize))
+
+			open = bd.Open()
+			size = estimateBatchSize(bd.Batches[open].RbfOptions)
+			next = size.add(action)
+			count = 0
+		}
+		assigned[open] = append(assigned[open], action)
+		size = next
+		count++
+	}
+	return assigned
+}
+
+// pruneBatches removes the batches whose latest tx has been confirmed.
+func (be *BitcoinExecutor) pruneBatches(bd *BatchData) {
+	batches := make([]Batch, 0, len(bd.Batches))
+	for _, batch := range bd.Batches {
+		if batch.Txid != "" {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			tx, err := be.wallet.Indexer().GetTx(ctx, batch.Txid)
+			cancel()
+			if err == nil && tx.Status.Confirmed {
+				be.logger.Debug("batch confirmed", zap.String("txid", batch.Txid))
+				continue
+			}
+		}
+		batches = append(batches, batch)
+	}
+	bd.Batches = batches
+}
+
+// executeBatches submits the new actions and bumps the fees of the existing batches when needed. Batches which are no
+// longer valid are removed.
+func (be *BitcoinExecutor) executeBatches(bd *BatchData, actions []btcswap.ActionItem) {
+	be.pruneBatches(bd)
+	assigned := be.assignBatches(bd, actions)
+
+	var feeRanges []ProjectedBlock
+	projected := false
+	sweepIndex := be.nextSweepIndex()
+	batches := make([]Batch, 0, len(bd.Batches))
+	for i := range bd.Batches {
+		batch := bd.Batches[i]
+		items := assigned[i]
+
+		// Skip if we have no new actions for the batch and its fees are good
+		if len(items) == 0 {
+			if len(batch.PrevOrders) == 0 {
+				continue
+			}
+			if !projected {
+				feeRanges = be.nextBlocks()
+				projected = true
+			}
+			if !be.needsBump(batch.RbfOptions, feeRanges) {
+				batches = append(batches, batch)
+				continue
+			}
+		}
+
+		// A batch which hasn't been submitted must not use utxos reserved by other batches. They are also left out
+		// when deciding how much to sweep.
+		others := BatchData{Batches: append(append([]Batch{}, batches...), bd.Batches[i+1:]...)}
+		batch.RbfOptions.ExcludedUtxos = others.reservedUtxos()
+		if batch.RbfOptions.Sweep == nil {
+			batch.RbfOptions.SweepIndex = sweepIndex
+		}
+
+		if ok := be.executeBatch(&batch, items); !ok {
+			// The utxos reserved by the batch are released with it, its actions will be picked up in the next poll.
+			be.logger.Info("📦 [Batch] dropped", zap.String("txid", batch.Txid), zap.Int("reserved utxos", len(batch.RbfOptions.PrevInputs)+len(batch.RbfOptions.FirstUtxos)), zap.Int("new actions", len(items)))
+			continue
+		}
+		batches = append(batches, batch)
+		if sweep := batch.RbfOptions.Sweep; sweep != nil && sweep.Index == sweepIndex {
+			sweepIndex++
+		}
+	}
+	bd.Batches = batches
+}
+
+// executeBatch submits the actions as a replacement of the latest tx of the batch. It returns false if the batch is no
+// longer valid and should be removed.
+func (be *BitcoinExecutor) executeBatch(batch *Batch, actions []btcswap.ActionItem) bool {
+	log.Printf("execute rbf = %+v", batch.RbfOptions)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	txid, newRBF, err := be.wallet.ExecuteRbf(ctx, actions, batch.RbfOptions)
+	cancel()
+	if err != nil {
+		// Previous tx been included in the block, we wait for orderbook to update the order status and
+		// check again later
+		if errors.Is(err, btc.ErrTxInputsMissingOrSpent) {
+			be.logger.Debug("input conflicts", zap.String("txid", batch.Txid))
+			return false
+		}
+		// Hold the batch when hitting any fee limit, actions will be picked up again in next poll.
+		var feeErr btcswap.FeeLimitError
+		if errors.As(err, &feeErr) {
+			be.logger.Error("🚨 [Fee Limit] holding btc batch", zap.String("limit", feeErr.Limit), zap.Float64("value", feeErr.Value), zap.Float64("allows", feeErr.Allows), zap.Int("new actions", len(actions)))
+			return len(batch.PrevOrders) != 0
+		}
+		be.logger.Error("❌ [Execution] btc ", zap.Error(err))
+		return len(batch.PrevOrders) != 0
+	}
+
+	be.logger.Info("✅ [Execution]", zap.String("chain", "btc"), zap.String("txid", txid))
+	be.recordSweep(batch.Txid, batch.RbfOptions.Sweep, txid, newRBF.Sweep)
+
+	// Update the batch data for next poll
+	for _, action := range actions {
+		batch.AddExecuteAction(action)
+	}
+	batch.RbfOptions = newRBF
+	batch.Txid = txid
+	if batch.Sealed {
+		batch.RbfOptions = btcswap.SealRBF(batch.RbfOptions)
+	}
+	return true
+}
+
+// needsBump checks if the batch needs a fee bump, either because some actions are getting close to their deadline or
+// the fee rate is too low to get into the next block.
+func (be *BitcoinExecutor) needsBump(rbf btcswap.OptionRBF, feeRanges []ProjectedBlock) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	urgent, err := be.wallet.Urgent(ctx, rbf)
+	cancel()
+	if err != nil {
+		be.logger.Error("check urgency", zap.Error(err))
+	}
+	if urgent {
+		be.logger.Info("⏫ urgent actions in the batch, updating the fees")
+		return true
+	}
+
+	// Check the fee rate we used and the lowest fee in the next block
+	if len(feeRanges) < 1 || len(feeRanges[0].FeeRange) < 1 {
+		return false
+	}
+	if float64(rbf.PrevFeeRate) >= feeRanges[0].FeeRange[0]+1 {
+		return false
+	}
+	be.logger.Debug("fee tow low, updating the fees")
+	return true
+}
+
+// recordSweep keeps track of the sweep of the new tx, which replaces the previous tx of the batch.
+func (be *BitcoinExecutor) recordSweep(prevTxid string, prevSweep *btcswap.Sweep, txid string, sweep *btcswap.Sweep) {
+	replaced := ""
+	if prevSweep != nil {
+		replaced = prevTxid
+	}
+	if sweep == nil {
+		if replaced != "" {
+			if err := be.store.RemoveSweep(replaced); err != nil {
+				be.logger.Error("remove sweep record", zap.String("txid", replaced), zap.Error(err))
+			}
+		}
+		return
+	}
+
+	be.logger.Info("🧹 [Sweep]", zap.String("txid", txid), zap.String("to", sweep.To), zap.Int64("amount", sweep.Amount))
+	record := SweepRecord{
+		Txid:      txid,
+		To:        sweep.To,
+		Amount:    sweep.Amount,
+		Index:     sweep.Index,
+		Timestamp: time.Now().Unix(),
+	}
+	if err := be.store.StoreSweep(record, replaced); err != nil {
+		be.logger.Error("store sweep record", zap.String("txid", txid), zap.Error(err))
+	}
+}
+
+// nextSweepIndex returns the derivation index of the next cold address, so each sweep goes to a new address when the
+// cold addresses are derived from a xpub.
+func (be *BitcoinExecutor) nextSweepIndex() uint32 {
+	records, err := be.store.GetSweeps()
+	if err != nil {
+		be.logger.Error("get sweep records", zap.Error(err))
+		return 0
+	}
+	next := uint32(0)
+	for _, record := range records {
+		if record.Index >= next {
+			next = record.Index + 1
+		}
+	}
+	return next
+}
+
+func (be *BitcoinExecutor) nextBlocks() []ProjectedBlock {
+	if be.projector == nil {
+		return nil
+	}
+	feeRanges, err := be.projector.NextBlocks()
+	if err != nil {
+		return nil
+	}
+	return feeRanges
+}
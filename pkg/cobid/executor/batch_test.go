@@ -0,0 +1,151 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/catalogfi/blockchain/btc"
+	"github.com/catalogfi/cobi/pkg/swap"
+	"github.com/catalogfi/cobi/pkg/swap/btcswap"
+	"go.uber.org/zap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type testIndexer struct {
+	btc.IndexerClient
+	confirmed map[string]bool
+}
+
+func (indexer testIndexer) GetTx(ctx context.Context, txid string) (btc.Transaction, error) {
+	confirmed, ok := indexer.confirmed[txid]
+	if !ok {
+		return btc.Transaction{}, fmt.Errorf("tx not found")
+	}
+	return btc.Transaction{TxID: txid, Status: btc.Status{Confirmed: confirmed}}, nil
+}
+
+type testBtcWallet struct {
+	btcswap.Wallet
+	indexer testIndexer
+	execute func(actions []btcswap.ActionItem, rbf btcswap.OptionRBF) (string, btcswap.OptionRBF, error)
+	calls   []btcswap.OptionRBF
+}
+
+func (wallet *testBtcWallet) Indexer() btc.IndexerClient {
+	return wallet.indexer
+}
+
+func (wallet *testBtcWallet) Urgent(ctx context.Context, rbf btcswap.OptionRBF) (bool, error) {
+	return false, nil
+}
+
+func (wallet *testBtcWallet) ExecuteRbf(ctx context.Context, actions []btcswap.ActionItem, rbf btcswap.OptionRBF) (string, btcswap.OptionRBF, error) {
+	wallet.calls = append(wallet.calls, rbf)
+	return wallet.execute(actions, rbf)
+}
+
+type testStore struct {
+	Store
+}
+
+func (store testStore) GetSweeps() ([]SweepRecord, error) {
+	return nil, nil
+}
+
+var _ = Describe("Bitcoin batches", func() {
+	initiate := func(i int) btcswap.ActionItem {
+		return btcswap.ActionItem{Action: swap.ActionInitiate, AtomicSwap: btcswap.Swap{SecretHash: []byte{byte(i)}}}
+	}
+	utxo := func(txid string) btc.UTXO {
+		return btc.UTXO{TxID: txid, Vout: 0, Amount: 1e6}
+	}
+	submitted := func(txid string, sealed bool, inputs ...btc.UTXO) Batch {
+		batch := NewBatch()
+		batch.AddExecuteAction(initiate(len(txid)))
+		batch.Txid = txid
+		batch.RbfOptions.PrevRecipient = []btc.Recipient{{To: txid, Amount: 1e6}}
+		batch.RbfOptions.PrevInputs = inputs
+		batch.Sealed = sealed
+		return batch
+	}
+
+	var wallet *testBtcWallet
+	var be *BitcoinExecutor
+	BeforeEach(func() {
+		wallet = &testBtcWallet{indexer: testIndexer{confirmed: map[string]bool{}}}
+		be = &BitcoinExecutor{logger: zap.NewNop(), wallet: wallet, store: testStore{}}
+	})
+
+	It("should seal the open batch and start a new one when it reaches the limits", func() {
+		be.opts.Limits = BatchLimits{MaxOutputs: 3}
+		bd := NewBatchData()
+		actions := []btcswap.ActionItem{initiate(1), initiate(2), initiate(3), initiate(4), initiate(5)}
+		assigned := be.assignBatches(&bd, actions)
+
+		Expect(bd.Batches).Should(HaveLen(3))
+		Expect(bd.Batches[0].Sealed).Should(BeTrue())
+		Expect(bd.Batches[1].Sealed).Should(BeTrue())
+		Expect(bd.Batches[2].Sealed).Should(BeFalse())
+		Expect(assigned[0]).Should(Equal(actions[:2]))
+		Expect(assigned[1]).Should(Equal(actions[2:4]))
+		Expect(assigned[2]).Should(Equal(actions[4:]))
+	})
+
+	It("should keep adding to the open batch until it's full", func() {
+		be.opts.Limits = BatchLimits{MaxOutputs: 3}
+		bd := BatchData{Batches: []Batch{submitted("tx1", false)}}
+		assigned := be.assignBatches(&bd, []btcswap.ActionItem{initiate(1), initiate(2)})
+
+		Expect(bd.Batches).Should(HaveLen(2))
+		Expect(bd.Batches[0].Sealed).Should(BeTrue())
+		Expect(assigned[0]).Should(HaveLen(1))
+		Expect(assigned[1]).Should(HaveLen(1))
+	})
+
+	It("should prune the batches whose tx has been confirmed", func() {
+		wallet.indexer.confirmed["confirmed"] = true
+		wallet.indexer.confirmed["pending"] = false
+		bd := BatchData{Batches: []Batch{submitted("confirmed", true), submitted("pending", true), submitted("unknown", false), NewBatch()}}
+		be.pruneBatches(&bd)
+
+		Expect(bd.Batches).Should(HaveLen(3))
+		Expect(bd.Batches[0].Txid).Should(Equal("pending"))
+		Expect(bd.Batches[1].Txid).Should(Equal("unknown"))
+		Expect(bd.Batches[2].Txid).Should(Equal(""))
+	})
+
+	It("should only reserve the utxos of batches which have been broadcast", func() {
+		unsent := NewBatch()
+		unsent.RbfOptions.FirstUtxos = []btc.UTXO{utxo("unsent")}
+		bd := BatchData{Batches: []Batch{submitted("tx1", true, utxo("a")), unsent}}
+		Expect(bd.reservedUtxos()).Should(Equal([]string{btcswap.UtxoKey(utxo("a"))}))
+	})
+
+	It("should release the utxos of a batch which fails to build", func() {
+		be.opts.Limits = BatchLimits{MaxOutputs: 2}
+		wallet.execute = func(actions []btcswap.ActionItem, rbf btcswap.OptionRBF) (string, btcswap.OptionRBF, error) {
+			return "", rbf, btcswap.FeeLimitError{Limit: btcswap.FeeLimitRate}
+		}
+		bd := BatchData{Batches: []Batch{submitted("tx1", false, utxo("a"))}}
+		be.executeBatches(&bd, []btcswap.ActionItem{initiate(1), initiate(2)})
+
+		// The submitted batch is held and the new batch is dropped, releasing everything it reserved
+		Expect(bd.Batches).Should(HaveLen(1))
+		Expect(bd.Batches[0].Txid).Should(Equal("tx1"))
+		Expect(bd.reservedUtxos()).Should(Equal([]string{btcswap.UtxoKey(utxo("a"))}))
+
+		// The next batch doesn't exclude any utxo of the dropped batch
+		wallet.calls = nil
+		wallet.execute = func(actions []btcswap.ActionItem, rbf btcswap.OptionRBF) (string, btcswap.OptionRBF, error) {
+			rbf.FirstUtxos = []btc.UTXO{utxo("b")}
+			return "tx2", rbf, nil
+		}
+		be.executeBatches(&bd, []btcswap.ActionItem{initiate(3)})
+		Expect(wallet.calls).Should(HaveLen(1))
+		Expect(wallet.calls[0].ExcludedUtxos).Should(Equal([]string{btcswap.UtxoKey(utxo("a"))}))
+		Expect(bd.Batches).Should(HaveLen(2))
+		Expect(bd.reservedUtxos()).Should(ConsistOf(btcswap.UtxoKey(utxo("a")), btcswap.UtxoKey(utxo("b"))))
+	})
+})
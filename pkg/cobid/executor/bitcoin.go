@@ -3,11 +3,8 @@ package executor
 import (
 	"context"
 	"encoding/hex"
-	"errors"
-	"log"
 	"time"
 
-	"github.com/catalogfi/blockchain/btc"
 	"github.com/catalogfi/cobi/pkg/swap"
 	"github.com/catalogfi/cobi/pkg/swap/btcswap"
 	"github.com/catalogfi/ob/model"
@@ -15,6 +12,12 @@ import (
 	"go.uber.org/zap"
 )
 
+// BitcoinOptions contains the optional policies of the BitcoinExecutor.
+type BitcoinOptions struct {
+	Deferral *DeferralPolicy // nil means all redeems and refunds are executed immediately
+	Limits   BatchLimits     // size limits of a single batch tx, zero values mean no limit
+}
+
 type BitcoinExecutor struct {
 	chain     model.Chain
 	logger    *zap.Logger
@@ -24,9 +27,10 @@ type BitcoinExecutor struct {
 	store     Store
 	stop      chan struct{}
 	projector *BlockProjector
+	opts      BitcoinOptions
 }
 
-func NewBitcoinExecutor(chain model.Chain, logger *zap.Logger, wallet btcswap.Wallet, client rest.Client, store Store, signer string) *BitcoinExecutor {
+func NewBitcoinExecutor(chain model.Chain, logger *zap.Logger, wallet btcswap.Wallet, client rest.Client, store Store, signer string, opts BitcoinOptions) *BitcoinExecutor {
 	projector := NewMempoolProjector()
 	// if chain.IsTestnet() {
 	// 	projector = nil
@@ -40,6 +44,7 @@ func NewBitcoinExecutor(chain model.Chain, logger *zap.Logger, wallet btcswap.Wa
 		store:     store,
 		stop:      make(chan struct{}),
 		projector: projector,
+		opts:      opts,
 	}
 
 	return exe
@@ -80,6 +85,17 @@ func (be *BitcoinExecutor) Start() {
 					return initiated, err
 				}
 
+				swapExpiry := func(swap btcswap.Swap) (uint64, error) {
+					ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					defer cancel()
+
+					initiated, height, err := swap.Initiated(ctx, be.wallet.Indexer())
+					if err != nil || !initiated {
+						return 0, err
+					}
+					return height + uint64(swap.WaitBlock), nil
+				}
+
 				// Get all the new orders we need to execute.
 				newActions := make([]btcswap.ActionItem, 0, len(orders))
 				for _, order := range orders {
@@ -148,58 +164,24 @@ func (be *BitcoinExecutor) Start() {
 						if initiated {
 							continue
 						}
+					} else {
+						// The expiry is used to decide how urgent the redeem or refund is.
+						expiry, err := swapExpiry(btcSwap)
+						if err != nil {
+							be.logger.Error("check swap expiry", zap.Error(err))
+						}
+						actionItem.Expiry = expiry
 					}
 					newActions = append(newActions, actionItem)
 				}
+				newActions = be.deferActions(newActions, bd)
 				be.logger.Debug("btc executor", zap.Int("new actions", len(newActions)))
 				for _, actionItem := range newActions {
 					be.logger.Debug("btc executor", zap.String(string(actionItem.Action), actionItem.AtomicSwap.Address.EncodeAddress()))
 				}
 
-				// Skip if we have no orders to process
-				if len(newActions) == 0 {
-					// Check new block fee range and see if we need to pump the fee
-					if len(bd.PrevOrders) == 0 || be.projector == nil {
-						continue
-					}
-					feeRanges, err := be.projector.NextBlocks()
-					if err != nil || len(feeRanges) < 1 || len(feeRanges[0].FeeRange) < 1 {
-						continue
-					}
-
-					// Check the fee rate we used and the lowest fee in the next block
-					if float64(bd.RbfOptions.PrevFeeRate) >= feeRanges[0].FeeRange[0]+1 {
-						continue
-					}
-					be.logger.Debug("fee tow low, updating the fees")
-				}
-
-				// Submit the transaction
-				log.Printf("execute rbf = %+v", bd.RbfOptions)
-				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-				txid, newRBF, err := be.wallet.ExecuteRbf(ctx, newActions, bd.RbfOptions)
-				cancel()
-				if err != nil {
-					// Previous tx been included in the block, we wait for orderbook to update the order status and
-					// check again later
-					if errors.Is(err, btc.ErrTxInputsMissingOrSpent) {
-						be.logger.Debug("input conflicts")
-						if err := be.store.StoreBatchData(NewBatchData()); err != nil {
-							be.logger.Error("store rbf info", zap.Error(err))
-						}
-						continue
-					}
-					be.logger.Error("❌ [Execution] btc ", zap.Error(err))
-					continue
-				}
-
-				be.logger.Info("✅ [Execution]", zap.String("chain", "btc"), zap.String("txid", txid))
-
-				// Update the batch data and store it for next poll
-				for _, action := range newActions {
-					bd.AddExecuteAction(action)
-				}
-				bd.RbfOptions = newRBF
+				// Execute the new actions in batches and bump the fees of previous batches if needed
+				be.executeBatches(&bd, newActions)
 				if err := be.store.StoreBatchData(bd); err != nil {
 					be.logger.Error("storing batch data", zap.Error(err))
 				}
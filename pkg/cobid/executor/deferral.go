@@ -0,0 +1,138 @@
+package executor
+
+import (
+	"context"
+	"time"
+
+	"github.com/catalogfi/cobi/pkg/swap"
+	"github.com/catalogfi/cobi/pkg/swap/btcswap"
+	"go.uber.org/zap"
+)
+
+// TxOverheadVirtualSize is the virtual size of a tx without any input or output we're adding for the swaps, including
+// version, locktime, segwit marker and the change output back to our wallet.
+const TxOverheadVirtualSize = 11 + 31
+
+// DeferralPolicy decides whether a redeem or refund is worth executing at the current fee rate. Uneconomic actions are
+// held until fees drop, there are enough of them to share the tx overhead, or the swap is close to its deadline.
+type DeferralPolicy struct {
+	MaxCostRatio   float64 // maximum cost of spending a swap as a percentage of its value, 0 disables the policy
+	MinBatchSize   int     // release all held actions once there are this many of them, 0 means never
+	DeadlineBlocks uint64  // never hold a redeem when the swap expires within this many blocks
+	MaxRefundDelay uint64  // never hold a refund for more than this many blocks after the swap expired
+}
+
+// deferralCandidate is a redeem or refund action we are considering to hold.
+type deferralCandidate struct {
+	item     btcswap.ActionItem
+	value    int64  // value of the swap
+	deadline uint64 // block height from which the action must be executed regardless of fees
+}
+
+// Split the candidates into actions we should execute now and the ones we should hold. `overheadPaid` tells if the tx
+// overhead is already paid by other actions in the batch, in which case only the cost of the swap input is considered.
+func (policy DeferralPolicy) split(candidates []deferralCandidate, feeRate int, tip uint64, overheadPaid bool) ([]deferralCandidate, []deferralCandidate) {
+	if policy.MaxCostRatio <= 0 || len(candidates) == 0 {
+		return candidates, nil
+	}
+
+	overhead := int64(0)
+	if !overheadPaid {
+		overhead = int64(TxOverheadVirtualSize*feeRate) / int64(len(candidates))
+	}
+
+	execute := make([]deferralCandidate, 0, len(candidates))
+	hold := make([]deferralCandidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		// Safety always wins over saving fees
+		if tip >= candidate.deadline {
+			execute = append(execute, candidate)
+			continue
+		}
+
+		cost := int64(candidate.item.SpendVirtualSize()*feeRate) + overhead
+		if float64(cost)*100 <= float64(candidate.value)*policy.MaxCostRatio {
+			execute = append(execute, candidate)
+		} else {
+			hold = append(hold, candidate)
+		}
+	}
+
+	// Release the held actions when we have enough of them
+	if policy.MinBatchSize > 0 && len(hold) >= policy.MinBatchSize {
+		execute = append(execute, hold...)
+		hold = nil
+	}
+	return execute, hold
+}
+
+// deferActions filters out the uneconomic redeems and refunds according to the deferral policy. Held actions are not
+// recorded in the batch data, so they will be evaluated again in the next poll. Any action we fail to evaluate is
+// executed right away.
+func (be *BitcoinExecutor) deferActions(actions []btcswap.ActionItem, bd BatchData) []btcswap.ActionItem {
+	policy := be.opts.Deferral
+	if policy == nil || policy.MaxCostRatio <= 0 {
+		return actions
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	feeRate, err := be.wallet.FeeRate()
+	if err != nil {
+		be.logger.Error("get fee rate", zap.Error(err))
+		return actions
+	}
+	tip, err := be.wallet.Indexer().GetTipBlockHeight(ctx)
+	if err != nil {
+		be.logger.Error("get tip block height", zap.Error(err))
+		return actions
+	}
+
+	// Initiations are always executed, they pay for the tx overhead if there are any.
+	overheadPaid := false
+	if n := len(bd.Batches); n > 0 && !bd.Batches[n-1].Sealed {
+		overheadPaid = len(bd.Batches[n-1].PrevOrders) != 0
+	}
+	result := make([]btcswap.ActionItem, 0, len(actions))
+	candidates := make([]deferralCandidate, 0, len(actions))
+	for _, item := range actions {
+		if item.Action != swap.ActionRedeem && item.Action != swap.ActionRefund {
+			overheadPaid = true
+			result = append(result, item)
+			continue
+		}
+
+		if item.Expiry == 0 {
+			result = append(result, item)
+			continue
+		}
+		expiry := item.Expiry
+		deadline := expiry + policy.MaxRefundDelay
+		if item.Action == swap.ActionRedeem {
+			deadline = 0
+			if expiry > policy.DeadlineBlocks {
+				deadline = expiry - policy.DeadlineBlocks
+			}
+		}
+		candidates = append(candidates, deferralCandidate{
+			item:     item,
+			value:    item.AtomicSwap.Amount,
+			deadline: deadline,
+		})
+	}
+
+	execute, hold := policy.split(candidates, feeRate, tip, overheadPaid)
+	for _, candidate := range execute {
+		result = append(result, candidate.item)
+	}
+	for _, candidate := range hold {
+		be.logger.Info("⏸️ [Deferred]",
+			zap.String("action", string(candidate.item.Action)),
+			zap.String("swap", candidate.item.AtomicSwap.Address.EncodeAddress()),
+			zap.Int64("value", candidate.value),
+			zap.Int("fee rate", feeRate),
+			zap.Uint64("deadline", candidate.deadline))
+	}
+	return result
+}
@@ -0,0 +1,71 @@
+package executor
+
+import (
+	"github.com/catalogfi/cobi/pkg/swap"
+	"github.com/catalogfi/cobi/pkg/swap/btcswap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Deferral policy", func() {
+	redeem := btcswap.ActionItem{Action: swap.ActionRedeem, Secret: make([]byte, 32)}
+	refund := btcswap.ActionItem{Action: swap.ActionRefund}
+	candidate := func(item btcswap.ActionItem, value int64, deadline uint64) deferralCandidate {
+		return deferralCandidate{item: item, value: value, deadline: deadline}
+	}
+
+	It("should execute everything when the policy is disabled", func() {
+		candidates := []deferralCandidate{candidate(redeem, 1000, 100)}
+		execute, hold := DeferralPolicy{}.split(candidates, 100, 10, false)
+		Expect(execute).Should(Equal(candidates))
+		Expect(hold).Should(BeEmpty())
+	})
+
+	It("should hold the actions costing more than the ratio of their value", func() {
+		policy := DeferralPolicy{MaxCostRatio: 1}
+		feeRate := 10
+		cost := int64(redeem.SpendVirtualSize() * feeRate)
+
+		cheap := candidate(redeem, cost*100, 100)
+		expensive := candidate(redeem, cost*100-1, 100)
+		execute, hold := policy.split([]deferralCandidate{cheap, expensive}, feeRate, 10, true)
+		Expect(execute).Should(Equal([]deferralCandidate{cheap}))
+		Expect(hold).Should(Equal([]deferralCandidate{expensive}))
+	})
+
+	It("should share the tx overhead between the candidates when it's not paid", func() {
+		policy := DeferralPolicy{MaxCostRatio: 1}
+		feeRate := 10
+		value := int64(refund.SpendVirtualSize()*feeRate) * 100
+
+		execute, hold := policy.split([]deferralCandidate{candidate(refund, value, 100)}, feeRate, 10, true)
+		Expect(execute).Should(HaveLen(1))
+		Expect(hold).Should(BeEmpty())
+
+		execute, hold = policy.split([]deferralCandidate{candidate(refund, value, 100)}, feeRate, 10, false)
+		Expect(execute).Should(BeEmpty())
+		Expect(hold).Should(HaveLen(1))
+	})
+
+	It("should execute the actions which reached their deadline regardless of the cost", func() {
+		policy := DeferralPolicy{MaxCostRatio: 1}
+		late := candidate(refund, 1, 10)
+		execute, hold := policy.split([]deferralCandidate{late, candidate(refund, 1, 11)}, 10, 10, true)
+		Expect(execute).Should(Equal([]deferralCandidate{late}))
+		Expect(hold).Should(HaveLen(1))
+	})
+
+	It("should release the held actions once there are enough of them", func() {
+		policy := DeferralPolicy{MaxCostRatio: 1, MinBatchSize: 3}
+		candidates := []deferralCandidate{candidate(redeem, 1, 100), candidate(refund, 1, 100)}
+		execute, hold := policy.split(candidates, 10, 10, false)
+		Expect(execute).Should(BeEmpty())
+		Expect(hold).Should(HaveLen(2))
+
+		candidates = append(candidates, candidate(redeem, 1, 100))
+		execute, hold = policy.split(candidates, 10, 10, false)
+		Expect(execute).Should(HaveLen(3))
+		Expect(hold).Should(BeEmpty())
+	})
+})
@@ -5,7 +5,9 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"math/big"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/catalogfi/cobi/pkg/swap"
@@ -14,7 +16,6 @@ import (
 	"github.com/catalogfi/ob/model"
 	"github.com/catalogfi/ob/rest"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"go.uber.org/zap"
 )
 
@@ -26,29 +27,59 @@ func (re RetriableError) Error() string {
 	return re.Err.Error()
 }
 
+func (re RetriableError) Unwrap() error {
+	return re.Err
+}
+
 func NewRetriableError(err error) error {
 	return RetriableError{err}
 }
 
+// EvmOptions contains the optional settings of the EvmExecutor.
+type EvmOptions struct {
+	Confirmations  map[model.Chain]uint64        // confirmations required for a tx or a swap state to be final, default to 1
+	BlockTimes     map[model.Chain]time.Duration // average block time of the chain, used to poll receipts, default to DefaultBlockTime
+	ReceiptTimeout time.Duration                 // how long to wait for a tx to be confirmed before retrying, default to DefaultReceiptTimeout
+	Workers        int                           // number of actions executed in parallel on each chain, default to DefaultEvmWorkers
+
+	BatchWindows map[model.Chain]time.Duration // gather actions over the window and submit them in a single tx, 0 disables batching
+	MaxBatchSize int                           // maximum number of actions in a batch tx, default to DefaultMaxEvmBatchSize
+
+	Heights   map[model.Chain]ethswap.Height   // height the HTLC timelocks are measured in, default to ethswap.DefaultHeight of the chain
+	Indexers  map[model.Chain]*ethswap.Indexer // optional HTLC event indexers to check the swaps locally
+	WSClients map[model.Chain]ethswap.Backend  // optional websocket clients to subscribe to the HTLC events, polled otherwise
+}
+
+// DefaultBlockTime is the default interval to poll the receipts of our txs.
+var DefaultBlockTime = 15 * time.Second
+
+// DefaultEvmWorkers is the default number of actions executed in parallel on each chain.
+var DefaultEvmWorkers = 4
+
 type EvmExecutor struct {
 	logger  *zap.Logger
-	wallets map[model.Chain]ethswap.Wallet
-	clients map[model.Chain]*ethclient.Client
+	wallets ethswap.Wallets
+	clients map[model.Chain]ethswap.Backend
 	storage Store
 	dialer  util.WsClientDialer
 	signer  string
+	opts    EvmOptions
 
-	swaps map[model.Chain]chan ActionItem
-	quit  chan struct{}
+	swaps     map[model.Chain]chan ActionItem
+	inflight  map[string]struct{}    // actions being executed or waiting for confirmations
+	watched   map[string]model.Order // filled orders keyed by their swaps on our HTLC contracts
+	decisions map[string]decision    // recent actions considered done, re-checked after reorgs
+	mu        *sync.Mutex
+	quit      chan struct{}
 }
 
-func NewEvmExecutor(logger *zap.Logger, wallets map[model.Chain]ethswap.Wallet, clients map[model.Chain]*ethclient.Client, storage Store, dialer util.WsClientDialer) *EvmExecutor {
+func NewEvmExecutor(logger *zap.Logger, wallets ethswap.Wallets, clients map[model.Chain]ethswap.Backend, storage Store, dialer util.WsClientDialer, opts EvmOptions) *EvmExecutor {
 	// Signer should be the same as the eth wallet address. We assume all evm wallets have the same address.
 	signer := ""
 	swaps := map[model.Chain]chan ActionItem{}
-	for chain, wallet := range wallets {
+	for key, wallet := range wallets {
 		signer = strings.ToLower(wallet.Address().Hex())
-		swaps[chain] = make(chan ActionItem, 16)
+		swaps[key.Chain] = make(chan ActionItem, 16)
 	}
 
 	return &EvmExecutor{
@@ -58,18 +89,39 @@ func NewEvmExecutor(logger *zap.Logger, wallets map[model.Chain]ethswap.Wallet,
 		storage: storage,
 		dialer:  dialer,
 		signer:  signer,
+		opts:    opts,
 
-		swaps: swaps,
-		quit:  make(chan struct{}),
+		swaps:     swaps,
+		inflight:  map[string]struct{}{},
+		watched:   map[string]model.Order{},
+		decisions: map[string]decision{},
+		mu:        new(sync.Mutex),
+		quit:      make(chan struct{}),
 	}
 }
 
 func (ee *EvmExecutor) Start() {
-	// Spin up a worker for each of the evm chain to execute swaps
+	// Spin up workers for each of the evm chain to execute swaps
+	workers := ee.opts.Workers
+	if workers <= 0 {
+		workers = DefaultEvmWorkers
+	}
 	for chain, swaps := range ee.swaps {
 		chain := chain
 		swaps := swaps
-		go ee.chainWorker(chain, swaps)
+		if window := ee.opts.BatchWindows[chain]; window > 0 {
+			go ee.batchWorker(chain, swaps, window)
+		} else {
+			for i := 0; i < workers; i++ {
+				go ee.chainWorker(chain, swaps)
+			}
+		}
+		go ee.replaceWorker(chain, ee.quit)
+		go ee.watchWorker(chain, ee.quit)
+		go ee.reorgWorker(chain, ee.quit)
+	}
+	for chain, indexer := range ee.opts.Indexers {
+		go ee.indexWorker(chain, indexer, ee.quit)
 	}
 
 	go func() {
@@ -120,15 +172,19 @@ func (ee *EvmExecutor) Stop() {
 }
 
 func (ee *EvmExecutor) processOrder(order model.Order) error {
-	if order.Status == model.Filled {
+	// Follow the htlc events of the swaps we're the taker of, until the order is no longer filled
+	if order.Taker == ee.signer && order.InitiatorAtomicSwap != nil && order.FollowerAtomicSwap != nil {
 		order.FollowerAtomicSwap.SecretHash = order.SecretHash  // this is not populated by the orderbook
 		order.InitiatorAtomicSwap.SecretHash = order.SecretHash // this is not populated by the orderbook
+		ee.watch(order)
+	}
 
+	if order.Status == model.Filled {
 		// We're the taker
 		if order.Taker == ee.signer {
 			if order.InitiatorAtomicSwap.Status == model.Initiated &&
 				order.FollowerAtomicSwap.Status == model.NotStarted {
-				ee.execute(swap.ActionInitiate, order.FollowerAtomicSwap)
+				ee.execute(swap.ActionInitiate, order.FollowerAtomicSwap, order.InitiatorAtomicSwap)
 			} else if order.InitiatorAtomicSwap.Status == model.Initiated &&
 				(order.FollowerAtomicSwap.Status == model.Redeemed ||
 					order.FollowerAtomicSwap.Status == model.RedeemDetected) {
@@ -136,94 +192,333 @@ func (ee *EvmExecutor) processOrder(order model.Order) error {
 					return fmt.Errorf("missing secret")
 				}
 				order.InitiatorAtomicSwap.Secret = order.FollowerAtomicSwap.Secret
-				ee.execute(swap.ActionRedeem, order.InitiatorAtomicSwap)
+				ee.execute(swap.ActionRedeem, order.InitiatorAtomicSwap, nil)
 			} else if order.FollowerAtomicSwap.Status == model.Expired {
-				ee.execute(swap.ActionRefund, order.FollowerAtomicSwap)
+				ee.execute(swap.ActionRefund, order.FollowerAtomicSwap, nil)
 			}
 		}
 	}
 	return nil
 }
 
-func (ee *EvmExecutor) execute(action swap.Action, atomicSwap *model.AtomicSwap) {
+// execute queues the action of the swap. The action waits for the funding swap to be initiated with the required
+// confirmations if it's not nil.
+func (ee *EvmExecutor) execute(action swap.Action, atomicSwap, funding *model.AtomicSwap) {
 	swapChain, ok := ee.swaps[atomicSwap.Chain]
 	if !ok {
 		// Skip execution since the chain is not supported
 		return
 	}
+	if _, ok := ee.wallets.Asset(atomicSwap.Chain, atomicSwap.Asset); !ok {
+		// Skip execution since we don't have a wallet for the HTLC contract
+		ee.logger.Warn("no wallet for the swap contract", zap.String("chain", string(atomicSwap.Chain)), zap.String("asset", string(atomicSwap.Asset)), zap.Uint("swap", atomicSwap.ID))
+		return
+	}
 
 	swapChain <- ActionItem{
-		Action: action,
-		Swap:   atomicSwap,
+		Action:  action,
+		Swap:    atomicSwap,
+		Funding: funding,
+	}
+}
+
+// replaceWorker periodically replaces the txs of the chain which are stuck in the mempool.
+func (ee *EvmExecutor) replaceWorker(chain model.Chain, quit chan struct{}) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	keys := ee.wallets.Keys(chain)
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			for _, key := range keys {
+				txs, err := ee.wallets[key].ReplaceStuck(ctx)
+				for _, tx := range txs {
+					ee.logger.Info("⏫ [Replacement]", zap.String("chain", string(chain)), zap.String("hash", tx.Hash().Hex()), zap.Uint64("nonce", tx.Nonce()))
+				}
+				if err != nil {
+					ee.logger.Error("replace stuck txs", zap.String("wallet", key.String()), zap.Error(err))
+				}
+			}
+
+			// Fill the nonce gaps left by the txs which failed to send, the nonces are shared by the wallets of the
+			// chain so we only need to do it once.
+			txs, err := ee.wallets[keys[0]].FillGaps(ctx)
+			cancel()
+			for _, tx := range txs {
+				ee.logger.Warn("🕳️ [Nonce Gap] filled", zap.String("chain", string(chain)), zap.String("hash", tx.Hash().Hex()), zap.Uint64("nonce", tx.Nonce()))
+			}
+			if err != nil {
+				ee.logger.Error("fill nonce gaps", zap.String("chain", string(chain)), zap.Error(err))
+			}
+		case <-quit:
+			return
+		}
+	}
+}
+
+// indexWorker keeps the HTLC event indexer of the chain in sync.
+func (ee *EvmExecutor) indexWorker(chain model.Chain, indexer *ethswap.Indexer, quit chan struct{}) {
+	interval := ee.opts.BlockTimes[chain]
+	if interval <= 0 {
+		interval = DefaultBlockTime
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		reorged, err := indexer.Sync(ctx)
+		cancel()
+		if reorged {
+			ee.logger.Warn("🔀 [Reorg] re-indexing htlc events", zap.String("chain", string(chain)))
+		}
+		if err != nil {
+			ee.logger.Error("index htlc events", zap.String("chain", string(chain)), zap.Error(err))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// height returns the height the HTLC timelocks on the chain are measured in.
+func (ee *EvmExecutor) height(chain model.Chain) ethswap.Height {
+	if height := ee.opts.Heights[chain]; height != "" {
+		return height
+	}
+	return ethswap.DefaultHeight(chain, ethswap.RollupNone)
+}
+
+// indexedStatus returns the status of the swap seen by the indexer of the chain at the block, empty if unknown. A nil
+// block means the latest indexed status.
+func (ee *EvmExecutor) indexedStatus(chain model.Chain, ethSwap ethswap.Swap, block *big.Int) string {
+	indexer, ok := ee.opts.Indexers[chain]
+	if !ok {
+		return ""
+	}
+	var status string
+	var err error
+	if block == nil {
+		status, err = indexer.Status(ethSwap)
+	} else {
+		status, err = indexer.StatusAt(ethSwap, block.Uint64())
 	}
+	if err != nil {
+		ee.logger.Error("check indexed status", zap.String("chain", string(chain)), zap.Error(err))
+		return ""
+	}
+	return status
+}
+
+// acquire marks the action as in flight, it returns false if it's already in flight.
+func (ee *EvmExecutor) acquire(item ActionItem) bool {
+	ee.mu.Lock()
+	defer ee.mu.Unlock()
+
+	key := fmt.Sprintf("%v-%v", item.Action, item.Swap.ID)
+	if _, ok := ee.inflight[key]; ok {
+		return false
+	}
+	ee.inflight[key] = struct{}{}
+	return true
+}
+
+func (ee *EvmExecutor) release(item ActionItem) {
+	ee.mu.Lock()
+	defer ee.mu.Unlock()
+
+	delete(ee.inflight, fmt.Sprintf("%v-%v", item.Action, item.Swap.ID))
 }
 
 func (ee *EvmExecutor) chainWorker(chain model.Chain, swaps chan ActionItem) {
 	for item := range swaps {
-		ethSwap, err := ethswap.FromAtomicSwap(item.Swap)
-		if err != nil {
-			ee.logger.Error("parse swap", zap.Error(err))
+		// Skip if the same action is being executed by another worker
+		if !ee.acquire(item) {
 			continue
 		}
 
 		// Execute the swap action
-		err = func() error {
+		tracked := false
+		err := func() error {
 			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 			defer cancel()
 
-			wallet := ee.wallets[chain]
-			client := ee.clients[chain]
-			var transaction *types.Transaction
-			switch item.Action {
-			case swap.ActionInitiate:
-				var initiated bool
-				initiated, err = ethSwap.Initiated(ctx, client)
-				if err != nil {
-					return NewRetriableError(err)
-				}
-				if initiated {
-					ee.logger.Debug("⚠️ skip swap initiation", zap.String("chain", string(chain)), zap.Uint("swap", item.Swap.ID))
-					return nil
-				}
-				transaction, err = wallet.Initiate(ctx, ethSwap)
-			case swap.ActionRedeem:
-				var secret []byte
-				secret, err = hex.DecodeString(item.Swap.Secret)
-				if err != nil {
-					return err
-				}
-				transaction, err = wallet.Redeem(ctx, ethSwap, secret)
-			case swap.ActionRefund:
-				var expired bool
-				expired, err = ethSwap.Expired(ctx, wallet.Client())
-				if err != nil {
-					return NewRetriableError(err)
-				}
-				if !expired {
-					return NewRetriableError(fmt.Errorf("swap not expired"))
-				}
-				transaction, err = wallet.Refund(ctx, ethSwap)
-			default:
-				return nil
+			call, skip, err := ee.prepare(ctx, chain, item)
+			if err != nil || skip {
+				return err
 			}
+			transaction, err := ee.submit(ctx, chain, call)
 			if err != nil {
 				return NewRetriableError(err)
 			}
 
-			ee.logger.Info("✅ [Execution]", zap.String("chain", string(chain)), zap.String("hash", transaction.Hash().Hex()), zap.Uint("swap", item.Swap.ID))
+			// Track the tx until it's confirmed
+			ee.logger.Info("📤 [Submitted]", zap.String("chain", string(chain)), zap.String("hash", transaction.Hash().Hex()), zap.Uint("swap", item.Swap.ID))
+			tracked = true
+			go ee.track(chain, item, transaction, swaps)
 			return nil
 		}()
+		if !tracked {
+			ee.release(item)
+		}
+		if err != nil {
+			ee.failed(chain, item, err, swaps)
+		}
+	}
+}
+
+// prepare checks if the action still needs to be executed and converts it to a call of the wallet.
+func (ee *EvmExecutor) prepare(ctx context.Context, chain model.Chain, item ActionItem) (ethswap.Call, bool, error) {
+	ethSwap, err := ethswap.FromAtomicSwap(item.Swap)
+	if err != nil {
+		return ethswap.Call{}, false, err
+	}
+	call := ethswap.Call{
+		Action: item.Action,
+		Swap:   ethSwap,
+	}
+
+	if _, ok := ee.wallets.Get(chain, ethSwap.Contract); !ok {
+		return call, false, fmt.Errorf("no wallet for the swap contract %v", ethSwap.Contract.Hex())
+	}
+	client := ee.clients[chain]
+
+	// Swap states are only trusted once they have the required confirmations, so a reorg can't make us skip an action
+	// which is still needed.
+	confirmed, err := ee.confirmedBlock(ctx, chain)
+	if err != nil {
+		return call, false, NewRetriableError(err)
+	}
 
+	// The indexer only tells us about the events it has seen, the chain is checked if it hasn't seen the one we want.
+	status := ee.indexedStatus(chain, ethSwap, confirmed)
+	switch item.Action {
+	case swap.ActionInitiate:
+		funded, err := ee.funded(ctx, item.Funding)
 		if err != nil {
-			// Retry after 30 seconds if it's a RetriableError
-			var re RetriableError
-			if errors.As(err, &re) {
-				go func(item ActionItem) {
-					time.Sleep(time.Minute)
-					swaps <- item
-				}(item)
+			return call, false, NewRetriableError(err)
+		}
+		if !funded {
+			return call, false, NewRetriableError(fmt.Errorf("counterparty initiation not confirmed"))
+		}
+		if status != "" {
+			ee.logger.Debug("⚠️ skip swap initiation", zap.String("chain", string(chain)), zap.Uint("swap", item.Swap.ID), zap.String("indexed", status))
+			ee.decide(item)
+			return call, true, nil
+		}
+		initiated, err := ethSwap.InitiatedAt(ctx, client, confirmed)
+		if err != nil {
+			return call, false, NewRetriableError(err)
+		}
+		if initiated {
+			ee.logger.Debug("⚠️ skip swap initiation", zap.String("chain", string(chain)), zap.Uint("swap", item.Swap.ID))
+			ee.decide(item)
+			return call, true, nil
+		}
+		if confirmed != nil {
+			if initiated, err = ethSwap.Initiated(ctx, client); err != nil {
+				return call, false, NewRetriableError(err)
 			}
-			ee.logger.Error("❌ [Execution]", zap.String("chain", string(chain)), zap.Error(err), zap.Uint("swap", item.Swap.ID), zap.String("action", string(item.Action)))
+			if initiated {
+				return call, false, NewRetriableError(fmt.Errorf("initiation not confirmed yet"))
+			}
+		}
+	case swap.ActionRedeem:
+		if status == ethswap.EventRedeemed || status == ethswap.EventRefunded {
+			ee.logger.Debug("⚠️ skip swap redeem", zap.String("chain", string(chain)), zap.Uint("swap", item.Swap.ID), zap.String("indexed", status))
+			ee.decide(item)
+			return call, true, nil
+		}
+		redeemed, err := ethSwap.RedeemedAt(ctx, client, confirmed)
+		if err != nil {
+			return call, false, NewRetriableError(err)
+		}
+		if redeemed {
+			ee.logger.Debug("⚠️ skip swap redeem", zap.String("chain", string(chain)), zap.Uint("swap", item.Swap.ID))
+			ee.decide(item)
+			return call, true, nil
+		}
+		if confirmed != nil {
+			if redeemed, err = ethSwap.Redeemed(ctx, client); err != nil {
+				return call, false, NewRetriableError(err)
+			}
+			if redeemed {
+				return call, false, NewRetriableError(fmt.Errorf("redeem not confirmed yet"))
+			}
+		}
+		call.Secret, err = hex.DecodeString(item.Swap.Secret)
+		if err != nil {
+			return call, false, err
+		}
+	case swap.ActionRefund:
+		if status == ethswap.EventRedeemed || status == ethswap.EventRefunded {
+			ee.logger.Debug("⚠️ skip swap refund", zap.String("chain", string(chain)), zap.Uint("swap", item.Swap.ID), zap.String("indexed", status))
+			return call, true, nil
+		}
+		// The contract checks the expiry against the block the refund is mined in, so the latest block is what matters
+		expired, err := ethSwap.Expired(ctx, client, ee.height(chain))
+		if err != nil {
+			return call, false, NewRetriableError(err)
+		}
+		if !expired {
+			return call, false, NewRetriableError(fmt.Errorf("swap not expired"))
 		}
+	default:
+		return call, true, nil
+	}
+	return call, false, nil
+}
+
+// submit sends a tx for a single call.
+func (ee *EvmExecutor) submit(ctx context.Context, chain model.Chain, call ethswap.Call) (*types.Transaction, error) {
+	wallet, ok := ee.wallets.Get(chain, call.Swap.Contract)
+	if !ok {
+		return nil, fmt.Errorf("no wallet for the swap contract %v", call.Swap.Contract.Hex())
+	}
+	switch call.Action {
+	case swap.ActionInitiate:
+		return wallet.Initiate(ctx, call.Swap)
+	case swap.ActionRedeem:
+		return wallet.Redeem(ctx, call.Swap, call.Secret)
+	case swap.ActionRefund:
+		return wallet.Refund(ctx, call.Swap)
+	default:
+		return nil, fmt.Errorf("unknown action = %v", call.Action)
+	}
+}
+
+// failed logs the error of an action and retries it after a minute if it's a RetriableError. Actions whose simulation
+// reverted are handled like reverted txs.
+func (ee *EvmExecutor) failed(chain model.Chain, item ActionItem, err error, swaps chan ActionItem) {
+	// Txs which would revert are not sent, the reason decides if the action is retried like a reverted tx
+	var revertErr *ethswap.RevertError
+	if errors.As(err, &revertErr) {
+		fields := []zap.Field{
+			zap.String("chain", string(chain)),
+			zap.Uint("swap", item.Swap.ID),
+			zap.String("action", string(item.Action)),
+			zap.String("reason", revertErr.Reason),
+		}
+		switch revertOutcome(revertErr.Reason) {
+		case TxRetry:
+			ee.logger.Warn("🔁 [Simulation] would revert, retrying", fields...)
+			ee.retry(swaps, item)
+		case TxDropped:
+			ee.logger.Warn("🗑️ [Simulation] would revert, dropped", fields...)
+		default:
+			ee.logger.Error("🚨 [Simulation] would revert", fields...)
+		}
+		return
+	}
+
+	var re RetriableError
+	if errors.As(err, &re) {
+		ee.retry(swaps, item)
 	}
+	ee.logger.Error("❌ [Execution]", zap.String("chain", string(chain)), zap.Error(err), zap.Uint("swap", item.Swap.ID), zap.String("action", string(item.Action)))
 }
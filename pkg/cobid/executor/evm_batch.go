@@ -0,0 +1,148 @@
+package executor
+
+import (
+	"context"
+	"time"
+
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
+	"github.com/catalogfi/ob/model"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.uber.org/zap"
+)
+
+// DefaultMaxEvmBatchSize is the default maximum number of actions in a batch tx.
+var DefaultMaxEvmBatchSize = 20
+
+// batchWorker gathers the actions of the chain over the batch window and submits them in a single tx.
+func (ee *EvmExecutor) batchWorker(chain model.Chain, swaps chan ActionItem, window time.Duration) {
+	maxSize := ee.opts.MaxBatchSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxEvmBatchSize
+	}
+
+	for item := range swaps {
+		items := []ActionItem{item}
+		timer := time.NewTimer(window)
+	Collect:
+		for len(items) < maxSize {
+			select {
+			case item, ok := <-swaps:
+				if !ok {
+					break Collect
+				}
+				items = append(items, item)
+			case <-timer.C:
+				break Collect
+			}
+		}
+		timer.Stop()
+
+		ee.submitBatch(chain, items, swaps)
+	}
+}
+
+// submitBatch submits the actions which still need to be executed, in one tx for each HTLC contract. A single action, or
+// an action the wallet can't batch, is sent as a normal tx.
+func (ee *EvmExecutor) submitBatch(chain model.Chain, items []ActionItem, swaps chan ActionItem) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	contracts := []common.Address{}
+	batched := map[common.Address][]ActionItem{}
+	calls := map[common.Address][]ethswap.Call{}
+	for _, item := range items {
+		if !ee.acquire(item) {
+			continue
+		}
+		call, skip, err := ee.prepare(ctx, chain, item)
+		if err != nil || skip {
+			ee.release(item)
+			if err != nil {
+				ee.failed(chain, item, err, swaps)
+			}
+			continue
+		}
+		contract := call.Swap.Contract
+		if wallet, _ := ee.wallets.Get(chain, contract); !wallet.Batchable(call.Action) {
+			ee.submitContractBatch(ctx, chain, contract, []ActionItem{item}, []ethswap.Call{call}, swaps)
+			continue
+		}
+		if _, ok := batched[contract]; !ok {
+			contracts = append(contracts, contract)
+		}
+		batched[contract] = append(batched[contract], item)
+		calls[contract] = append(calls[contract], call)
+	}
+
+	for _, contract := range contracts {
+		ee.submitContractBatch(ctx, chain, contract, batched[contract], calls[contract], swaps)
+	}
+}
+
+// submitContractBatch submits the calls to the same HTLC contract in a single tx.
+func (ee *EvmExecutor) submitContractBatch(ctx context.Context, chain model.Chain, contract common.Address, batched []ActionItem, calls []ethswap.Call, swaps chan ActionItem) {
+	var tx *types.Transaction
+	var err error
+	if len(calls) == 1 {
+		tx, err = ee.submit(ctx, chain, calls[0])
+	} else {
+		wallet, _ := ee.wallets.Get(chain, contract)
+		tx, err = wallet.BatchExecute(ctx, calls)
+	}
+	if err != nil {
+		for _, item := range batched {
+			ee.release(item)
+			ee.failed(chain, item, NewRetriableError(err), swaps)
+		}
+		return
+	}
+
+	ee.logger.Info("📤 [Submitted]", zap.String("chain", string(chain)), zap.String("hash", tx.Hash().Hex()), zap.Int("actions", len(calls)))
+	if len(calls) == 1 {
+		go ee.track(chain, batched[0], tx, swaps)
+	} else {
+		go ee.trackBatch(chain, batched, calls, tx, swaps)
+	}
+}
+
+// trackBatch waits for the batch tx to be confirmed and handles the outcome of each call separately.
+func (ee *EvmExecutor) trackBatch(chain model.Chain, items []ActionItem, calls []ethswap.Call, tx *types.Transaction, swaps chan ActionItem) {
+	result, receipt := ee.waitReceipt(chain, tx)
+	for _, item := range items {
+		ee.release(item)
+	}
+	if result.Outcome == "" {
+		// Stopped before we know the result
+		return
+	}
+
+	wallet, _ := ee.wallets.Get(chain, calls[0].Swap.Contract)
+	for i, item := range items {
+		callResult := result
+		if receipt != nil {
+			callResult.Outcome, callResult.Reason = ee.callOutcome(wallet, receipt, calls[i])
+		}
+		ee.handleResult(item, callResult, swaps)
+	}
+}
+
+// callOutcome checks the result of a call in a confirmed batch tx.
+func (ee *EvmExecutor) callOutcome(wallet ethswap.Wallet, receipt *types.Receipt, call ethswap.Call) (string, string) {
+	succeeded, err := ethswap.CallSucceeded(receipt, call.Swap.Contract, call)
+	if err != nil {
+		ee.logger.Error("check call result", zap.String("hash", receipt.TxHash.Hex()), zap.Error(err))
+		return TxRetry, err.Error()
+	}
+	if succeeded {
+		return TxConfirmed, ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	reason, err := wallet.CallRevertReason(ctx, call, receipt.BlockNumber)
+	if err != nil {
+		ee.logger.Error("decode revert", zap.String("hash", receipt.TxHash.Hex()), zap.Error(err))
+	}
+	return revertOutcome(reason), reason
+}
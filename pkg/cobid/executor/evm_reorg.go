@@ -0,0 +1,159 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
+	"github.com/catalogfi/ob/model"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.uber.org/zap"
+)
+
+// DefaultReorgWindow is how long our decisions are kept for, so they can be re-checked after a reorg.
+var DefaultReorgWindow = 30 * time.Minute
+
+// decision is an action we've considered done, either because our tx got confirmed or because the swap was already in
+// the state the action leads to.
+type decision struct {
+	item      ActionItem
+	decidedAt time.Time
+}
+
+// confirmedBlock returns the latest block of the chain with the required confirmations, nil means the latest block.
+func (ee *EvmExecutor) confirmedBlock(ctx context.Context, chain model.Chain) (*big.Int, error) {
+	return ethswap.ConfirmedBlock(ctx, ee.clients[chain], ee.opts.Confirmations[chain])
+}
+
+// decide records the action as done, so it can be re-checked if the chain of the swap or the counterparty's swap
+// reorgs.
+func (ee *EvmExecutor) decide(item ActionItem) {
+	ee.mu.Lock()
+	defer ee.mu.Unlock()
+
+	for key, d := range ee.decisions {
+		if time.Since(d.decidedAt) > DefaultReorgWindow {
+			delete(ee.decisions, key)
+		}
+	}
+	ee.decisions[fmt.Sprintf("%v-%v", item.Action, item.Swap.ID)] = decision{item: item, decidedAt: time.Now()}
+}
+
+// funded checks if the counterparty's swap has been initiated with the required confirmations. Swaps which are not on
+// our evm chains are trusted as reported by the orderbook.
+func (ee *EvmExecutor) funded(ctx context.Context, atomicSwap *model.AtomicSwap) (bool, error) {
+	if atomicSwap == nil || !atomicSwap.Chain.IsEVM() {
+		return true, nil
+	}
+	client, ok := ee.clients[atomicSwap.Chain]
+	if !ok {
+		return true, nil
+	}
+	ethSwap, err := ethswap.FromAtomicSwap(atomicSwap)
+	if err != nil {
+		return false, err
+	}
+	block, err := ee.confirmedBlock(ctx, atomicSwap.Chain)
+	if err != nil {
+		return false, err
+	}
+	return ethSwap.InitiatedAt(ctx, client, block)
+}
+
+// reorgWorker watches the head of the chain, and re-checks the decisions made on the blocks which are no longer
+// canonical after a reorg.
+func (ee *EvmExecutor) reorgWorker(chain model.Chain, quit chan struct{}) {
+	blockTime := ee.opts.BlockTimes[chain]
+	if blockTime <= 0 {
+		blockTime = DefaultBlockTime
+	}
+	ticker := time.NewTicker(blockTime)
+	defer ticker.Stop()
+
+	client := ee.clients[chain]
+	var last *types.Header
+	for {
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		head, reorged, err := checkHead(ctx, client, last)
+		if err != nil {
+			ee.logger.Error("check reorg", zap.String("chain", string(chain)), zap.Error(err))
+		} else if reorged {
+			ee.logger.Warn("🔀 [Reorg] re-checking our decisions", zap.String("chain", string(chain)), zap.Uint64("head", head.Number.Uint64()))
+			ee.recheck(ctx, chain)
+		}
+		last = head
+		cancel()
+	}
+}
+
+// checkHead tells if the block we saw as the head is no longer canonical, and returns the head to check against next
+// time. The child of the block we saw should point to it, or the block should still be the head. A provider which is
+// behind the block we saw, or doesn't have its child yet, tells nothing about a reorg and we check again later.
+func checkHead(ctx context.Context, client ethswap.Backend, last *types.Header) (*types.Header, bool, error) {
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return last, false, err
+	}
+	if last == nil {
+		return head, false, nil
+	}
+
+	number := last.Number.Uint64()
+	switch {
+	case head.Number.Uint64() < number:
+		return last, false, nil
+	case head.Number.Uint64() == number:
+		return head, head.Hash() != last.Hash(), nil
+	default:
+		child, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(number+1))
+		if err != nil {
+			if errors.Is(err, ethereum.NotFound) {
+				err = nil
+			}
+			return last, false, err
+		}
+		return head, child.ParentHash != last.Hash(), nil
+	}
+}
+
+// recheck re-executes the recent decisions affected by a reorg of the chain, the actions are skipped again if the swaps
+// are still in the states we've seen. It alerts if a counterparty initiation we've acted on is gone.
+func (ee *EvmExecutor) recheck(ctx context.Context, chain model.Chain) {
+	ee.mu.Lock()
+	decisions := []decision{}
+	for key, d := range ee.decisions {
+		if d.item.Swap.Chain == chain || (d.item.Funding != nil && d.item.Funding.Chain == chain) {
+			decisions = append(decisions, d)
+			delete(ee.decisions, key)
+		}
+	}
+	ee.mu.Unlock()
+
+	for _, d := range decisions {
+		if d.item.Funding != nil && d.item.Funding.Chain == chain {
+			funded, err := ee.funded(ctx, d.item.Funding)
+			if err != nil {
+				ee.logger.Error("re-check counterparty initiation", zap.Uint("swap", d.item.Funding.ID), zap.Error(err))
+			} else if !funded {
+				ee.logger.Error("🔀 [Reorg] counterparty initiation is gone", zap.String("chain", string(chain)), zap.Uint("swap", d.item.Swap.ID), zap.Uint("counterparty", d.item.Funding.ID))
+			}
+		}
+		// Don't block the reorg worker if the executor is busy
+		swaps := ee.swaps[d.item.Swap.Chain]
+		select {
+		case swaps <- d.item:
+		default:
+			ee.retry(swaps, d.item)
+		}
+	}
+}
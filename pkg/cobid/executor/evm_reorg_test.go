@@ -0,0 +1,129 @@
+package executor
+
+import (
+	"context"
+	"math/big"
+	"sync"
+
+	"github.com/catalogfi/cobi/pkg/swap"
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
+	"github.com/catalogfi/ob/model"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.uber.org/zap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// headerBackend serves a chain of headers, the blocks after forkBlock are on the fork we set.
+type headerBackend struct {
+	ethswap.Backend
+	head      uint64
+	fork      byte
+	forkBlock uint64
+	missing   map[uint64]bool // blocks the provider doesn't have
+}
+
+func (backend *headerBackend) header(number uint64) *types.Header {
+	header := &types.Header{Number: new(big.Int).SetUint64(number)}
+	if number > 0 {
+		header.ParentHash = backend.header(number - 1).Hash()
+	}
+	if number >= backend.forkBlock {
+		header.Extra = []byte{backend.fork}
+	}
+	return header
+}
+
+func (backend *headerBackend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if number == nil {
+		return backend.header(backend.head), nil
+	}
+	if number.Uint64() > backend.head || backend.missing[number.Uint64()] {
+		return nil, ethereum.NotFound
+	}
+	return backend.header(number.Uint64()), nil
+}
+
+var _ = Describe("Evm reorgs", func() {
+	var backend *headerBackend
+	var last *types.Header
+	BeforeEach(func(ctx context.Context) {
+		backend = &headerBackend{head: 10, forkBlock: 1e9, missing: map[uint64]bool{}}
+		var err error
+		last, _, err = checkHead(ctx, backend, nil)
+		Expect(err).Should(BeNil())
+		Expect(last.Number.Uint64()).Should(Equal(uint64(10)))
+	})
+
+	It("should not report a reorg while the chain grows", func(ctx context.Context) {
+		backend.head = 15
+		head, reorged, err := checkHead(ctx, backend, last)
+		Expect(err).Should(BeNil())
+		Expect(reorged).Should(BeFalse())
+		Expect(head.Number.Uint64()).Should(Equal(uint64(15)))
+	})
+
+	It("should report a reorg of the block we saw", func(ctx context.Context) {
+		backend.fork, backend.forkBlock = 1, 10
+		_, reorged, err := checkHead(ctx, backend, last)
+		Expect(err).Should(BeNil())
+		Expect(reorged).Should(BeTrue())
+
+		backend.head = 12
+		_, reorged, err = checkHead(ctx, backend, last)
+		Expect(err).Should(BeNil())
+		Expect(reorged).Should(BeTrue())
+	})
+
+	It("should check again later when the provider can't tell", func(ctx context.Context) {
+		By("The provider is behind the block we saw")
+		backend.head = 8
+		head, reorged, err := checkHead(ctx, backend, last)
+		Expect(err).Should(BeNil())
+		Expect(reorged).Should(BeFalse())
+		Expect(head).Should(Equal(last))
+
+		By("The provider doesn't have the child of the block we saw")
+		backend.head = 12
+		backend.missing[11] = true
+		head, reorged, err = checkHead(ctx, backend, last)
+		Expect(err).Should(BeNil())
+		Expect(reorged).Should(BeFalse())
+		Expect(head).Should(Equal(last))
+
+		By("The reorg is still caught once the provider catches up")
+		delete(backend.missing, 11)
+		backend.fork, backend.forkBlock = 1, 9
+		_, reorged, err = checkHead(ctx, backend, last)
+		Expect(err).Should(BeNil())
+		Expect(reorged).Should(BeTrue())
+	})
+
+	It("should re-queue the decisions without blocking", func(ctx context.Context) {
+		chain := model.EthereumLocalnet
+		ee := &EvmExecutor{
+			logger:    zap.NewNop(),
+			swaps:     map[model.Chain]chan ActionItem{chain: make(chan ActionItem, 1)},
+			decisions: map[string]decision{},
+			mu:        new(sync.Mutex),
+		}
+		for id := uint(1); id <= 3; id++ {
+			atomicSwap := &model.AtomicSwap{Chain: chain, Asset: model.Asset(common.HexToAddress("0xA").Hex())}
+			atomicSwap.ID = id
+			ee.decide(ActionItem{Action: swap.ActionRedeem, Swap: atomicSwap})
+		}
+
+		// The queue only has room for one of them, the others are retried later
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			ee.recheck(ctx, chain)
+		}()
+		Eventually(done).Should(BeClosed())
+		Expect(ee.swaps[chain]).Should(HaveLen(1))
+		Expect(ee.decisions).Should(BeEmpty())
+	})
+})
@@ -0,0 +1,270 @@
+package executor
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/catalogfi/cobi/pkg/swap"
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
+	"github.com/catalogfi/ob/model"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.uber.org/zap"
+)
+
+// DefaultResubscribeDelay is how long we poll the HTLC events before subscribing again after the subscription fails.
+var DefaultResubscribeDelay = time.Minute
+
+// watchKey identifies a swap on the HTLC contract of a chain.
+func watchKey(chain model.Chain, contract common.Address, orderID common.Hash) string {
+	return fmt.Sprintf("%v-%v-%v", chain, strings.ToLower(contract.Hex()), orderID.Hex())
+}
+
+// watch keeps the filled orders we have swaps on our evm chains in, so we can react to the HTLC events of their swaps.
+// Orders which are no longer filled are forgotten.
+func (ee *EvmExecutor) watch(order model.Order) {
+	ee.mu.Lock()
+	defer ee.mu.Unlock()
+
+	for _, atomicSwap := range []*model.AtomicSwap{order.InitiatorAtomicSwap, order.FollowerAtomicSwap} {
+		if atomicSwap == nil || !atomicSwap.Chain.IsEVM() {
+			continue
+		}
+		if _, ok := ee.wallets.Asset(atomicSwap.Chain, atomicSwap.Asset); !ok {
+			continue
+		}
+		ethSwap, err := ethswap.FromAtomicSwap(atomicSwap)
+		if err != nil {
+			continue
+		}
+		key := watchKey(atomicSwap.Chain, ethSwap.Contract, ethSwap.ID)
+		if order.Status == model.Filled {
+			ee.watched[key] = order
+		} else {
+			delete(ee.watched, key)
+		}
+	}
+}
+
+// watchedOrder returns the order which has a swap with the given id on the HTLC contract.
+func (ee *EvmExecutor) watchedOrder(chain model.Chain, contract common.Address, orderID common.Hash) (model.Order, bool) {
+	ee.mu.Lock()
+	defer ee.mu.Unlock()
+
+	order, ok := ee.watched[watchKey(chain, contract, orderID)]
+	return order, ok
+}
+
+// watchWorker follows the events of our HTLC contracts on the chain. It subscribes to the logs when we have a websocket
+// client of the chain, and polls them otherwise or when the subscription fails.
+func (ee *EvmExecutor) watchWorker(chain model.Chain, quit chan struct{}) {
+	contracts := []common.Address{}
+	for _, key := range ee.wallets.Keys(chain) {
+		contracts = append(contracts, key.Contract)
+	}
+	topics, err := ethswap.EventTopics()
+	if err != nil {
+		ee.logger.Error("htlc event topics", zap.Error(err))
+		return
+	}
+	query := ethereum.FilterQuery{
+		Addresses: contracts,
+		Topics:    [][]common.Hash{topics},
+	}
+
+	// Start from the latest block, anything before should have been reported by the orderbook.
+	var next uint64
+	for next == 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		head, err := ee.clients[chain].BlockNumber(ctx)
+		cancel()
+		if err == nil {
+			next = head + 1
+			continue
+		}
+		ee.logger.Error("get latest block", zap.String("chain", string(chain)), zap.Error(err))
+		select {
+		case <-time.After(DefaultBlockTime):
+		case <-quit:
+			return
+		}
+	}
+
+	for {
+		if wsClient, ok := ee.opts.WSClients[chain]; ok {
+			// Catch up with the blocks we missed before subscribing again
+			next = ee.pollEvents(chain, query, next)
+			next = ee.subscribeEvents(chain, wsClient.SubscribeFilterLogs, query, next, quit)
+			ee.logger.Warn("htlc event subscription dropped, polling instead", zap.String("chain", string(chain)))
+		}
+
+		// Poll the events until it's time to subscribe again
+		blockTime := ee.opts.BlockTimes[chain]
+		if blockTime <= 0 {
+			blockTime = DefaultBlockTime
+		}
+		ticker := time.NewTicker(blockTime)
+		resubscribe := time.After(DefaultResubscribeDelay)
+	Poll:
+		for {
+			next = ee.pollEvents(chain, query, next)
+			select {
+			case <-ticker.C:
+			case <-resubscribe:
+				if _, ok := ee.opts.WSClients[chain]; ok {
+					break Poll
+				}
+			case <-quit:
+				ticker.Stop()
+				return
+			}
+		}
+		ticker.Stop()
+	}
+}
+
+// subscribeFunc subscribes to the logs matching the query.
+type subscribeFunc func(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error)
+
+// subscribeEvents handles the logs pushed by the websocket rpc until the subscription fails. It returns the next block
+// to be polled.
+func (ee *EvmExecutor) subscribeEvents(chain model.Chain, subscribe subscribeFunc, query ethereum.FilterQuery, next uint64, quit chan struct{}) uint64 {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logs := make(chan types.Log, 64)
+	sub, err := subscribe(ctx, query, logs)
+	if err != nil {
+		ee.logger.Error("subscribe htlc events", zap.String("chain", string(chain)), zap.Error(err))
+		return next
+	}
+	defer sub.Unsubscribe()
+
+	ee.logger.Info("subscribed to htlc events", zap.String("chain", string(chain)))
+	for {
+		select {
+		case log := <-logs:
+			ee.handleLog(chain, log)
+			if log.BlockNumber >= next {
+				next = log.BlockNumber + 1
+			}
+		case err := <-sub.Err():
+			if err != nil {
+				ee.logger.Error("htlc event subscription", zap.String("chain", string(chain)), zap.Error(err))
+			}
+			// Re-check the last block we've seen, it might not have been fully pushed.
+			if next > 0 {
+				next--
+			}
+			return next
+		case <-quit:
+			return next
+		}
+	}
+}
+
+// pollEvents handles the logs from the next block to the latest one, and returns the next block to be polled.
+func (ee *EvmExecutor) pollEvents(chain model.Chain, query ethereum.FilterQuery, next uint64) uint64 {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	client := ee.clients[chain]
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		ee.logger.Error("get latest block", zap.String("chain", string(chain)), zap.Error(err))
+		return next
+	}
+	if head < next {
+		return next
+	}
+	query.FromBlock = new(big.Int).SetUint64(next)
+	query.ToBlock = new(big.Int).SetUint64(head)
+	logs, err := client.FilterLogs(ctx, query)
+	if err != nil {
+		ee.logger.Error("poll htlc events", zap.String("chain", string(chain)), zap.Error(err))
+		return next
+	}
+	for _, log := range logs {
+		ee.handleLog(chain, log)
+	}
+	return head + 1
+}
+
+// handleLog triggers the actions the HTLC event requires, and logs the event if the orderbook hasn't caught up with it.
+func (ee *EvmExecutor) handleLog(chain model.Chain, log types.Log) {
+	if log.Removed {
+		return
+	}
+	event, ok, err := ethswap.ParseEvent(log)
+	if err != nil {
+		ee.logger.Error("parse htlc event", zap.String("chain", string(chain)), zap.String("hash", log.TxHash.Hex()), zap.Error(err))
+		return
+	}
+	if !ok {
+		return
+	}
+	order, ok := ee.watchedOrder(chain, event.Contract, event.OrderID)
+	if !ok {
+		return
+	}
+
+	// Find out which swap of the order the event is about
+	initiatorSwap, followerSwap := *order.InitiatorAtomicSwap, *order.FollowerAtomicSwap
+	isInitiatorSwap := false
+	if initiatorSwap.Chain == chain {
+		if ethSwap, err := ethswap.FromAtomicSwap(&initiatorSwap); err == nil && ethSwap.Contract == event.Contract && common.Hash(ethSwap.ID) == event.OrderID {
+			isInitiatorSwap = true
+		}
+	}
+	atomicSwap := followerSwap
+	if isInitiatorSwap {
+		atomicSwap = initiatorSwap
+	}
+
+	fields := []zap.Field{
+		zap.String("chain", string(chain)),
+		zap.Uint("order", order.ID),
+		zap.Uint("swap", atomicSwap.ID),
+		zap.String("event", event.Kind),
+		zap.String("hash", event.TxHash.Hex()),
+		zap.Uint("status", uint(atomicSwap.Status)),
+	}
+	if mismatch(event.Kind, atomicSwap.Status) {
+		ee.logger.Warn("⚖️ [Mismatch] orderbook hasn't seen the htlc event", fields...)
+	} else {
+		ee.logger.Debug("👀 [Event]", fields...)
+	}
+
+	switch {
+	case isInitiatorSwap && event.Kind == ethswap.EventInitiated:
+		// The maker has initiated, we initiate our swap if it's on one of our evm chains.
+		if followerSwap.Status == model.NotStarted {
+			ee.execute(swap.ActionInitiate, &followerSwap, &initiatorSwap)
+		}
+	case !isInitiatorSwap && event.Kind == ethswap.EventRedeemed:
+		// The maker has redeemed our swap and revealed the secret, we redeem the maker's swap with it.
+		if initiatorSwap.Chain.IsEVM() && len(event.Secret) > 0 {
+			initiatorSwap.Secret = hex.EncodeToString(event.Secret)
+			ee.execute(swap.ActionRedeem, &initiatorSwap, nil)
+		}
+	}
+}
+
+// mismatch tells if the status of the swap in the orderbook doesn't reflect the HTLC event.
+func mismatch(kind string, status model.SwapStatus) bool {
+	switch kind {
+	case ethswap.EventInitiated:
+		return status == model.NotStarted
+	case ethswap.EventRedeemed:
+		return status != model.Redeemed && status != model.RedeemDetected
+	case ethswap.EventRefunded:
+		return status != model.Expired
+	default:
+		return false
+	}
+}
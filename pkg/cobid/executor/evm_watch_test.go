@@ -0,0 +1,150 @@
+package executor
+
+import (
+	"encoding/hex"
+	"math/big"
+	"sync"
+
+	"github.com/catalogfi/blockchain/evm/bindings/contracts/htlc/gardenhtlc"
+	"github.com/catalogfi/cobi/pkg/swap"
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
+	"github.com/catalogfi/ob/model"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.uber.org/zap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Evm htlc events", func() {
+	chain := model.EthereumLocalnet
+	makerContract := common.HexToAddress("0xA")
+	ourContract := common.HexToAddress("0xB")
+	secret := []byte("secret")
+
+	var ee *EvmExecutor
+	var order model.Order
+	BeforeEach(func() {
+		ee = &EvmExecutor{
+			logger: zap.NewNop(),
+			wallets: ethswap.Wallets{
+				ethswap.NewWalletKey(chain, makerContract): testEvmWallet{},
+				ethswap.NewWalletKey(chain, ourContract):   testEvmWallet{},
+			},
+			swaps:   map[model.Chain]chan ActionItem{chain: make(chan ActionItem, 4)},
+			watched: map[string]model.Order{},
+			mu:      new(sync.Mutex),
+		}
+		atomicSwap := func(contract common.Address, status model.SwapStatus) *model.AtomicSwap {
+			return &model.AtomicSwap{
+				Status:           status,
+				SecretHash:       common.HexToHash("0x5").Hex(),
+				InitiatorAddress: common.HexToAddress("0x1").Hex(),
+				RedeemerAddress:  common.HexToAddress("0x2").Hex(),
+				Timelock:         "100",
+				Chain:            chain,
+				Asset:            model.Asset(contract.Hex()),
+				Amount:           "1000",
+			}
+		}
+		order = model.Order{
+			InitiatorAtomicSwap: atomicSwap(makerContract, model.NotStarted),
+			FollowerAtomicSwap:  atomicSwap(ourContract, model.NotStarted),
+			Status:              model.Filled,
+		}
+		order.ID = 1
+		order.InitiatorAtomicSwap.ID = 2
+		order.FollowerAtomicSwap.ID = 3
+	})
+
+	// eventLog returns the log of the HTLC event on the swap.
+	eventLog := func(kind string, atomicSwap *model.AtomicSwap) types.Log {
+		htlcABI, err := gardenhtlc.GardenHTLCMetaData.GetAbi()
+		Expect(err).Should(BeNil())
+		ethSwap, err := ethswap.FromAtomicSwap(atomicSwap)
+		Expect(err).Should(BeNil())
+
+		var data []byte
+		switch kind {
+		case "Initiated":
+			data, err = htlcABI.Events[kind].Inputs.NonIndexed().Pack(ethSwap.Amount)
+		case "Redeemed":
+			data, err = htlcABI.Events[kind].Inputs.NonIndexed().Pack(secret)
+		}
+		Expect(err).Should(BeNil())
+		return types.Log{
+			Address: ethSwap.Contract,
+			Topics:  []common.Hash{htlcABI.Events[kind].ID, ethSwap.ID, ethSwap.SecretHash},
+			Data:    data,
+		}
+	}
+
+	received := func() []ActionItem {
+		items := []ActionItem{}
+		for len(ee.swaps[chain]) > 0 {
+			items = append(items, <-ee.swaps[chain])
+		}
+		return items
+	}
+
+	It("should tell if the orderbook hasn't seen the event", func() {
+		Expect(mismatch(ethswap.EventInitiated, model.NotStarted)).Should(BeTrue())
+		Expect(mismatch(ethswap.EventInitiated, model.Initiated)).Should(BeFalse())
+		Expect(mismatch(ethswap.EventRedeemed, model.Initiated)).Should(BeTrue())
+		Expect(mismatch(ethswap.EventRedeemed, model.RedeemDetected)).Should(BeFalse())
+		Expect(mismatch(ethswap.EventRedeemed, model.Redeemed)).Should(BeFalse())
+		Expect(mismatch(ethswap.EventRefunded, model.Initiated)).Should(BeTrue())
+		Expect(mismatch(ethswap.EventRefunded, model.Expired)).Should(BeFalse())
+		Expect(mismatch("unknown", model.NotStarted)).Should(BeFalse())
+	})
+
+	It("should initiate our swap when the maker initiates", func() {
+		ee.watch(order)
+		ee.handleLog(chain, eventLog("Initiated", order.InitiatorAtomicSwap))
+
+		items := received()
+		Expect(items).Should(HaveLen(1))
+		Expect(items[0].Action).Should(Equal(swap.ActionInitiate))
+		Expect(items[0].Swap.ID).Should(Equal(uint(3)))
+		Expect(items[0].Funding.ID).Should(Equal(uint(2)))
+	})
+
+	It("should not initiate our swap twice", func() {
+		order.FollowerAtomicSwap.Status = model.Initiated
+		ee.watch(order)
+		ee.handleLog(chain, eventLog("Initiated", order.InitiatorAtomicSwap))
+		ee.handleLog(chain, eventLog("Initiated", order.FollowerAtomicSwap))
+		Expect(received()).Should(BeEmpty())
+	})
+
+	It("should redeem the maker's swap with the secret revealed on our swap", func() {
+		ee.watch(order)
+		ee.handleLog(chain, eventLog("Redeemed", order.FollowerAtomicSwap))
+
+		items := received()
+		Expect(items).Should(HaveLen(1))
+		Expect(items[0].Action).Should(Equal(swap.ActionRedeem))
+		Expect(items[0].Swap.ID).Should(Equal(uint(2)))
+		Expect(items[0].Swap.Secret).Should(Equal(hex.EncodeToString(secret)))
+	})
+
+	It("should ignore removed logs and the events of orders we don't watch", func() {
+		log := eventLog("Initiated", order.InitiatorAtomicSwap)
+		ee.handleLog(chain, log)
+
+		ee.watch(order)
+		log.Removed = true
+		ee.handleLog(chain, log)
+
+		// Orders which are no longer filled are forgotten
+		order.Status = model.Created
+		ee.watch(order)
+		ee.handleLog(chain, eventLog("Initiated", order.InitiatorAtomicSwap))
+		Expect(received()).Should(BeEmpty())
+
+		// Logs which are not HTLC events
+		ee.handleLog(chain, types.Log{Address: makerContract, Topics: []common.Hash{common.BigToHash(big.NewInt(1))}})
+		Expect(received()).Should(BeEmpty())
+	})
+})
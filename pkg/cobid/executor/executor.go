@@ -28,6 +28,7 @@ func (exes Executors) Stop() {
 }
 
 type ActionItem struct {
-	Action swap.Action
-	Swap   *model.AtomicSwap
+	Action  swap.Action
+	Swap    *model.AtomicSwap
+	Funding *model.AtomicSwap // counterparty's swap which must be initiated before the action, nil if not required
 }
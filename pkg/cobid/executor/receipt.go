@@ -0,0 +1,229 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
+	"github.com/catalogfi/ob/model"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.uber.org/zap"
+)
+
+// Outcomes of a submitted evm tx
+var (
+	TxConfirmed = "confirmed" // mined with enough confirmations
+	TxRetry     = "retry"     // reverted or disappeared, the action will be executed again
+	TxDropped   = "dropped"   // reverted because the action is no longer needed
+	TxAlert     = "alert"     // reverted for an unexpected reason, needs manual attention
+)
+
+// DefaultReceiptTimeout is how long we wait for a tx to be confirmed before executing the action again.
+var DefaultReceiptTimeout = time.Hour
+
+// TxResult is the outcome of a tx submitted by the EvmExecutor.
+type TxResult struct {
+	Chain         model.Chain `json:"chain"`
+	SwapID        uint        `json:"swap_id"`
+	Action        string      `json:"action"`
+	Hash          string      `json:"hash"`
+	Outcome       string      `json:"outcome"`
+	Reason        string      `json:"reason"` // decoded revert reason if the tx reverted
+	BlockNumber   uint64      `json:"block_number"`
+	Confirmations uint64      `json:"confirmations"`
+	Timestamp     int64       `json:"timestamp"`
+}
+
+// revertOutcome decides what to do with an action whose tx reverted for the given reason.
+func revertOutcome(reason string) string {
+	switch reason {
+	case ethswap.RevertFulfilled, ethswap.RevertDuplicateOrder:
+		// Already done by us or the counterparty
+		return TxDropped
+	case ethswap.RevertNotExpired, ethswap.RevertNotInitiated, "":
+		// Might be caused by a reorg or the state changed by an earlier tx in the same block, the pre-checks will
+		// tell if it's still needed.
+		return TxRetry
+	case ethswap.RevertPendingApproval:
+		// The approval the initiation relies on is not mined yet
+		return TxRetry
+	default:
+		return TxAlert
+	}
+}
+
+// track waits for the tx to reach the required confirmations, then handles the outcome and persists it.
+func (ee *EvmExecutor) track(chain model.Chain, item ActionItem, tx *types.Transaction, swaps chan ActionItem) {
+	result, _ := ee.waitReceipt(chain, tx)
+	ee.release(item)
+	if result.Outcome == "" {
+		// Stopped before we know the result
+		return
+	}
+	ee.handleResult(item, result, swaps)
+}
+
+// handleResult retries, drops or alerts according to the outcome of the action, and persists the result.
+func (ee *EvmExecutor) handleResult(item ActionItem, result TxResult, swaps chan ActionItem) {
+	result.SwapID = item.Swap.ID
+	result.Action = string(item.Action)
+	result.Timestamp = time.Now().Unix()
+
+	fields := []zap.Field{
+		zap.String("chain", string(result.Chain)),
+		zap.String("hash", result.Hash),
+		zap.Uint("swap", item.Swap.ID),
+		zap.String("action", string(item.Action)),
+		zap.String("reason", result.Reason),
+	}
+	switch result.Outcome {
+	case TxConfirmed:
+		ee.logger.Info("✅ [Execution]", fields...)
+		ee.decide(item)
+		if err := ee.storage.StoreAction(item.Action, item.Swap.ID); err != nil {
+			ee.logger.Error("store action", zap.Error(err))
+		}
+	case TxRetry:
+		ee.logger.Warn("🔁 [Retry]", fields...)
+		ee.retry(swaps, item)
+	case TxDropped:
+		ee.logger.Warn("🗑️ [Dropped]", fields...)
+	case TxAlert:
+		ee.logger.Error("🚨 [Reverted]", fields...)
+	}
+	if err := ee.storage.StoreTxResult(result); err != nil {
+		ee.logger.Error("store tx result", zap.Error(err))
+	}
+}
+
+// waitReceipt polls the receipt of the tx until it has the required confirmations. The replacements of the tx are
+// polled as well, the result is about whichever of them gets mined. A tx whose nonce is used by a tx we don't know, or
+// which doesn't get mined in time, results in a retry. It returns an empty outcome if the executor is stopped. The
+// receipt is returned when the tx is confirmed.
+func (ee *EvmExecutor) waitReceipt(chain model.Chain, tx *types.Transaction) (TxResult, *types.Receipt) {
+	client := ee.clients[chain]
+	wallet, _ := ee.wallets.Chain(chain)
+	required := ee.opts.Confirmations[chain]
+	if required == 0 {
+		required = 1
+	}
+	blockTime := ee.opts.BlockTimes[chain]
+	if blockTime <= 0 {
+		blockTime = DefaultBlockTime
+	}
+	timeout := ee.opts.ReceiptTimeout
+	if timeout == 0 {
+		timeout = DefaultReceiptTimeout
+	}
+
+	result := TxResult{
+		Chain: chain,
+		Hash:  tx.Hash().Hex(),
+	}
+	var confirmed *types.Receipt
+	consumedAt := uint64(0) // head when we first saw the nonce mined without a receipt of our txs
+	quit := ee.quit
+	ticker := time.NewTicker(blockTime)
+	defer ticker.Stop()
+	deadline := time.Now().Add(timeout)
+	for {
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return result, nil
+		}
+		if time.Now().After(deadline) {
+			result.Outcome = TxRetry
+			result.Reason = "timeout"
+			return result, nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		outcome, err := func() (string, error) {
+			receipt, err := ee.sentReceipt(ctx, client, wallet, tx)
+			if err != nil {
+				return "", err
+			}
+			head, err := client.BlockNumber(ctx)
+			if err != nil {
+				return "", err
+			}
+			if receipt == nil {
+				// The nonce might have been used by a tx we don't know. The provider could also be lagging behind the
+				// one which gave us the nonce, so we only give up after the nonce has been mined for a few blocks.
+				nonce, err := client.NonceAt(ctx, wallet.Address(), nil)
+				if err != nil || nonce <= tx.Nonce() {
+					return "", err
+				}
+				if consumedAt == 0 {
+					consumedAt = head
+				}
+				if head < consumedAt+required {
+					return "", nil
+				}
+				result.Reason = "replaced"
+				return TxRetry, nil
+			}
+			result.Hash = receipt.TxHash.Hex()
+			result.BlockNumber = receipt.BlockNumber.Uint64()
+			result.Confirmations = 0
+			if head >= result.BlockNumber {
+				result.Confirmations = head - result.BlockNumber + 1
+			}
+			if result.Confirmations < required {
+				return "", nil
+			}
+
+			if receipt.Status == types.ReceiptStatusSuccessful {
+				confirmed = receipt
+				return TxConfirmed, nil
+			}
+			reason, err := ethswap.RevertReason(ctx, client, wallet.Address(), tx, receipt.BlockNumber)
+			if err != nil {
+				ee.logger.Error("decode revert", zap.String("hash", result.Hash), zap.Error(err))
+			}
+			result.Reason = reason
+			return revertOutcome(reason), nil
+		}()
+		cancel()
+		if err != nil {
+			ee.logger.Error("check receipt", zap.String("chain", string(chain)), zap.String("hash", result.Hash), zap.Error(err))
+			continue
+		}
+		if outcome != "" {
+			result.Outcome = outcome
+			return result, confirmed
+		}
+	}
+}
+
+// sentReceipt returns the receipt of the tx or any of its replacements, nil if none of them has been mined.
+func (ee *EvmExecutor) sentReceipt(ctx context.Context, client ethswap.Backend, wallet ethswap.Wallet, tx *types.Transaction) (*types.Receipt, error) {
+	hashes := []common.Hash{tx.Hash()}
+	for _, hash := range wallet.Sent(tx.Nonce()) {
+		if hash != tx.Hash() {
+			hashes = append(hashes, hash)
+		}
+	}
+	for i := len(hashes) - 1; i >= 0; i-- {
+		receipt, err := client.TransactionReceipt(ctx, hashes[i])
+		if err == nil {
+			return receipt, nil
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// retry executes the action again after a minute.
+func (ee *EvmExecutor) retry(swaps chan ActionItem, item ActionItem) {
+	go func() {
+		time.Sleep(time.Minute)
+		swaps <- item
+	}()
+}
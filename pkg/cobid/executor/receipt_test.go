@@ -0,0 +1,181 @@
+package executor
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/catalogfi/cobi/pkg/swap"
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
+	"github.com/catalogfi/ob/model"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/params"
+	"go.uber.org/zap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// testEvmWallet only knows its address and the txs it has sent.
+type testEvmWallet struct {
+	ethswap.Wallet
+	addr common.Address
+	sent map[uint64][]common.Hash
+}
+
+func (wallet testEvmWallet) Address() common.Address {
+	return wallet.addr
+}
+
+func (wallet testEvmWallet) Sent(nonce uint64) []common.Hash {
+	return wallet.sent[nonce]
+}
+
+// testResultStore records the actions and tx results.
+type testResultStore struct {
+	Store
+	actions []swap.Action
+	results []TxResult
+}
+
+func (store *testResultStore) StoreAction(action swap.Action, swapID uint) error {
+	store.actions = append(store.actions, action)
+	return nil
+}
+
+func (store *testResultStore) StoreTxResult(result TxResult) error {
+	store.results = append(store.results, result)
+	return nil
+}
+
+var _ = Describe("Evm tx receipts", func() {
+	chain := model.EthereumLocalnet
+
+	It("should decide what to do with reverted txs by the reason", func() {
+		Expect(revertOutcome(ethswap.RevertFulfilled)).Should(Equal(TxDropped))
+		Expect(revertOutcome(ethswap.RevertDuplicateOrder)).Should(Equal(TxDropped))
+		Expect(revertOutcome(ethswap.RevertNotExpired)).Should(Equal(TxRetry))
+		Expect(revertOutcome(ethswap.RevertNotInitiated)).Should(Equal(TxRetry))
+		Expect(revertOutcome(ethswap.RevertPendingApproval)).Should(Equal(TxRetry))
+		Expect(revertOutcome("")).Should(Equal(TxRetry))
+		Expect(revertOutcome(ethswap.RevertIncorrectSecret)).Should(Equal(TxAlert))
+		Expect(revertOutcome("out of gas")).Should(Equal(TxAlert))
+	})
+
+	It("should record the confirmed actions and persist every result", func() {
+		store := &testResultStore{}
+		ee := &EvmExecutor{logger: zap.NewNop(), storage: store, decisions: map[string]decision{}, mu: new(sync.Mutex)}
+		item := ActionItem{Action: swap.ActionRedeem, Swap: &model.AtomicSwap{Chain: chain}}
+		item.Swap.ID = 7
+
+		ee.handleResult(item, TxResult{Chain: chain, Outcome: TxConfirmed}, nil)
+		ee.handleResult(item, TxResult{Chain: chain, Outcome: TxAlert, Reason: ethswap.RevertIncorrectSecret}, nil)
+		Expect(store.actions).Should(Equal([]swap.Action{swap.ActionRedeem}))
+		Expect(ee.decisions).Should(HaveKey("redeem-7"))
+		Expect(store.results).Should(HaveLen(2))
+		Expect(store.results[0].SwapID).Should(Equal(uint(7)))
+		Expect(store.results[0].Action).Should(Equal(string(swap.ActionRedeem)))
+		Expect(store.results[1].Outcome).Should(Equal(TxAlert))
+	})
+
+	Context("waiting for receipts", func() {
+		var (
+			backend *simulated.Backend
+			wallet  testEvmWallet
+			ee      *EvmExecutor
+			send    func(tip int64) *types.Transaction
+			mining  chan struct{}
+		)
+
+		BeforeEach(func(ctx context.Context) {
+			key, err := crypto.GenerateKey()
+			Expect(err).Should(BeNil())
+			addr := crypto.PubkeyToAddress(key.PublicKey)
+			backend = simulated.NewBackend(types.GenesisAlloc{addr: {Balance: big.NewInt(params.Ether)}})
+			chainID, err := backend.Client().ChainID(ctx)
+			Expect(err).Should(BeNil())
+			head, err := backend.Client().HeaderByNumber(ctx, nil)
+			Expect(err).Should(BeNil())
+
+			// Txs of the same nonce with different tips, so the later ones replace the earlier ones
+			signer := types.LatestSignerForChainID(chainID)
+			send = func(tip int64) *types.Transaction {
+				tx, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{
+					ChainID:   chainID,
+					Nonce:     0,
+					GasTipCap: big.NewInt(tip),
+					GasFeeCap: new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), big.NewInt(tip)),
+					Gas:       params.TxGas,
+					To:        &addr,
+					Value:     big.NewInt(0),
+				})
+				Expect(err).Should(BeNil())
+				Expect(backend.Client().SendTransaction(context.Background(), tx)).Should(Succeed())
+				return tx
+			}
+
+			wallet = testEvmWallet{addr: addr, sent: map[uint64][]common.Hash{}}
+			ee = &EvmExecutor{
+				logger:  zap.NewNop(),
+				wallets: ethswap.Wallets{ethswap.NewWalletKey(chain, common.Address{}): wallet},
+				clients: map[model.Chain]ethswap.Backend{chain: backend.Client()},
+				opts: EvmOptions{
+					Confirmations:  map[model.Chain]uint64{chain: 2},
+					BlockTimes:     map[model.Chain]time.Duration{chain: 10 * time.Millisecond},
+					ReceiptTimeout: 10 * time.Second,
+				},
+				quit: make(chan struct{}),
+			}
+			mining = make(chan struct{})
+		})
+
+		AfterEach(func() {
+			close(mining)
+			Expect(backend.Close()).Should(Succeed())
+		})
+
+		mine := func() {
+			go func() {
+				ticker := time.NewTicker(20 * time.Millisecond)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						backend.Commit()
+					case <-mining:
+						return
+					}
+				}
+			}()
+		}
+
+		It("should confirm the action when a replacement of the tx is mined", func() {
+			original := send(params.GWei)
+			replacement := send(2 * params.GWei)
+			wallet.sent[0] = []common.Hash{original.Hash(), replacement.Hash()}
+			mine()
+
+			result, receipt := ee.waitReceipt(chain, original)
+			Expect(result.Outcome).Should(Equal(TxConfirmed))
+			Expect(result.Hash).Should(Equal(replacement.Hash().Hex()))
+			Expect(result.Confirmations).Should(BeNumerically(">=", 2))
+			Expect(receipt.TxHash).Should(Equal(replacement.Hash()))
+		})
+
+		It("should retry when the nonce is used by a tx we don't know", func() {
+			original := send(params.GWei)
+			send(2 * params.GWei)
+			wallet.sent[0] = []common.Hash{original.Hash()}
+			mine()
+
+			result, receipt := ee.waitReceipt(chain, original)
+			Expect(result.Outcome).Should(Equal(TxRetry))
+			Expect(result.Reason).Should(Equal("replaced"))
+			Expect(receipt).Should(BeNil())
+		})
+	})
+})
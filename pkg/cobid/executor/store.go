@@ -6,42 +6,121 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/big"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/catalogfi/cobi/pkg/swap"
 	"github.com/catalogfi/cobi/pkg/swap/btcswap"
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
+	"github.com/catalogfi/ob/model"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/redis/go-redis/v9"
 )
 
 var (
 	KeyBatchData = "batchData"
+	KeySweeps    = "sweeps"
 )
 
-type BatchData struct {
+// SweepRecord is a tx which moves the excess funds of the hot wallet to cold storage.
+type SweepRecord struct {
+	Txid      string `json:"txid"`
+	To        string `json:"to"`
+	Amount    int64  `json:"amount"`
+	Index     uint32 `json:"index"`     // derivation index of the cold address
+	Timestamp int64  `json:"timestamp"` // unix time when the tx was broadcast
+}
+
+// Batch is a chain of RBF transactions, each one replacing the previous tx with more actions or higher fees.
+type Batch struct {
 	PrevOrders map[string]struct{} `json:"prev_orders"`
 	RbfOptions btcswap.OptionRBF   `json:"rbf_options"`
+	Txid       string              `json:"txid"`   // the latest tx of the batch
+	Sealed     bool                `json:"sealed"` // a sealed batch takes no new actions, but its fees can still be bumped
 }
 
-func NewBatchData() BatchData {
-	return BatchData{
+func NewBatch() Batch {
+	return Batch{
 		PrevOrders: map[string]struct{}{},
 		RbfOptions: btcswap.OptionRBF{},
 	}
 }
 
-func (bd *BatchData) HasAction(item btcswap.ActionItem) bool {
-	key := fmt.Sprintf("%v_%v", item.Action, hex.EncodeToString(item.AtomicSwap.SecretHash))
-	_, ok := bd.PrevOrders[key]
+func (batch *Batch) HasAction(item btcswap.ActionItem) bool {
+	_, ok := batch.PrevOrders[batchActionKey(item)]
 	return ok
 }
 
-func (bd *BatchData) AddExecuteAction(item btcswap.ActionItem) {
-	key := fmt.Sprintf("%v_%v", item.Action, hex.EncodeToString(item.AtomicSwap.SecretHash))
-	bd.PrevOrders[key] = struct{}{}
-	return
+func (batch *Batch) AddExecuteAction(item btcswap.ActionItem) {
+	if batch.PrevOrders == nil {
+		batch.PrevOrders = map[string]struct{}{}
+	}
+	batch.PrevOrders[batchActionKey(item)] = struct{}{}
+}
+
+// Seal the batch so that it won't take any new actions.
+func (batch *Batch) Seal() {
+	batch.Sealed = true
+	batch.RbfOptions = btcswap.SealRBF(batch.RbfOptions)
+}
+
+// BatchData keeps track of all the batches which haven't been confirmed. Only the last batch can be open for new
+// actions, all the others are sealed.
+type BatchData struct {
+	Batches []Batch `json:"batches"`
+}
+
+func NewBatchData() BatchData {
+	return BatchData{
+		Batches: []Batch{},
+	}
+}
+
+func (bd *BatchData) HasAction(item btcswap.ActionItem) bool {
+	for i := range bd.Batches {
+		if bd.Batches[i].HasAction(item) {
+			return true
+		}
+	}
+	return false
+}
+
+// Open returns the index of the batch which takes new actions, a new batch will be started if all the batches are
+// sealed.
+func (bd *BatchData) Open() int {
+	if len(bd.Batches) > 0 && !bd.Batches[len(bd.Batches)-1].Sealed {
+		return len(bd.Batches) - 1
+	}
+	batch := NewBatch()
+	batch.RbfOptions.ExcludedUtxos = bd.reservedUtxos()
+	bd.Batches = append(bd.Batches, batch)
+	return len(bd.Batches) - 1
+}
+
+// reservedUtxos returns the wallet utxos which are used or might be used by the existing batches. Batches which have
+// never been broadcast don't reserve anything, so a batch dropped before its first tx doesn't lock up any utxo.
+func (bd *BatchData) reservedUtxos() []string {
+	reserved := []string{}
+	for _, batch := range bd.Batches {
+		if batch.Txid == "" {
+			continue
+		}
+		for _, utxo := range batch.RbfOptions.PrevInputs {
+			reserved = append(reserved, btcswap.UtxoKey(utxo))
+		}
+		for _, utxo := range batch.RbfOptions.FirstUtxos {
+			reserved = append(reserved, btcswap.UtxoKey(utxo))
+		}
+	}
+	return reserved
+}
+
+func batchActionKey(item btcswap.ActionItem) string {
+	return fmt.Sprintf("%v_%v", item.Action, hex.EncodeToString(item.AtomicSwap.SecretHash))
 }
 
 type Store interface {
@@ -57,6 +136,27 @@ type Store interface {
 
 	// GetBatchData from the storage
 	GetBatchData() (BatchData, error)
+
+	// StoreSweep records a sweep tx. The record of `replaced` will be removed if the sweep tx replaces it.
+	StoreSweep(record SweepRecord, replaced string) error
+
+	// RemoveSweep removes the record of a sweep tx which has been replaced by a tx without sweeping.
+	RemoveSweep(txid string) error
+
+	// GetSweeps returns all the sweep records.
+	GetSweeps() ([]SweepRecord, error)
+
+	// StoreTxResult stores the outcome of an evm tx.
+	StoreTxResult(result TxResult) error
+
+	// GetTxResult returns the outcome of the evm tx with the given hash.
+	GetTxResult(chain model.Chain, hash string) (TxResult, error)
+
+	// Store also persists the nonces of the evm wallets.
+	ethswap.NonceStore
+
+	// Store also persists the events of the evm HTLC indexers.
+	ethswap.EventStore
 }
 
 type redisStore struct {
@@ -123,9 +223,227 @@ func (rs redisStore) GetBatchData() (BatchData, error) {
 	if err := json.Unmarshal(data, &bd); err != nil {
 		return BatchData{}, err
 	}
+
+	// Data stored before supporting multiple batches only has a single batch at the top level.
+	if len(bd.Batches) == 0 {
+		var legacy Batch
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return BatchData{}, err
+		}
+		if len(legacy.PrevOrders) != 0 {
+			bd.Batches = []Batch{legacy}
+		}
+	}
 	return bd, nil
 }
 
+func (rs redisStore) StoreSweep(record SweepRecord, replaced string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	pipe := rs.client.TxPipeline()
+	if replaced != "" {
+		pipe.HDel(ctx, KeySweeps, replaced)
+	}
+	pipe.HSet(ctx, KeySweeps, record.Txid, data)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (rs redisStore) RemoveSweep(txid string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return rs.client.HDel(ctx, KeySweeps, txid).Err()
+}
+
+func (rs redisStore) GetSweeps() ([]SweepRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, err := rs.client.HGetAll(ctx, KeySweeps).Result()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]SweepRecord, 0, len(data))
+	for _, value := range data {
+		var record SweepRecord
+		if err := json.Unmarshal([]byte(value), &record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Timestamp < records[j].Timestamp
+	})
+	return records, nil
+}
+
+func (rs redisStore) StoreTxResult(result TxResult) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return rs.client.Set(ctx, txResultKey(result.Chain, result.Hash), data, 0).Err()
+}
+
+func (rs redisStore) GetTxResult(chain model.Chain, hash string) (TxResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, err := rs.client.Get(ctx, txResultKey(chain, hash)).Bytes()
+	if err != nil {
+		return TxResult{}, err
+	}
+	var result TxResult
+	err = json.Unmarshal(data, &result)
+	return result, err
+}
+
+func (rs redisStore) LoadNonces(chainID *big.Int, addr common.Address) (ethswap.NonceState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	state := ethswap.NonceState{Assigned: map[uint64]string{}}
+	data, err := rs.client.Get(ctx, nonceKey(chainID, addr)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return state, nil
+		}
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, err
+	}
+	if state.Assigned == nil {
+		state.Assigned = map[uint64]string{}
+	}
+	return state, nil
+}
+
+func (rs redisStore) StoreNonces(chainID *big.Int, addr common.Address, state ethswap.NonceState) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return rs.client.Set(ctx, nonceKey(chainID, addr), data, 0).Err()
+}
+
+func (rs redisStore) LoadCheckpoint(chainID *big.Int) (ethswap.Checkpoint, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var checkpoint ethswap.Checkpoint
+	data, err := rs.client.Get(ctx, checkpointKey(chainID)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return checkpoint, nil
+		}
+		return checkpoint, err
+	}
+	err = json.Unmarshal(data, &checkpoint)
+	return checkpoint, err
+}
+
+func (rs redisStore) StoreEvents(chainID *big.Int, events []ethswap.HTLCEvent, checkpoint ethswap.Checkpoint) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cpData, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	pipe := rs.client.TxPipeline()
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		member := redis.Z{Score: float64(event.BlockNumber), Member: data}
+		pipe.ZAdd(ctx, eventsKey(chainID), member)
+		pipe.ZAdd(ctx, orderEventsKey(chainID, event.Contract, event.OrderID), member)
+	}
+	pipe.Set(ctx, checkpointKey(chainID), cpData, 0)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (rs redisStore) Rewind(chainID *big.Int, checkpoint ethswap.Checkpoint) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	min := fmt.Sprintf("(%v", checkpoint.Block)
+	removed, err := rs.client.ZRangeByScore(ctx, eventsKey(chainID), &redis.ZRangeBy{Min: min, Max: "+inf"}).Result()
+	if err != nil {
+		return err
+	}
+	cpData, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	pipe := rs.client.TxPipeline()
+	for _, data := range removed {
+		var event ethswap.HTLCEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return err
+		}
+		pipe.ZRem(ctx, orderEventsKey(chainID, event.Contract, event.OrderID), data)
+	}
+	pipe.ZRemRangeByScore(ctx, eventsKey(chainID), min, "+inf")
+	pipe.Set(ctx, checkpointKey(chainID), cpData, 0)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (rs redisStore) OrderEvents(chainID *big.Int, contract common.Address, orderID common.Hash) ([]ethswap.HTLCEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, err := rs.client.ZRange(ctx, orderEventsKey(chainID, contract, orderID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return decodeEvents(data)
+}
+
+func (rs redisStore) RangeEvents(chainID *big.Int, from, to uint64) ([]ethswap.HTLCEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	data, err := rs.client.ZRangeByScore(ctx, eventsKey(chainID), &redis.ZRangeBy{
+		Min: strconv.FormatUint(from, 10),
+		Max: strconv.FormatUint(to, 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	return decodeEvents(data)
+}
+
+func decodeEvents(data []string) ([]ethswap.HTLCEvent, error) {
+	events := make([]ethswap.HTLCEvent, 0, len(data))
+	for _, value := range data {
+		var event ethswap.HTLCEvent
+		if err := json.Unmarshal([]byte(value), &event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	ethswap.SortEvents(events)
+	return events, nil
+}
+
 func (rs redisStore) ordersToString(orders map[uint]struct{}) string {
 	if len(orders) == 0 {
 		return ""
@@ -154,6 +472,26 @@ func (rs redisStore) ordersFromString(orders string) map[uint]struct{} {
 	return orderMap
 }
 
+func txResultKey(chain model.Chain, hash string) string {
+	return fmt.Sprintf("tx-%v-%v", chain, strings.ToLower(hash))
+}
+
+func nonceKey(chainID *big.Int, addr common.Address) string {
+	return fmt.Sprintf("nonce-%v-%v", chainID, strings.ToLower(addr.Hex()))
+}
+
+func checkpointKey(chainID *big.Int) string {
+	return fmt.Sprintf("htlc-checkpoint-%v", chainID)
+}
+
+func eventsKey(chainID *big.Int) string {
+	return fmt.Sprintf("htlc-events-%v", chainID)
+}
+
+func orderEventsKey(chainID *big.Int, contract common.Address, orderID common.Hash) string {
+	return fmt.Sprintf("htlc-order-%v-%v-%v", chainID, strings.ToLower(contract.Hex()), orderID.Hex())
+}
+
 func actionKey(action swap.Action, swapID uint) string {
 	return fmt.Sprintf("%v-%v", action, swapID)
 }
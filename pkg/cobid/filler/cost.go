@@ -0,0 +1,112 @@
+package filler
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/catalogfi/blockchain/btc"
+	"github.com/catalogfi/cobi/pkg/swap"
+	"github.com/catalogfi/cobi/pkg/swap/btcswap"
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
+	"github.com/catalogfi/ob/model"
+)
+
+const (
+	// BtcInitiateVirtualSize is the rough virtual size of our initiation, spending a P2WPKH input to fund a P2WSH
+	// output, plus the tx overhead.
+	BtcInitiateVirtualSize = 68 + 43 + 11
+
+	// BtcP2wpkhOutputVirtualSize is the virtual size of an output paying to our address.
+	BtcP2wpkhOutputVirtualSize = 31
+)
+
+// Cost is the estimated on-chain cost of filling an order, in the unit of the order amount.
+type Cost struct {
+	Initiate *big.Int // cost of initiating our swap
+	Redeem   *big.Int // cost of redeeming the maker's swap
+}
+
+// Total returns the total cost of filling the order.
+func (cost Cost) Total() *big.Int {
+	return new(big.Int).Add(cost.Initiate, cost.Redeem)
+}
+
+// CostEstimator estimates the on-chain cost of filling an order at the current fee rates.
+type CostEstimator interface {
+	Cost(ctx context.Context, order model.Order) (Cost, error)
+}
+
+type costEstimator struct {
+	btcWallet    btcswap.Wallet
+	ethWallets   ethswap.Wallets
+	nativePrices map[string]float64
+}
+
+// NewCostEstimator returns a CostEstimator which converts the gas cost on the evm chains to the unit of the order amount
+// with the given prices, which are the value of 1 native token (1e18 wei) of the chain in the unit of the asset swapped,
+// keyed by AssetKey.
+func NewCostEstimator(btcWallet btcswap.Wallet, ethWallets ethswap.Wallets, nativePrices map[string]float64) CostEstimator {
+	return &costEstimator{
+		btcWallet:    btcWallet,
+		ethWallets:   ethWallets,
+		nativePrices: nativePrices,
+	}
+}
+
+func (estimator *costEstimator) Cost(ctx context.Context, order model.Order) (Cost, error) {
+	if order.InitiatorAtomicSwap == nil || order.FollowerAtomicSwap == nil {
+		return Cost{}, fmt.Errorf("missing atomic swap")
+	}
+
+	// As the filler, we initiate the follower swap and redeem the initiator swap.
+	initiate, err := estimator.actionCost(ctx, swap.ActionInitiate, order.FollowerAtomicSwap)
+	if err != nil {
+		return Cost{}, fmt.Errorf("initiate cost, %v", err)
+	}
+	redeem, err := estimator.actionCost(ctx, swap.ActionRedeem, order.InitiatorAtomicSwap)
+	if err != nil {
+		return Cost{}, fmt.Errorf("redeem cost, %v", err)
+	}
+	return Cost{
+		Initiate: initiate,
+		Redeem:   redeem,
+	}, nil
+}
+
+func (estimator *costEstimator) actionCost(ctx context.Context, action swap.Action, atomicSwap *model.AtomicSwap) (*big.Int, error) {
+	if atomicSwap.Chain.IsBTC() {
+		feeRate, err := estimator.btcWallet.FeeRate()
+		if err != nil {
+			return nil, err
+		}
+		vsize := BtcInitiateVirtualSize
+		if action == swap.ActionRedeem {
+			vsize = btcswap.TxInVirtualSize + (btc.RedeemHtlcRedeemSigScriptSize(32)+3)/4 + BtcP2wpkhOutputVirtualSize + 11
+		}
+		return big.NewInt(int64(feeRate * vsize)), nil
+	}
+
+	wallet, ok := estimator.ethWallets.Asset(atomicSwap.Chain, atomicSwap.Asset)
+	if !ok {
+		return nil, fmt.Errorf("no wallet for %v on %v", atomicSwap.Asset, atomicSwap.Chain)
+	}
+	asset := AssetKey(atomicSwap.Chain, atomicSwap.Asset)
+	price, ok := estimator.nativePrices[asset]
+	if !ok {
+		return nil, fmt.Errorf("native price of %v is not configured", asset)
+	}
+	wei, err := wallet.ActionCost(ctx, action)
+	if err != nil {
+		return nil, err
+	}
+
+	// cost = wei * price / 1e18, rounded up
+	cost := new(big.Float).Mul(new(big.Float).SetInt(wei), big.NewFloat(price))
+	cost.Quo(cost, big.NewFloat(1e18))
+	amount, accuracy := cost.Int(nil)
+	if accuracy == big.Below {
+		amount.Add(amount, big.NewInt(1))
+	}
+	return amount, nil
+}
@@ -0,0 +1,121 @@
+package filler_test
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/catalogfi/cobi/pkg/cobid/filler"
+	"github.com/catalogfi/cobi/pkg/swap"
+	"github.com/catalogfi/cobi/pkg/swap/btcswap"
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
+	"github.com/catalogfi/ob/model"
+	"github.com/ethereum/go-ethereum/common"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// costEthWallet returns fixed action costs in wei.
+type costEthWallet struct {
+	ethswap.Wallet
+	costs map[swap.Action]*big.Int
+}
+
+func (wallet costEthWallet) ActionCost(ctx context.Context, action swap.Action) (*big.Int, error) {
+	return wallet.costs[action], nil
+}
+
+// costBtcWallet returns a fixed fee rate.
+type costBtcWallet struct {
+	btcswap.Wallet
+	feeRate int
+}
+
+func (wallet costBtcWallet) FeeRate() (int, error) {
+	return wallet.feeRate, nil
+}
+
+var _ = Describe("Cost estimator", func() {
+	wbtc := common.HexToAddress("0x1")
+	usdc := common.HexToAddress("0x2")
+	ether := big.NewInt(1e18)
+	wallets := ethswap.Wallets{
+		ethswap.NewWalletKey(model.EthereumArbitrum, wbtc): costEthWallet{costs: map[swap.Action]*big.Int{
+			// 0.001 ETH of L2 gas and L1 data fee
+			swap.ActionInitiate: new(big.Int).Div(ether, big.NewInt(1000)),
+			swap.ActionRedeem:   new(big.Int).Div(ether, big.NewInt(2000)),
+		}},
+		ethswap.NewWalletKey(model.EthereumArbitrum, usdc): costEthWallet{costs: map[swap.Action]*big.Int{
+			swap.ActionInitiate: new(big.Int).Div(ether, big.NewInt(1000)),
+		}},
+	}
+	estimator := filler.NewCostEstimator(costBtcWallet{feeRate: 10}, wallets, map[string]float64{
+		filler.AssetKey(model.EthereumArbitrum, model.Asset(wbtc.Hex())): 5e6, // 0.05 BTC in sats
+		filler.AssetKey(model.EthereumArbitrum, model.Asset(usdc.Hex())): 3e9, // 3000 USDC in 6 decimals
+	})
+	order := func(asset common.Address) model.Order {
+		return model.Order{
+			InitiatorAtomicSwap: &model.AtomicSwap{Chain: model.Bitcoin, Amount: "1000000"},
+			FollowerAtomicSwap:  &model.AtomicSwap{Chain: model.EthereumArbitrum, Asset: model.Asset(asset.Hex()), Amount: "990000"},
+		}
+	}
+
+	It("should convert the gas cost with the native price of the asset", func(ctx context.Context) {
+		cost, err := estimator.Cost(ctx, order(wbtc))
+		Expect(err).Should(BeNil())
+		Expect(cost.Initiate.Int64()).Should(Equal(int64(5000)))
+		Expect(cost.Redeem.Int64()).Should(BeNumerically(">", 0))
+
+		cost, err = estimator.Cost(ctx, order(usdc))
+		Expect(err).Should(BeNil())
+		Expect(cost.Initiate.Int64()).Should(Equal(int64(3e6)))
+	})
+
+	It("should reject assets without a native price", func(ctx context.Context) {
+		_, err := estimator.Cost(ctx, order(common.HexToAddress("0x3")))
+		Expect(err).ShouldNot(BeNil())
+
+		estimator := filler.NewCostEstimator(costBtcWallet{feeRate: 10}, wallets, map[string]float64{
+			filler.AssetKey(model.EthereumArbitrum, model.Asset(usdc.Hex())): 3e9,
+		})
+		_, err = estimator.Cost(ctx, order(wbtc))
+		Expect(err).Should(MatchError(ContainSubstring("native price")))
+	})
+
+	It("should take the cost from the profit", func(ctx context.Context) {
+		cost, err := estimator.Cost(ctx, order(wbtc))
+		Expect(err).Should(BeNil())
+		fee := int64(1000000 - 990000)
+
+		strategy := filler.Strategy{MinProfit: big.NewInt(fee - cost.Total().Int64())}
+		profit, err := strategy.MatchProfit(order(wbtc), filler.Market{}, cost)
+		Expect(err).Should(BeNil())
+		Expect(profit.Int64()).Should(Equal(fee - cost.Total().Int64()))
+
+		strategy.MinProfit = big.NewInt(fee - cost.Total().Int64() + 1)
+		_, err = strategy.MatchProfit(order(wbtc), filler.Market{}, cost)
+		Expect(err).ShouldNot(BeNil())
+	})
+
+	It("should convert the redeem cost of an unpegged pair to the asset we send", func() {
+		// We receive 1 ETH in wei and send 0.049 BTC in sats
+		strategy := filler.Strategy{Rate: &filler.Rate{Receive: "ETH", Send: "BTC", ReceiveDecimals: 18, SendDecimals: 8}}
+		order := model.Order{
+			InitiatorAtomicSwap: &model.AtomicSwap{Chain: model.Ethereum, Amount: "1000000000000000000"},
+			FollowerAtomicSwap:  &model.AtomicSwap{Chain: model.Bitcoin, Amount: "4900000"},
+		}
+		cost := filler.Cost{
+			Initiate: big.NewInt(2000),                          // sats
+			Redeem:   new(big.Int).Div(ether, big.NewInt(1000)), // 0.001 ETH in wei
+		}
+
+		// 0.05 BTC - 0.049 BTC - 2000 sats - 0.001 ETH (5000 sats)
+		profit, err := strategy.MatchProfit(order, filler.Market{Price: 0.05}, cost)
+		Expect(err).Should(BeNil())
+		Expect(profit.Int64()).Should(Equal(int64(93000)))
+
+		strategy.MinProfit = big.NewInt(93001)
+		_, err = strategy.MatchProfit(order, filler.Market{Price: 0.05}, cost)
+		Expect(err).Should(MatchError(ContainSubstring("redeem cost = 5000")))
+	})
+})
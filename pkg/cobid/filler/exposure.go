@@ -0,0 +1,210 @@
+package filler
+
+import (
+	"expvar"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/catalogfi/ob/model"
+)
+
+// ExposureLimit caps how much of an asset we commit to the orders we've filled, in the unit of the order amount. Nil
+// means no limit.
+type ExposureLimit struct {
+	Outstanding *big.Int // all the orders which haven't been redeemed by the maker
+	PerMaker    *big.Int // the outstanding orders of a single maker
+	PerWindow   *big.Int // the orders we've filled within the rolling window
+}
+
+// ExposureLimits are the limits of the assets we send, keyed by AssetKey.
+type ExposureLimits struct {
+	Assets map[string]ExposureLimit
+	Window time.Duration // length of the rolling window, DefaultExposureWindow if not provided
+	Hold   time.Duration // how long an order is held for room within the limits, DefaultExposureHold if not provided
+}
+
+var (
+	// DefaultExposureWindow is the default rolling window of the exposure limits.
+	DefaultExposureWindow = time.Hour
+
+	// DefaultExposureHold is how long an order is held for room within the limits by default, after which we give up
+	// on it as the maker has likely moved on.
+	DefaultExposureHold = 10 * time.Minute
+)
+
+// AssetKey returns the key of the asset on the chain in the ExposureLimits, like bitcoin or ethereum:0x...
+func AssetKey(chain model.Chain, asset model.Asset) string {
+	if chain.IsBTC() {
+		return string(chain)
+	}
+	return fmt.Sprintf("%v:%v", chain, strings.ToLower(string(asset)))
+}
+
+// ExposureError is returned when filling an order would exceed the exposure limits.
+type ExposureError struct {
+	Err error
+}
+
+func (ee ExposureError) Error() string {
+	return ee.Err.Error()
+}
+
+// ExposureUsage is how much of the limits of an asset is used.
+type ExposureUsage struct {
+	Outstanding *big.Int
+	PerMaker    map[string]*big.Int
+	PerWindow   *big.Int
+}
+
+// exposureMetrics publishes the latest usage of each asset, visible at /debug/vars when an http server is running.
+var exposureMetrics = expvar.NewMap("cobid_exposure")
+
+// ExposureFill is an order we've filled, counted in the rolling window of its asset.
+type ExposureFill struct {
+	OrderID  uint   `json:"order_id"`
+	Asset    string `json:"asset"`
+	Amount   string `json:"amount"`
+	FilledAt int64  `json:"filled_at"` // unix seconds
+}
+
+// ExposureStore persists the orders we've filled, so the rolling window survives restarts.
+type ExposureStore interface {
+	// StoreFill records an order we've filled.
+	StoreFill(fill ExposureFill) error
+
+	// GetFills returns the orders of the asset filled since the unix time.
+	GetFills(asset string, since int64) ([]ExposureFill, error)
+}
+
+// Exposure enforces the ExposureLimits on the orders we fill.
+type Exposure struct {
+	limits ExposureLimits
+	store  ExposureStore
+}
+
+func NewExposure(limits ExposureLimits, store ExposureStore) *Exposure {
+	if limits.Window <= 0 {
+		limits.Window = DefaultExposureWindow
+	}
+	if limits.Hold <= 0 {
+		limits.Hold = DefaultExposureHold
+	}
+	return &Exposure{
+		limits: limits,
+		store:  store,
+	}
+}
+
+// Match rejects the orders which exceed the limits on their own, so they would never be filled.
+func (exposure *Exposure) Match(order model.Order) (bool, error) {
+	limit, ok := exposure.limits.Assets[AssetKey(order.FollowerAtomicSwap.Chain, order.FollowerAtomicSwap.Asset)]
+	if !ok {
+		return true, nil
+	}
+	amount, ok := new(big.Int).SetString(order.FollowerAtomicSwap.Amount, 10)
+	if !ok {
+		return false, fmt.Errorf("invalid order amount = %v", order.FollowerAtomicSwap.Amount)
+	}
+	for _, max := range []*big.Int{limit.Outstanding, limit.PerMaker, limit.PerWindow} {
+		if max != nil && amount.Cmp(max) > 0 {
+			return false, fmt.Errorf("amount(%v) exceeds the exposure limit(%v)", amount.String(), max.String())
+		}
+	}
+	return true, nil
+}
+
+// Usage returns the usage of the limits of the asset, from the outstanding orders we've filled and the orders filled
+// within the window. The orders whose follower swap is redeemed or expired are settled, the amount is either the
+// maker's or refunded to us.
+func (exposure *Exposure) Usage(asset string, filled []model.Order) (ExposureUsage, error) {
+	usage := ExposureUsage{
+		Outstanding: big.NewInt(0),
+		PerMaker:    map[string]*big.Int{},
+		PerWindow:   big.NewInt(0),
+	}
+	for _, order := range filled {
+		if order.FollowerAtomicSwap == nil || AssetKey(order.FollowerAtomicSwap.Chain, order.FollowerAtomicSwap.Asset) != asset {
+			continue
+		}
+		switch order.FollowerAtomicSwap.Status {
+		case model.Redeemed, model.RedeemDetected, model.Expired:
+			continue
+		}
+		amount, ok := new(big.Int).SetString(order.FollowerAtomicSwap.Amount, 10)
+		if !ok {
+			continue
+		}
+		maker := strings.ToLower(order.Maker)
+		if usage.PerMaker[maker] == nil {
+			usage.PerMaker[maker] = big.NewInt(0)
+		}
+		usage.Outstanding.Add(usage.Outstanding, amount)
+		usage.PerMaker[maker].Add(usage.PerMaker[maker], amount)
+	}
+
+	fills, err := exposure.store.GetFills(asset, time.Now().Add(-exposure.limits.Window).Unix())
+	if err != nil {
+		return ExposureUsage{}, fmt.Errorf("get fills, %v", err)
+	}
+	for _, fill := range fills {
+		amount, ok := new(big.Int).SetString(fill.Amount, 10)
+		if !ok {
+			return ExposureUsage{}, fmt.Errorf("invalid fill amount = %v", fill.Amount)
+		}
+		usage.PerWindow.Add(usage.PerWindow, amount)
+	}
+	exposureMetrics.Set(asset, expvar.Func(func() any {
+		return map[string]string{
+			"outstanding": usage.Outstanding.String(),
+			"window":      usage.PerWindow.String(),
+		}
+	}))
+	return usage, nil
+}
+
+// Check tells if filling the order keeps the usage of its asset within the limits, it gives an error to indicate
+// which limit would be exceeded.
+func (exposure *Exposure) Check(order model.Order, usage ExposureUsage) error {
+	limit, ok := exposure.limits.Assets[AssetKey(order.FollowerAtomicSwap.Chain, order.FollowerAtomicSwap.Asset)]
+	if !ok {
+		return nil
+	}
+	amount, ok := new(big.Int).SetString(order.FollowerAtomicSwap.Amount, 10)
+	if !ok {
+		return fmt.Errorf("invalid order amount = %v", order.FollowerAtomicSwap.Amount)
+	}
+	exceeds := func(used, max *big.Int) bool {
+		return max != nil && new(big.Int).Add(used, amount).Cmp(max) > 0
+	}
+	if exceeds(usage.Outstanding, limit.Outstanding) {
+		return fmt.Errorf("outstanding exposure limit reached, used = %v, limit = %v", usage.Outstanding, limit.Outstanding)
+	}
+	makerUsage := usage.PerMaker[strings.ToLower(order.Maker)]
+	if makerUsage == nil {
+		makerUsage = big.NewInt(0)
+	}
+	if exceeds(makerUsage, limit.PerMaker) {
+		return fmt.Errorf("maker exposure limit reached, used = %v, limit = %v", makerUsage, limit.PerMaker)
+	}
+	if exceeds(usage.PerWindow, limit.PerWindow) {
+		return fmt.Errorf("exposure limit of the last %v reached, used = %v, limit = %v", exposure.limits.Window, usage.PerWindow, limit.PerWindow)
+	}
+	return nil
+}
+
+// Filled counts the order in the rolling window.
+func (exposure *Exposure) Filled(order model.Order) error {
+	return exposure.store.StoreFill(ExposureFill{
+		OrderID:  order.ID,
+		Asset:    AssetKey(order.FollowerAtomicSwap.Chain, order.FollowerAtomicSwap.Asset),
+		Amount:   order.FollowerAtomicSwap.Amount,
+		FilledAt: time.Now().Unix(),
+	})
+}
+
+// Expired tells if we've held the order for room within the limits for too long.
+func (exposure *Exposure) Expired(heldAt time.Time) bool {
+	return time.Since(heldAt) > exposure.limits.Hold
+}
@@ -0,0 +1,116 @@
+package filler_test
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/catalogfi/cobi/pkg/cobid/filler"
+	"github.com/catalogfi/ob/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// memExposureStore keeps the fills in memory.
+type memExposureStore struct {
+	fills []filler.ExposureFill
+}
+
+func (store *memExposureStore) StoreFill(fill filler.ExposureFill) error {
+	store.fills = append(store.fills, fill)
+	return nil
+}
+
+func (store *memExposureStore) GetFills(asset string, since int64) ([]filler.ExposureFill, error) {
+	fills := []filler.ExposureFill{}
+	for _, fill := range store.fills {
+		if fill.Asset == asset && fill.FilledAt >= since {
+			fills = append(fills, fill)
+		}
+	}
+	return fills, nil
+}
+
+var _ = Describe("Exposure limits", func() {
+	order := func(maker, amount string, status model.SwapStatus) model.Order {
+		return model.Order{
+			Maker: maker,
+			FollowerAtomicSwap: &model.AtomicSwap{
+				Chain:  model.Bitcoin,
+				Amount: amount,
+				Status: status,
+			},
+		}
+	}
+	asset := filler.AssetKey(model.Bitcoin, "")
+	limits := filler.ExposureLimits{
+		Assets: map[string]filler.ExposureLimit{
+			asset: {Outstanding: big.NewInt(1000), PerMaker: big.NewInt(600), PerWindow: big.NewInt(800)},
+		},
+		Window: time.Hour,
+	}
+
+	var store *memExposureStore
+	BeforeEach(func() {
+		store = &memExposureStore{}
+	})
+
+	It("should reject orders over the limits and hold orders until there's room", func() {
+		exposure := filler.NewExposure(limits, store)
+		match, err := exposure.Match(order("0xA", "700", model.NotStarted))
+		Expect(err).ShouldNot(BeNil())
+		Expect(match).Should(BeFalse())
+
+		filled := []model.Order{order("0xA", "500", model.Initiated), order("0xB", "300", model.Redeemed)}
+		usage, err := exposure.Usage(asset, filled)
+		Expect(err).Should(BeNil())
+		Expect(usage.Outstanding.Int64()).Should(Equal(int64(500)))
+		Expect(exposure.Check(order("0xA", "200", model.NotStarted), usage)).Should(MatchError(ContainSubstring("maker")))
+		Expect(exposure.Check(order("0xB", "200", model.NotStarted), usage)).Should(Succeed())
+
+		By("Filling within the window")
+		Expect(exposure.Filled(order("0xB", "600", model.NotStarted))).Should(Succeed())
+		usage, err = exposure.Usage(asset, filled)
+		Expect(err).Should(BeNil())
+		Expect(usage.PerWindow.Int64()).Should(Equal(int64(600)))
+		Expect(exposure.Check(order("0xC", "300", model.NotStarted), usage)).Should(MatchError(ContainSubstring("last")))
+		Expect(exposure.Check(order("0xC", "100", model.NotStarted), usage)).Should(Succeed())
+	})
+
+	It("should not count the orders whose follower swap expired as outstanding", func() {
+		exposure := filler.NewExposure(limits, store)
+		filled := []model.Order{
+			order("0xA", "400", model.Initiated),
+			order("0xA", "500", model.Expired),
+			order("0xB", "300", model.RedeemDetected),
+		}
+		usage, err := exposure.Usage(asset, filled)
+		Expect(err).Should(BeNil())
+		Expect(usage.Outstanding.Int64()).Should(Equal(int64(400)))
+		Expect(usage.PerMaker).Should(HaveLen(1))
+		Expect(usage.PerMaker["0xa"].Int64()).Should(Equal(int64(400)))
+		Expect(exposure.Check(order("0xA", "200", model.NotStarted), usage)).Should(Succeed())
+	})
+
+	It("should keep counting the fills of the window after a restart", func() {
+		Expect(filler.NewExposure(limits, store).Filled(order("0xB", "600", model.NotStarted))).Should(Succeed())
+		Expect(store.StoreFill(filler.ExposureFill{Asset: asset, Amount: "500", FilledAt: time.Now().Add(-2 * time.Hour).Unix()})).Should(Succeed())
+
+		exposure := filler.NewExposure(limits, store)
+		usage, err := exposure.Usage(asset, nil)
+		Expect(err).Should(BeNil())
+		Expect(usage.PerWindow.Int64()).Should(Equal(int64(600)))
+		Expect(exposure.Check(order("0xC", "300", model.NotStarted), usage)).Should(MatchError(ContainSubstring("last")))
+	})
+
+	It("should give up on the orders held for too long", func() {
+		exposure := filler.NewExposure(filler.ExposureLimits{Hold: time.Minute}, store)
+		Expect(exposure.Expired(time.Now())).Should(BeFalse())
+		Expect(exposure.Expired(time.Now().Add(-2 * time.Minute))).Should(BeTrue())
+
+		By("Orders are held for the default time if not configured")
+		exposure = filler.NewExposure(limits, store)
+		Expect(exposure.Expired(time.Now().Add(-2 * time.Minute))).Should(BeFalse())
+		Expect(exposure.Expired(time.Now().Add(-filler.DefaultExposureHold - time.Minute))).Should(BeTrue())
+	})
+})
@@ -2,6 +2,7 @@ package filler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
 	"strings"
@@ -27,16 +28,24 @@ type filler struct {
 	logger     *zap.Logger
 	strategies Strategies
 	btcWallet  btcswap.Wallet
-	ethWallets map[model.Chain]ethswap.Wallet
+	ethWallets ethswap.Wallets
 	dialer     func() rest.WSClient
 	restClient rest.Client
-
-	signer string
-	quit   chan struct{}
-	wg     *sync.WaitGroup
+	costs      CostEstimator
+	makers     *Makers
+	exposure   *Exposure
+
+	signer     string
+	exposureMu *sync.Mutex // makes checking the exposure and filling an order atomic
+	quit       chan struct{}
+	wg         *sync.WaitGroup
 }
 
-func New(strategies Strategies, btcWallet btcswap.Wallet, ethWallets map[model.Chain]ethswap.Wallet, restClient rest.Client, dialer func() rest.WSClient, logger *zap.Logger) Filler {
+// New returns a Filler which fills the orders matching the strategies. Orders are only filled when they are still
+// profitable after the on-chain costs estimated by the CostEstimator, a nil CostEstimator skips the cost check. The
+// makers of the orders are checked against their reputation, a nil Makers accepts all the makers. Orders are held while
+// they would exceed the exposure limits, a nil Exposure has no limits.
+func New(strategies Strategies, btcWallet btcswap.Wallet, ethWallets ethswap.Wallets, restClient rest.Client, dialer func() rest.WSClient, costs CostEstimator, makers *Makers, exposure *Exposure, logger *zap.Logger) Filler {
 	var signer string
 	for _, wallet := range ethWallets {
 		signer = strings.ToLower(wallet.Address().Hex())
@@ -49,19 +58,31 @@ func New(strategies Strategies, btcWallet btcswap.Wallet, ethWallets map[model.C
 		ethWallets: ethWallets,
 		dialer:     dialer,
 		restClient: restClient,
-
-		signer: signer,
-		quit:   make(chan struct{}),
-		wg:     new(sync.WaitGroup),
+		costs:      costs,
+		makers:     makers,
+		exposure:   exposure,
+
+		signer:     signer,
+		exposureMu: new(sync.Mutex),
+		quit:       make(chan struct{}),
+		wg:         new(sync.WaitGroup),
 	}
 }
 
 func (f *filler) Start() error {
+	for _, strategy := range f.strategies {
+		if err := f.checkWallets(strategy.OrderPair); err != nil {
+			return err
+		}
+	}
 	for _, strategy := range f.strategies {
 		matched := make(chan model.Order, 128)
 		go f.match(strategy, matched)
 		go f.fill(strategy.OrderPair, matched)
 	}
+	if f.makers != nil {
+		go f.trackMakers()
+	}
 
 	return nil
 }
@@ -102,11 +123,43 @@ func (f *filler) match(strategy Strategy, ordersChan chan<- model.Order) {
 					break Orders
 				case rest.OpenOrders:
 					orders := response.Orders
+
+					// The market is the same for all the orders of the update
+					var market Market
+					var marketErr error
+					if (strategy.Skew != nil || strategy.Rate != nil) && len(orders) != 0 {
+						market, marketErr = f.market(strategy)
+					}
 					for _, order := range orders {
 						match, err := strategy.Match(order)
 						if err != nil {
 							f.logger.Debug("❌ [Not Match]", zap.Uint("id", order.ID), zap.Error(err))
 						}
+						if match && f.exposure != nil {
+							match, err = f.exposure.Match(order)
+							if err != nil {
+								f.logger.Debug("❌ [Not Match]", zap.Uint("id", order.ID), zap.Error(err))
+							}
+						}
+						if match && f.makers != nil {
+							match, err = f.makers.Match(order)
+							if err != nil {
+								f.logger.Debug("❌ [Not Match]", zap.Uint("id", order.ID), zap.Error(err))
+							}
+						}
+						if match && (strategy.Skew != nil || strategy.Rate != nil) {
+							if marketErr != nil {
+								match, err = false, marketErr
+							} else {
+								match, err = strategy.MatchMarket(order, market)
+							}
+							if err != nil {
+								f.logger.Debug("❌ [Not Match]", zap.Uint("id", order.ID), zap.Error(err))
+							}
+						}
+						if match {
+							match = f.profitable(strategy, order, market)
+						}
 						if match {
 							ordersChan <- order
 							f.logger.Debug("✅ [Match]", zap.Uint("id", order.ID))
@@ -123,6 +176,55 @@ func (f *filler) match(strategy Strategy, ordersChan chan<- model.Order) {
 	}
 }
 
+// market returns the oracle price and our inventory of the order pair, which are only needed by the strategies with
+// skew or rate.
+func (f *filler) market(strategy Strategy) (Market, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	market := Market{}
+	if strategy.Rate != nil {
+		price, err := strategy.Rate.Oracle.Price(ctx, strategy.Rate.Receive, strategy.Rate.Send)
+		if err != nil {
+			return Market{}, fmt.Errorf("get oracle price, %v", err)
+		}
+		market.Price = price
+	}
+	if strategy.Skew != nil {
+		inventory, err := f.inventory(ctx, strategy.OrderPair)
+		if err != nil {
+			return Market{}, fmt.Errorf("get inventory, %v", err)
+		}
+		if strategy.Rate != nil {
+			inventory.Receive = strategy.Rate.Convert(inventory.Receive, market.Price)
+		}
+		market.Inventory = inventory
+	}
+	return market, nil
+}
+
+// profitable checks if the order is still profitable after the on-chain costs of filling it at the current fee rates.
+func (f *filler) profitable(strategy Strategy, order model.Order, market Market) bool {
+	if f.costs == nil {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cost, err := f.costs.Cost(ctx, order)
+	if err != nil {
+		f.logger.Debug("❌ [Not Match]", zap.Uint("id", order.ID), zap.Error(fmt.Errorf("estimate cost, %v", err)))
+		return false
+	}
+	profit, err := strategy.MatchProfit(order, market, cost)
+	if err != nil {
+		f.logger.Debug("❌ [Not Match]", zap.Uint("id", order.ID), zap.Error(err))
+		return false
+	}
+	f.logger.Debug("💰 [Profit]", zap.Uint("id", order.ID), zap.String("profit", profit.String()), zap.String("cost", cost.Total().String()))
+	return true
+}
+
 func (f *filler) fill(orderPair string, ordersChan <-chan model.Order) {
 	from, to, _, toAsset, err := model.ParseOrderPair(orderPair)
 	if err != nil {
@@ -133,33 +235,137 @@ func (f *filler) fill(orderPair string, ordersChan <-chan model.Order) {
 	// will be our address on the `from` chain, and sendAddr on the `to` chain
 	sendAddr, receiveAddr := f.addr(to), f.addr(from)
 
-	for order := range ordersChan {
-		// Fill the order in the orderbook if we have enough funds to execute. If the funds is not enough, we wait and
-		// check again later
-		func() {
-			interval := 30 * time.Second
-			ticker := time.NewTicker(interval)
-			defer ticker.Stop()
-
-			for ; ; <-ticker.C {
-				if err := f.balanceCheck(from, to, toAsset, order, interval); err != nil {
-					f.logger.Debug("balance check", zap.Error(err), zap.Uint("order", order.ID))
+	// Orders exceeding the exposure limits are held aside and retried, so they don't stall the other orders of the pair
+	held := map[uint]heldOrder{}
+	retry := time.NewTicker(30 * time.Second)
+	defer retry.Stop()
+	for {
+		select {
+		case order, ok := <-ordersChan:
+			if !ok {
+				return
+			}
+			if !f.fillFunded(order, from, to, toAsset, sendAddr, receiveAddr) {
+				delete(held, order.ID)
+			} else if _, ok := held[order.ID]; !ok {
+				held[order.ID] = heldOrder{order: order, heldAt: time.Now()}
+			}
+		case <-retry.C:
+			for id, h := range held {
+				if f.exposure.Expired(h.heldAt) {
+					f.logger.Info("⏹️ [Exposure] dropping held order", zap.Uint("order", id), zap.Time("heldAt", h.heldAt))
+					delete(held, id)
 					continue
 				}
-
-				// Fill the order in the orderbook
-				if err := f.restClient.FillOrder(order.ID, sendAddr, receiveAddr); err != nil {
-					if strings.Contains(err.Error(), "already filled") {
-						return
-					}
-					f.logger.Error("fill order", zap.Error(err), zap.Uint("order", order.ID))
-					continue
+				if !f.fillFunded(h.order, from, to, toAsset, sendAddr, receiveAddr) {
+					delete(held, id)
 				}
+			}
+		}
+	}
+}
 
-				f.logger.Info("✅ [Fill]", zap.Uint("id", order.ID))
-				return
+// heldOrder is an order held for room within the exposure limits.
+type heldOrder struct {
+	order  model.Order
+	heldAt time.Time
+}
+
+// fillFunded fills the order in the orderbook once we have enough funds to execute it. If the funds are not enough, we
+// wait and check again later. It tells if the order is held by the exposure limits instead.
+func (f *filler) fillFunded(order model.Order, from, to model.Chain, toAsset model.Asset, sendAddr, receiveAddr string) bool {
+	interval := 30 * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		if err := f.balanceCheck(from, to, toAsset, order, interval); err != nil {
+			f.logger.Debug("balance check", zap.Error(err), zap.Uint("order", order.ID))
+			continue
+		}
+
+		// Fill the order in the orderbook
+		if err := f.fillOrder(order, sendAddr, receiveAddr); err != nil {
+			if strings.Contains(err.Error(), "already filled") {
+				return false
 			}
-		}()
+			if errors.As(err, new(ExposureError)) {
+				f.logger.Info("⏸️ [Exposure] holding order", zap.Error(err), zap.Uint("order", order.ID))
+				return true
+			}
+			f.logger.Error("fill order", zap.Error(err), zap.Uint("order", order.ID))
+			continue
+		}
+
+		f.logger.Info("✅ [Fill]", zap.Uint("id", order.ID))
+		if f.makers != nil {
+			if err := f.makers.Filled(order); err != nil {
+				f.logger.Error("record maker order", zap.Error(err), zap.Uint("order", order.ID))
+			}
+		}
+		return false
+	}
+}
+
+// fillOrder fills the order in the orderbook if it's within the exposure limits.
+func (f *filler) fillOrder(order model.Order, sendAddr, receiveAddr string) error {
+	if f.exposure == nil {
+		return f.restClient.FillOrder(order.ID, sendAddr, receiveAddr)
+	}
+
+	f.exposureMu.Lock()
+	defer f.exposureMu.Unlock()
+	filled, err := f.restClient.GetOrders(rest.GetOrdersFilter{
+		Taker:   f.signer,
+		Verbose: true,
+		Status:  int(model.Filled),
+	})
+	if err != nil {
+		return err
+	}
+	asset := AssetKey(order.FollowerAtomicSwap.Chain, order.FollowerAtomicSwap.Asset)
+	usage, err := f.exposure.Usage(asset, filled)
+	if err != nil {
+		return err
+	}
+	f.logger.Info("📊 [Exposure]", zap.String("asset", asset), zap.String("outstanding", usage.Outstanding.String()), zap.String("window", usage.PerWindow.String()))
+	if err := f.exposure.Check(order, usage); err != nil {
+		return ExposureError{Err: err}
+	}
+	if err := f.restClient.FillOrder(order.ID, sendAddr, receiveAddr); err != nil {
+		return err
+	}
+	if err := f.exposure.Filled(order); err != nil {
+		f.logger.Error("record exposure fill", zap.Error(err), zap.Uint("order", order.ID))
+	}
+	return nil
+}
+
+// trackMakers records the outcomes of the orders we've filled for the reputation of their makers.
+func (f *filler) trackMakers() {
+	f.wg.Add(1)
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// Orders of any status, so we see the ones which have been executed since they were filled
+			orders, err := f.restClient.GetOrders(rest.GetOrdersFilter{
+				Taker:   f.signer,
+				Verbose: true,
+			})
+			if err != nil {
+				f.logger.Error("get our orders", zap.Error(err))
+				continue
+			}
+			if err := f.makers.Update(orders); err != nil {
+				f.logger.Error("update maker reputation", zap.Error(err))
+			}
+		case <-f.quit:
+			return
+		}
 	}
 }
 
@@ -183,7 +389,7 @@ func (f *filler) balanceCheck(from, to model.Chain, asset model.Asset, order mod
 
 	// Check the `from` chain first, we only need to make sure we have enough eth to pay the gas if it's a evm chain
 	if from.IsEVM() {
-		ethWallet := f.ethWallets[from]
+		ethWallet, _ := f.ethWallets.Chain(from)
 		ethBalance, err := ethWallet.Balance(ctx, true)
 		if err != nil {
 			return fmt.Errorf("failed to get eth balance, %v", err)
@@ -210,7 +416,7 @@ func (f *filler) balanceCheck(from, to model.Chain, asset model.Asset, order mod
 			return fmt.Errorf("%v balance is not enough, required = %v, has = %v unexecuted =%v", to, unexecuted.Int64()+amount.Int64(), balance, unexecuted.String())
 		}
 	} else {
-		wallet := f.ethWallets[to]
+		wallet, _ := f.ethWallets.Asset(to, asset)
 
 		// Check if the balance is enough
 		balance, err := wallet.TokenBalance(ctx, true)
@@ -254,10 +460,56 @@ func (f *filler) unexecutedAmount(chain model.Chain, asset model.Asset) (*big.In
 	return amount, nil
 }
 
+// incomingAmount returns the amount of the asset we'll receive from the orders we've filled but not initiated yet.
+func (f *filler) incomingAmount(chain model.Chain, asset model.Asset) (*big.Int, error) {
+	filter := rest.GetOrdersFilter{
+		Taker:   f.signer,
+		Verbose: true,
+		Status:  int(model.Filled),
+	}
+	orders, err := f.restClient.GetOrders(filter)
+	if err != nil {
+		return nil, err
+	}
+	amount := big.NewInt(0)
+	for _, order := range orders {
+		if order.InitiatorAtomicSwap.Chain == chain &&
+			order.InitiatorAtomicSwap.Asset == asset &&
+			order.FollowerAtomicSwap.Status == model.NotStarted {
+			orderAmount, ok := new(big.Int).SetString(order.InitiatorAtomicSwap.Amount, 10)
+			if !ok {
+				return nil, fmt.Errorf("invalid order amount = %v", order.InitiatorAtomicSwap.Amount)
+			}
+			amount.Add(amount, orderAmount)
+		}
+	}
+	return amount, nil
+}
+
 func (f *filler) addr(chain model.Chain) string {
 	if chain.IsBTC() {
 		return f.btcWallet.Address().EncodeAddress()
 	} else {
-		return f.ethWallets[chain].Address().Hex()
+		wallet, _ := f.ethWallets.Chain(chain)
+		return wallet.Address().Hex()
+	}
+}
+
+// checkWallets makes sure we have a wallet for the HTLC contract of each evm asset in the order pair.
+func (f *filler) checkWallets(orderPair string) error {
+	from, to, fromAsset, toAsset, err := model.ParseOrderPair(orderPair)
+	if err != nil {
+		return err
+	}
+	if from.IsEVM() {
+		if _, ok := f.ethWallets.Asset(from, fromAsset); !ok {
+			return fmt.Errorf("no wallet for %v on %v", fromAsset, from)
+		}
 	}
+	if to.IsEVM() {
+		if _, ok := f.ethWallets.Asset(to, toAsset); !ok {
+			return fmt.Errorf("no wallet for %v on %v", toAsset, to)
+		}
+	}
+	return nil
 }
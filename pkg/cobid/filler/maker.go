@@ -0,0 +1,234 @@
+package filler
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/catalogfi/ob/model"
+)
+
+// MakerList is a manual list operators can put a maker on, overriding the rules of the MakerPolicy.
+type MakerList string
+
+const (
+	MakerListNone  MakerList = ""      // the maker is judged by its history
+	MakerListAllow MakerList = "allow" // the maker is always accepted
+	MakerListDeny  MakerList = "deny"  // the maker is always rejected
+)
+
+// MakerOrder is the record of an order of a maker we've filled. The timestamps are unix seconds, 0 if it hasn't
+// happened.
+type MakerOrder struct {
+	OrderID     uint   `json:"order_id"`
+	Maker       string `json:"maker"`
+	FilledAt    int64  `json:"filled_at"`    // when we filled the order
+	InitiatedAt int64  `json:"initiated_at"` // when we saw the maker's initiation
+	CompletedAt int64  `json:"completed_at"` // when we saw our redeem of the maker's swap
+	AbandonedAt int64  `json:"abandoned_at"` // when we gave up waiting for the maker's initiation
+}
+
+// MakerStore persists the orders we've filled for each maker, and the manual maker lists.
+type MakerStore interface {
+	// StoreMakerOrder creates or updates the record of an order we've filled.
+	StoreMakerOrder(record MakerOrder) error
+
+	// GetMakerOrders returns the records of all the orders of the maker we've filled.
+	GetMakerOrders(maker string) ([]MakerOrder, error)
+
+	// SetMakerList puts the maker on a manual list, MakerListNone removes it from the lists.
+	SetMakerList(maker string, list MakerList) error
+
+	// GetMakerLists returns the makers on the manual lists.
+	GetMakerLists() (map[string]MakerList, error)
+}
+
+// MakerStats summarises the history of a maker.
+type MakerStats struct {
+	Filled        int   // orders we've filled
+	Initiated     int   // orders the maker initiated
+	Completed     int   // orders we've redeemed
+	Abandoned     int   // orders the maker never initiated
+	Pending       int   // orders we're still waiting for the maker to initiate
+	LastAbandoned int64 // unix time of the latest abandoned order
+}
+
+// NewMakerStats summarises the records of the maker. Orders which are not initiated within abandonAfter after we filled
+// them are counted as abandoned, even if we haven't seen them in the orderbook since.
+func NewMakerStats(records []MakerOrder, abandonAfter time.Duration) MakerStats {
+	stats := MakerStats{}
+	now := time.Now().Unix()
+	for _, record := range records {
+		stats.Filled++
+		abandonedAt := record.AbandonedAt
+		if abandonedAt == 0 && record.FilledAt+int64(abandonAfter.Seconds()) < now {
+			abandonedAt = record.FilledAt + int64(abandonAfter.Seconds())
+		}
+		switch {
+		case record.InitiatedAt != 0:
+			stats.Initiated++
+			if record.CompletedAt != 0 {
+				stats.Completed++
+			}
+		case abandonedAt != 0:
+			stats.Abandoned++
+			if abandonedAt > stats.LastAbandoned {
+				stats.LastAbandoned = abandonedAt
+			}
+		default:
+			stats.Pending++
+		}
+	}
+	return stats
+}
+
+// MakerPolicy decides which makers we fill the orders of, basing on their history. Zero values disable the rules.
+type MakerPolicy struct {
+	AbandonAfter    time.Duration // how long the maker has to initiate after we fill, DefaultAbandonAfter if not provided
+	Cooldown        time.Duration // no fills for the maker for this long after it abandons an order
+	MaxAbandoned    int           // blacklist the maker once it has abandoned this many orders
+	MaxAbandonRatio float64       // blacklist the maker once this share of the orders we filled are abandoned
+	MinHistory      int           // number of filled orders before MaxAbandonRatio applies
+	MaxPending      int           // maximum orders of the maker we wait to be initiated at the same time
+}
+
+// DefaultAbandonAfter is how long a maker has to initiate after we fill its order by default.
+var DefaultAbandonAfter = time.Hour
+
+// Makers keeps track of the reputation of the makers, and checks their orders against the MakerPolicy and the manual
+// maker lists.
+type Makers struct {
+	mu     *sync.Mutex
+	store  MakerStore
+	policy MakerPolicy
+}
+
+func NewMakers(store MakerStore, policy MakerPolicy) *Makers {
+	if policy.AbandonAfter <= 0 {
+		policy.AbandonAfter = DefaultAbandonAfter
+	}
+	return &Makers{
+		mu:     new(sync.Mutex),
+		store:  store,
+		policy: policy,
+	}
+}
+
+// Match checks if we should fill the order of the maker. It gives an error to indicate the unmatched reason.
+func (makers *Makers) Match(order model.Order) (bool, error) {
+	maker := strings.ToLower(order.Maker)
+	lists, err := makers.store.GetMakerLists()
+	if err != nil {
+		return false, fmt.Errorf("get maker lists, %v", err)
+	}
+	switch lists[maker] {
+	case MakerListAllow:
+		return true, nil
+	case MakerListDeny:
+		return false, fmt.Errorf("maker [%v] denied", order.Maker)
+	}
+
+	stats, err := makers.Stats(maker)
+	if err != nil {
+		return false, fmt.Errorf("get maker stats, %v", err)
+	}
+	policy := makers.policy
+	if policy.MaxAbandoned > 0 && stats.Abandoned >= policy.MaxAbandoned {
+		return false, fmt.Errorf("maker [%v] blacklisted, abandoned %v orders", order.Maker, stats.Abandoned)
+	}
+	if policy.MaxAbandonRatio > 0 && stats.Filled >= policy.MinHistory && stats.Filled > 0 {
+		if ratio := float64(stats.Abandoned) / float64(stats.Filled); ratio > policy.MaxAbandonRatio {
+			return false, fmt.Errorf("maker [%v] blacklisted, abandoned %v of %v orders", order.Maker, stats.Abandoned, stats.Filled)
+		}
+	}
+	if policy.Cooldown > 0 && stats.LastAbandoned != 0 {
+		if until := time.Unix(stats.LastAbandoned, 0).Add(policy.Cooldown); time.Now().Before(until) {
+			return false, fmt.Errorf("maker [%v] cooling down until %v", order.Maker, until)
+		}
+	}
+	if policy.MaxPending > 0 && stats.Pending >= policy.MaxPending {
+		return false, fmt.Errorf("maker [%v] has %v orders pending initiation", order.Maker, stats.Pending)
+	}
+	return true, nil
+}
+
+// Filled records that we've filled the order.
+func (makers *Makers) Filled(order model.Order) error {
+	makers.mu.Lock()
+	defer makers.mu.Unlock()
+
+	return makers.store.StoreMakerOrder(MakerOrder{
+		OrderID:  order.ID,
+		Maker:    strings.ToLower(order.Maker),
+		FilledAt: time.Now().Unix(),
+	})
+}
+
+// Update records the outcomes of the orders we've filled from their latest states in the orderbook. Orders the maker
+// hasn't initiated within AbandonAfter are marked as abandoned.
+func (makers *Makers) Update(orders []model.Order) error {
+	makers.mu.Lock()
+	defer makers.mu.Unlock()
+
+	history := map[string]map[uint]MakerOrder{}
+	now := time.Now()
+	for _, order := range orders {
+		if order.InitiatorAtomicSwap == nil {
+			continue
+		}
+		maker := strings.ToLower(order.Maker)
+		if _, ok := history[maker]; !ok {
+			records, err := makers.store.GetMakerOrders(maker)
+			if err != nil {
+				return err
+			}
+			history[maker] = map[uint]MakerOrder{}
+			for _, record := range records {
+				history[maker][record.OrderID] = record
+			}
+		}
+
+		// Orders filled before we started keeping records are counted from now
+		record, ok := history[maker][order.ID]
+		if !ok {
+			record = MakerOrder{OrderID: order.ID, Maker: maker, FilledAt: now.Unix()}
+		}
+		updated := record
+		status := order.InitiatorAtomicSwap.Status
+		if status != model.NotStarted && record.InitiatedAt == 0 {
+			updated.InitiatedAt, updated.AbandonedAt = now.Unix(), 0
+		}
+		if status == model.Redeemed && record.CompletedAt == 0 {
+			updated.CompletedAt = now.Unix()
+		}
+		if updated.InitiatedAt == 0 && record.AbandonedAt == 0 && now.Sub(time.Unix(record.FilledAt, 0)) > makers.policy.AbandonAfter {
+			updated.AbandonedAt = now.Unix()
+		}
+		if !ok || updated != record {
+			if err := makers.store.StoreMakerOrder(updated); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Stats returns the summary of the maker's history.
+func (makers *Makers) Stats(maker string) (MakerStats, error) {
+	records, err := makers.store.GetMakerOrders(strings.ToLower(maker))
+	if err != nil {
+		return MakerStats{}, err
+	}
+	return NewMakerStats(records, makers.policy.AbandonAfter), nil
+}
+
+// SetList puts the maker on a manual list, it takes effect on the next order of the maker.
+func (makers *Makers) SetList(maker string, list MakerList) error {
+	switch list {
+	case MakerListNone, MakerListAllow, MakerListDeny:
+		return makers.store.SetMakerList(strings.ToLower(maker), list)
+	default:
+		return fmt.Errorf("unknown maker list = %v", list)
+	}
+}
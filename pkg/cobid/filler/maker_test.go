@@ -0,0 +1,109 @@
+package filler_test
+
+import (
+	"time"
+
+	"github.com/catalogfi/cobi/pkg/cobid/filler"
+	"github.com/catalogfi/ob/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type memMakerStore struct {
+	orders map[string]map[uint]filler.MakerOrder
+	lists  map[string]filler.MakerList
+}
+
+func (store *memMakerStore) StoreMakerOrder(record filler.MakerOrder) error {
+	if store.orders[record.Maker] == nil {
+		store.orders[record.Maker] = map[uint]filler.MakerOrder{}
+	}
+	store.orders[record.Maker][record.OrderID] = record
+	return nil
+}
+
+func (store *memMakerStore) GetMakerOrders(maker string) ([]filler.MakerOrder, error) {
+	records := []filler.MakerOrder{}
+	for _, record := range store.orders[maker] {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (store *memMakerStore) SetMakerList(maker string, list filler.MakerList) error {
+	store.lists[maker] = list
+	return nil
+}
+
+func (store *memMakerStore) GetMakerLists() (map[string]filler.MakerList, error) {
+	return store.lists, nil
+}
+
+var _ = Describe("Maker reputation", func() {
+	var store *memMakerStore
+
+	order := func(id uint, status model.SwapStatus) model.Order {
+		o := model.Order{
+			Maker:               "0xMaker",
+			InitiatorAtomicSwap: &model.AtomicSwap{Status: status},
+		}
+		o.ID = id
+		return o
+	}
+
+	BeforeEach(func() {
+		store = &memMakerStore{
+			orders: map[string]map[uint]filler.MakerOrder{},
+			lists:  map[string]filler.MakerList{},
+		}
+	})
+
+	It("should limit the orders pending initiation", func() {
+		makers := filler.NewMakers(store, filler.MakerPolicy{MaxPending: 1})
+		Expect(makers.Match(order(1, model.NotStarted))).Should(BeTrue())
+		Expect(makers.Filled(order(1, model.NotStarted))).Should(Succeed())
+		match, err := makers.Match(order(2, model.NotStarted))
+		Expect(err).ShouldNot(BeNil())
+		Expect(match).Should(BeFalse())
+
+		By("The maker initiates")
+		Expect(makers.Update([]model.Order{order(1, model.Initiated)})).Should(Succeed())
+		Expect(makers.Match(order(2, model.NotStarted))).Should(BeTrue())
+	})
+
+	It("should record the orders the maker completes", func() {
+		makers := filler.NewMakers(store, filler.MakerPolicy{})
+		Expect(makers.Filled(order(1, model.NotStarted))).Should(Succeed())
+		Expect(makers.Update([]model.Order{order(1, model.Redeemed)})).Should(Succeed())
+		stats, err := makers.Stats("0xMaker")
+		Expect(err).Should(BeNil())
+		Expect(stats.Initiated).Should(Equal(1))
+		Expect(stats.Completed).Should(Equal(1))
+		Expect(stats.Pending).Should(Equal(0))
+	})
+
+	It("should cool down and blacklist makers who abandon orders", func() {
+		makers := filler.NewMakers(store, filler.MakerPolicy{AbandonAfter: time.Minute, Cooldown: time.Hour, MaxAbandoned: 2})
+		Expect(store.StoreMakerOrder(filler.MakerOrder{OrderID: 1, Maker: "0xmaker", FilledAt: time.Now().Add(-2 * time.Minute).Unix()})).Should(Succeed())
+		Expect(makers.Update([]model.Order{order(1, model.NotStarted)})).Should(Succeed())
+		stats, err := makers.Stats("0xMaker")
+		Expect(err).Should(BeNil())
+		Expect(stats.Abandoned).Should(Equal(1))
+		match, err := makers.Match(order(2, model.NotStarted))
+		Expect(err).Should(MatchError(ContainSubstring("cooling down")))
+		Expect(match).Should(BeFalse())
+
+		By("Abandoning another order")
+		Expect(store.StoreMakerOrder(filler.MakerOrder{OrderID: 2, Maker: "0xmaker", FilledAt: time.Now().Add(-3 * time.Hour).Unix()})).Should(Succeed())
+		_, err = makers.Match(order(3, model.NotStarted))
+		Expect(err).Should(MatchError(ContainSubstring("blacklisted")))
+
+		By("Operators override the reputation")
+		Expect(makers.SetList("0xMaker", filler.MakerListAllow)).Should(Succeed())
+		Expect(makers.Match(order(3, model.NotStarted))).Should(BeTrue())
+		Expect(makers.SetList("0xMaker", filler.MakerListDeny)).Should(Succeed())
+		match, _ = makers.Match(order(3, model.NotStarted))
+		Expect(match).Should(BeFalse())
+	})
+})
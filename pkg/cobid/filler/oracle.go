@@ -0,0 +1,213 @@
+package filler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Quote is the price of 1 unit of the base asset in the quote asset, and when it was observed.
+type Quote struct {
+	Price float64
+	Time  time.Time
+}
+
+// PriceSource gives the price of an asset in another one. Assets are identified by their symbols, like BTC or ETH.
+type PriceSource interface {
+	Quote(ctx context.Context, base, quote string) (Quote, error)
+}
+
+// PairKey returns the key of the pair in the prices of the static and file sources, like ETH/BTC.
+func PairKey(base, quote string) string {
+	return base + "/" + quote
+}
+
+// lookup finds the price of the pair, or the inverse of the reversed pair.
+func lookup(prices map[string]float64, base, quote string) (float64, error) {
+	if price, ok := prices[PairKey(base, quote)]; ok && price > 0 {
+		return price, nil
+	}
+	if price, ok := prices[PairKey(quote, base)]; ok && price > 0 {
+		return 1 / price, nil
+	}
+	return 0, fmt.Errorf("no price of %v", PairKey(base, quote))
+}
+
+// StaticSource is a PriceSource with manually set prices, which are always considered fresh.
+type StaticSource struct {
+	mu     *sync.RWMutex
+	prices map[string]float64
+}
+
+// NewStaticSource returns a StaticSource with the initial prices keyed by PairKey.
+func NewStaticSource(prices map[string]float64) StaticSource {
+	copied := make(map[string]float64, len(prices))
+	for pair, price := range prices {
+		copied[pair] = price
+	}
+	return StaticSource{
+		mu:     new(sync.RWMutex),
+		prices: copied,
+	}
+}
+
+// Set updates the price of the pair.
+func (source StaticSource) Set(base, quote string, price float64) {
+	source.mu.Lock()
+	defer source.mu.Unlock()
+
+	source.prices[PairKey(base, quote)] = price
+}
+
+func (source StaticSource) Quote(ctx context.Context, base, quote string) (Quote, error) {
+	source.mu.RLock()
+	defer source.mu.RUnlock()
+
+	price, err := lookup(source.prices, base, quote)
+	if err != nil {
+		return Quote{}, err
+	}
+	return Quote{Price: price, Time: time.Now()}, nil
+}
+
+// FileSource is a PriceSource reading a local JSON file of prices keyed by PairKey, like {"ETH/BTC": 0.05}. The prices
+// are as fresh as the modification time of the file, so it can be updated by another process.
+type FileSource struct {
+	path string
+}
+
+func NewFileSource(path string) FileSource {
+	return FileSource{path: path}
+}
+
+func (source FileSource) Quote(ctx context.Context, base, quote string) (Quote, error) {
+	info, err := os.Stat(source.path)
+	if err != nil {
+		return Quote{}, err
+	}
+	data, err := os.ReadFile(source.path)
+	if err != nil {
+		return Quote{}, err
+	}
+	prices := map[string]float64{}
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return Quote{}, fmt.Errorf("decode %v, %v", source.path, err)
+	}
+	price, err := lookup(prices, base, quote)
+	if err != nil {
+		return Quote{}, err
+	}
+	return Quote{Price: price, Time: info.ModTime()}, nil
+}
+
+// HTTPSource is a PriceSource querying a price API with `?base=<base>&quote=<quote>`. The API responds with
+// {"price": 0.05, "timestamp": 1700000000}, the timestamp is in unix seconds.
+type HTTPSource struct {
+	client *http.Client
+	url    string
+}
+
+func NewHTTPSource(url string) HTTPSource {
+	return HTTPSource{
+		client: new(http.Client),
+		url:    url,
+	}
+}
+
+func (source HTTPSource) Quote(ctx context.Context, base, quote string) (Quote, error) {
+	query := url.Values{}
+	query.Set("base", base)
+	query.Set("quote", quote)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.url+"?"+query.Encode(), nil)
+	if err != nil {
+		return Quote{}, err
+	}
+	resp, err := source.client.Do(req)
+	if err != nil {
+		return Quote{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Quote{}, fmt.Errorf("price api responds %v", resp.Status)
+	}
+
+	var result struct {
+		Price     float64 `json:"price"`
+		Timestamp int64   `json:"timestamp"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Quote{}, err
+	}
+	if result.Price <= 0 {
+		return Quote{}, fmt.Errorf("invalid price = %v", result.Price)
+	}
+	return Quote{Price: result.Price, Time: time.Unix(result.Timestamp, 0)}, nil
+}
+
+// OracleOptions are the checks an Oracle applies to the quotes of its sources.
+type OracleOptions struct {
+	MaxAge       time.Duration // quotes older than this are ignored, 0 means no limit
+	MaxDeviation float64       // maximum deviation of a quote from the median as a fraction, 0 means no limit
+}
+
+// DefaultOracleOptions ignores quotes older than 5 minutes and rejects prices the sources disagree on by more than 2%.
+var DefaultOracleOptions = OracleOptions{
+	MaxAge:       5 * time.Minute,
+	MaxDeviation: 0.02,
+}
+
+// Oracle combines the quotes of its sources into a price we trust. Stale quotes are ignored, and the price is rejected
+// if any fresh quote deviates too much from the median of them.
+type Oracle struct {
+	sources []PriceSource
+	opts    OracleOptions
+}
+
+func NewOracle(opts OracleOptions, sources ...PriceSource) *Oracle {
+	return &Oracle{
+		sources: sources,
+		opts:    opts,
+	}
+}
+
+// Price returns the median price of 1 unit of the base asset in the quote asset from the fresh quotes.
+func (oracle *Oracle) Price(ctx context.Context, base, quote string) (float64, error) {
+	prices := make([]float64, 0, len(oracle.sources))
+	var lastErr error
+	for _, source := range oracle.sources {
+		q, err := source.Quote(ctx, base, quote)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if oracle.opts.MaxAge > 0 && time.Since(q.Time) > oracle.opts.MaxAge {
+			lastErr = fmt.Errorf("stale price observed at %v", q.Time)
+			continue
+		}
+		prices = append(prices, q.Price)
+	}
+	if len(prices) == 0 {
+		return 0, fmt.Errorf("no fresh price of %v, %v", PairKey(base, quote), lastErr)
+	}
+
+	sort.Float64s(prices)
+	median := prices[len(prices)/2]
+	if len(prices)%2 == 0 {
+		median = (prices[len(prices)/2-1] + prices[len(prices)/2]) / 2
+	}
+	if oracle.opts.MaxDeviation > 0 {
+		for _, price := range prices {
+			if deviation := math.Abs(price-median) / median; deviation > oracle.opts.MaxDeviation {
+				return 0, fmt.Errorf("price of %v deviates %.2f%% from the median %v", PairKey(base, quote), deviation*100, median)
+			}
+		}
+	}
+	return median, nil
+}
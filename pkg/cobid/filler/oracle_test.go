@@ -0,0 +1,106 @@
+package filler_test
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/catalogfi/cobi/pkg/cobid/filler"
+	"github.com/catalogfi/ob/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Price oracle", func() {
+	var server *httptest.Server
+	var price float64
+	var observed time.Time
+
+	BeforeEach(func() {
+		price, observed = 0.05, time.Now()
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("base") != "ETH" || r.URL.Query().Get("quote") != "BTC" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprintf(w, `{"price": %v, "timestamp": %v}`, price, observed.Unix())
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should read the price from each source", func(ctx context.Context) {
+		static := filler.NewStaticSource(map[string]float64{"BTC/ETH": 20})
+		quote, err := static.Quote(ctx, "ETH", "BTC")
+		Expect(err).Should(BeNil())
+		Expect(quote.Price).Should(BeNumerically("~", 0.05))
+
+		path := filepath.Join(GinkgoT().TempDir(), "prices.json")
+		Expect(os.WriteFile(path, []byte(`{"ETH/BTC": 0.051}`), 0644)).Should(Succeed())
+		quote, err = filler.NewFileSource(path).Quote(ctx, "ETH", "BTC")
+		Expect(err).Should(BeNil())
+		Expect(quote.Price).Should(Equal(0.051))
+
+		quote, err = filler.NewHTTPSource(server.URL).Quote(ctx, "ETH", "BTC")
+		Expect(err).Should(BeNil())
+		Expect(quote.Price).Should(Equal(0.05))
+		_, err = filler.NewHTTPSource(server.URL).Quote(ctx, "USDC", "BTC")
+		Expect(err).ShouldNot(BeNil())
+	})
+
+	It("should ignore stale quotes", func(ctx context.Context) {
+		observed = time.Now().Add(-time.Hour)
+		oracle := filler.NewOracle(filler.DefaultOracleOptions, filler.NewHTTPSource(server.URL))
+		_, err := oracle.Price(ctx, "ETH", "BTC")
+		Expect(err).ShouldNot(BeNil())
+
+		oracle = filler.NewOracle(filler.DefaultOracleOptions, filler.NewHTTPSource(server.URL), filler.NewStaticSource(map[string]float64{"ETH/BTC": 0.0502}))
+		Expect(oracle.Price(ctx, "ETH", "BTC")).Should(Equal(0.0502))
+	})
+
+	It("should reject prices the sources disagree on", func(ctx context.Context) {
+		static := filler.NewStaticSource(map[string]float64{"ETH/BTC": 0.0501})
+		oracle := filler.NewOracle(filler.DefaultOracleOptions, filler.NewHTTPSource(server.URL), static)
+		Expect(oracle.Price(ctx, "ETH", "BTC")).Should(BeNumerically("~", 0.05005))
+
+		static.Set("ETH", "BTC", 0.06)
+		_, err := oracle.Price(ctx, "ETH", "BTC")
+		Expect(err).ShouldNot(BeNil())
+	})
+
+	It("should match orders by the oracle rate", func() {
+		strategy := filler.Strategy{
+			Fee: 10,
+			Rate: &filler.Rate{
+				Receive:         "ETH",
+				Send:            "BTC",
+				ReceiveDecimals: 18,
+				SendDecimals:    8,
+			},
+		}
+		order := model.Order{
+			InitiatorAtomicSwap: &model.AtomicSwap{Amount: "1000000000000000000"}, // 1 ETH
+			FollowerAtomicSwap:  &model.AtomicSwap{Amount: "4990000"},             // 0.0499 BTC
+		}
+		match, err := strategy.MatchMarket(order, filler.Market{Price: 0.05})
+		Expect(err).Should(BeNil())
+		Expect(match).Should(BeTrue())
+
+		match, err = strategy.MatchMarket(order, filler.Market{Price: 0.0499})
+		Expect(err).ShouldNot(BeNil())
+		Expect(match).Should(BeFalse())
+
+		// The redeem of the ETH costs 0.0004 ETH, which is 2000 sats
+		profit, err := strategy.MatchProfit(order, filler.Market{Price: 0.05}, filler.Cost{Initiate: big.NewInt(1000), Redeem: big.NewInt(4e14)})
+		Expect(err).Should(BeNil())
+		Expect(profit.Int64()).Should(Equal(int64(5000000 - 4990000 - 3000)))
+	})
+})
@@ -0,0 +1,120 @@
+package filler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/catalogfi/ob/model"
+)
+
+// SkewCurve decides how fast the fee moves as the inventory drifts away from the target.
+type SkewCurve string
+
+const (
+	SkewLinear    SkewCurve = "linear"    // the adjustment grows in proportion to the deviation
+	SkewQuadratic SkewCurve = "quadratic" // small deviations are barely priced, large ones quickly reach the maximum
+	SkewSqrt      SkewCurve = "sqrt"      // small deviations are priced early, large ones slowly reach the maximum
+)
+
+// Skew is an optional pricing model which moves the fee of a pair with our inventory. Draining the asset we're light on
+// costs more, while refilling it gets cheaper.
+type Skew struct {
+	Target float64   // target share of the asset we send in the inventory of the pair, 0.5 if not provided
+	Curve  SkewCurve // how the fee moves with the deviation from the target, linear if not provided
+	Max    int       // fee adjustment in basic point (0.01%) when the inventory is entirely in one asset
+}
+
+// Adjustment returns the fee adjustment in basic point for the share of the asset we send in the inventory. It's
+// positive when we have less than the target of the asset we send.
+func (skew Skew) Adjustment(share float64) float64 {
+	target := skew.Target
+	if target <= 0 || target >= 1 {
+		target = 0.5
+	}
+	share = math.Max(0, math.Min(1, share))
+
+	// Deviation from the target normalised to [-1, 1]
+	var deviation float64
+	if share < target {
+		deviation = (target - share) / target
+	} else {
+		deviation = -(share - target) / (1 - target)
+	}
+
+	sign := 1.0
+	if deviation < 0 {
+		sign, deviation = -1, -deviation
+	}
+	switch skew.Curve {
+	case SkewQuadratic:
+		deviation = deviation * deviation
+	case SkewSqrt:
+		deviation = math.Sqrt(deviation)
+	}
+	return sign * deviation * float64(skew.Max)
+}
+
+// Inventory is what we hold of the two assets of a pair, including the amounts committed to the orders we've filled
+// but not executed yet. Both amounts are in the unit of the order amount.
+type Inventory struct {
+	Send    *big.Int // asset we send to the maker
+	Receive *big.Int // asset we receive from the maker
+}
+
+// Share returns the share of the asset we send in the inventory, 0.5 if the inventory is empty.
+func (inventory Inventory) Share() float64 {
+	send, _ := new(big.Float).SetInt(inventory.Send).Float64()
+	receive, _ := new(big.Float).SetInt(inventory.Receive).Float64()
+	send, receive = math.Max(0, send), math.Max(0, receive)
+	if send+receive == 0 {
+		return 0.5
+	}
+	return send / (send + receive)
+}
+
+// inventory returns our inventory of the order pair. Amounts of the unexecuted orders are taken out of what we send
+// and added to what we receive.
+func (f *filler) inventory(ctx context.Context, orderPair string) (Inventory, error) {
+	from, to, fromAsset, toAsset, err := model.ParseOrderPair(orderPair)
+	if err != nil {
+		return Inventory{}, err
+	}
+	send, err := f.balance(ctx, to, toAsset)
+	if err != nil {
+		return Inventory{}, err
+	}
+	receive, err := f.balance(ctx, from, fromAsset)
+	if err != nil {
+		return Inventory{}, err
+	}
+	outgoing, err := f.unexecutedAmount(to, toAsset)
+	if err != nil {
+		return Inventory{}, err
+	}
+	incoming, err := f.incomingAmount(from, fromAsset)
+	if err != nil {
+		return Inventory{}, err
+	}
+	return Inventory{
+		Send:    send.Sub(send, outgoing),
+		Receive: receive.Add(receive, incoming),
+	}, nil
+}
+
+// balance returns our balance of the asset.
+func (f *filler) balance(ctx context.Context, chain model.Chain, asset model.Asset) (*big.Int, error) {
+	if chain.IsBTC() {
+		balance, err := f.btcWallet.Balance(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return big.NewInt(balance), nil
+	}
+	wallet, ok := f.ethWallets.Asset(chain, asset)
+	if !ok {
+		return nil, fmt.Errorf("no wallet for %v on %v", asset, chain)
+	}
+	return wallet.TokenBalance(ctx, true)
+}
@@ -0,0 +1,82 @@
+package filler_test
+
+import (
+	"math/big"
+
+	"github.com/catalogfi/cobi/pkg/cobid/filler"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Inventory skew", func() {
+	Context("when the inventory drifts from the target", func() {
+		It("should charge more to drain the asset we're light on and less to refill it", func() {
+			skew := filler.Skew{Max: 100}
+			Expect(skew.Adjustment(0.5)).Should(BeNumerically("~", 0, 1e-9))
+			Expect(skew.Adjustment(0.25)).Should(BeNumerically("~", 50, 1e-9))
+			Expect(skew.Adjustment(0)).Should(BeNumerically("~", 100, 1e-9))
+			Expect(skew.Adjustment(0.75)).Should(BeNumerically("~", -50, 1e-9))
+			Expect(skew.Adjustment(1)).Should(BeNumerically("~", -100, 1e-9))
+		})
+
+		It("should normalise the deviation on each side of the target", func() {
+			skew := filler.Skew{Max: 100, Target: 0.8}
+			Expect(skew.Adjustment(0.8)).Should(BeNumerically("~", 0, 1e-9))
+			Expect(skew.Adjustment(0.4)).Should(BeNumerically("~", 50, 1e-9))
+			Expect(skew.Adjustment(0.9)).Should(BeNumerically("~", -50, 1e-9))
+			Expect(skew.Adjustment(1)).Should(BeNumerically("~", -100, 1e-9))
+		})
+
+		It("should move the fee along the curve", func() {
+			quadratic := filler.Skew{Max: 100, Curve: filler.SkewQuadratic}
+			Expect(quadratic.Adjustment(0.25)).Should(BeNumerically("~", 25, 1e-9))
+			Expect(quadratic.Adjustment(0.75)).Should(BeNumerically("~", -25, 1e-9))
+			Expect(quadratic.Adjustment(0)).Should(BeNumerically("~", 100, 1e-9))
+
+			sqrt := filler.Skew{Max: 100, Curve: filler.SkewSqrt}
+			Expect(sqrt.Adjustment(0.375)).Should(BeNumerically("~", 50, 1e-9))
+			Expect(sqrt.Adjustment(0.625)).Should(BeNumerically("~", -50, 1e-9))
+			Expect(sqrt.Adjustment(1)).Should(BeNumerically("~", -100, 1e-9))
+		})
+
+		It("should fall back to the defaults and clamp the share", func() {
+			skew := filler.Skew{Max: 100, Target: 1}
+			Expect(skew.Adjustment(0.25)).Should(BeNumerically("~", 50, 1e-9))
+			Expect(skew.Adjustment(-1)).Should(BeNumerically("~", 100, 1e-9))
+			Expect(skew.Adjustment(2)).Should(BeNumerically("~", -100, 1e-9))
+		})
+	})
+
+	It("should tell the share of the asset we send in the inventory", func() {
+		Expect(filler.Inventory{Send: big.NewInt(1), Receive: big.NewInt(3)}.Share()).Should(BeNumerically("~", 0.25, 1e-9))
+		Expect(filler.Inventory{Send: big.NewInt(5), Receive: big.NewInt(0)}.Share()).Should(BeNumerically("~", 1, 1e-9))
+
+		By("An empty inventory is balanced")
+		Expect(filler.Inventory{Send: big.NewInt(0), Receive: big.NewInt(0)}.Share()).Should(Equal(0.5))
+
+		By("Committing more than we hold counts as having none of the asset")
+		Expect(filler.Inventory{Send: big.NewInt(-2), Receive: big.NewInt(4)}.Share()).Should(Equal(0.0))
+	})
+
+	It("should skew the price of the strategy", func() {
+		strategy := filler.Strategy{Fee: 100}
+		inventory := filler.Inventory{Send: big.NewInt(1), Receive: big.NewInt(3)}
+		Expect(strategy.PriceAt(inventory)).Should(Equal(strategy.Price()))
+
+		strategy.Skew = &filler.Skew{Max: 100}
+		Expect(strategy.PriceAt(inventory)).Should(BeNumerically("~", 10000.0/9850, 1e-9))
+	})
+
+	It("should not lower the fee below 0 when we hold too much of the asset we send", func() {
+		strategy := filler.Strategy{Fee: 30, Skew: &filler.Skew{Max: 100}}
+		inventory := filler.Inventory{Send: big.NewInt(9), Receive: big.NewInt(1)}
+		Expect(strategy.PriceAt(inventory)).Should(Equal(1.0))
+
+		By("The fee is only lowered by the skew until then")
+		inventory = filler.Inventory{Send: big.NewInt(5), Receive: big.NewInt(5)}
+		Expect(strategy.PriceAt(inventory)).Should(Equal(strategy.Price()))
+		inventory = filler.Inventory{Send: big.NewInt(6), Receive: big.NewInt(4)}
+		Expect(strategy.PriceAt(inventory)).Should(BeNumerically("~", 10000.0/(10000-10), 1e-9))
+	})
+})
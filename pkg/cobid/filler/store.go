@@ -0,0 +1,144 @@
+package filler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var KeyMakerLists = "makerLists"
+
+// Store persists the state of the filler.
+type Store interface {
+	// Store persists the reputation of the makers.
+	MakerStore
+
+	// Store also persists the orders we've filled within the exposure window.
+	ExposureStore
+}
+
+type redisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(redisURL string) (Store, error) {
+	parsedURL, err := url.Parse(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	redisPassword, _ := parsedURL.User.Password()
+	client := redis.NewClient(&redis.Options{
+		Addr:     parsedURL.Host,
+		Password: redisPassword,
+		DB:       0, // Use default DB.
+	})
+	return redisStore{client: client}, nil
+}
+
+func (rs redisStore) StoreMakerOrder(record MakerOrder) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return rs.client.HSet(ctx, makerOrdersKey(record.Maker), strconv.FormatUint(uint64(record.OrderID), 10), data).Err()
+}
+
+func (rs redisStore) GetMakerOrders(maker string) ([]MakerOrder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, err := rs.client.HGetAll(ctx, makerOrdersKey(maker)).Result()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]MakerOrder, 0, len(data))
+	for _, value := range data {
+		var record MakerOrder
+		if err := json.Unmarshal([]byte(value), &record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].FilledAt < records[j].FilledAt
+	})
+	return records, nil
+}
+
+func (rs redisStore) SetMakerList(maker string, list MakerList) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if list == MakerListNone {
+		return rs.client.HDel(ctx, KeyMakerLists, strings.ToLower(maker)).Err()
+	}
+	return rs.client.HSet(ctx, KeyMakerLists, strings.ToLower(maker), string(list)).Err()
+}
+
+func (rs redisStore) GetMakerLists() (map[string]MakerList, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	data, err := rs.client.HGetAll(ctx, KeyMakerLists).Result()
+	if err != nil {
+		return nil, err
+	}
+	lists := make(map[string]MakerList, len(data))
+	for maker, list := range data {
+		lists[maker] = MakerList(list)
+	}
+	return lists, nil
+}
+
+func (rs redisStore) StoreFill(fill ExposureFill) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(fill)
+	if err != nil {
+		return err
+	}
+	return rs.client.ZAdd(ctx, exposureFillsKey(fill.Asset), redis.Z{Score: float64(fill.FilledAt), Member: data}).Err()
+}
+
+func (rs redisStore) GetFills(asset string, since int64) ([]ExposureFill, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The fills out of the window are no longer needed
+	key := exposureFillsKey(asset)
+	if err := rs.client.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprintf("(%v", since)).Err(); err != nil {
+		return nil, err
+	}
+	data, err := rs.client.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: strconv.FormatInt(since, 10), Max: "+inf"}).Result()
+	if err != nil {
+		return nil, err
+	}
+	fills := make([]ExposureFill, 0, len(data))
+	for _, value := range data {
+		var fill ExposureFill
+		if err := json.Unmarshal([]byte(value), &fill); err != nil {
+			return nil, err
+		}
+		fills = append(fills, fill)
+	}
+	return fills, nil
+}
+
+func exposureFillsKey(asset string) string {
+	return fmt.Sprintf("exposure-fills-%v", asset)
+}
+
+func makerOrdersKey(maker string) string {
+	return fmt.Sprintf("maker-orders-%v", strings.ToLower(maker))
+}
@@ -20,6 +20,38 @@ type Strategy struct {
 	MinAmount *big.Int // minimum amount, nil means no minimum requirement
 	MaxAmount *big.Int // maximum amount, nil means no maximum requirement
 	Fee       int      // fee in basic point (0.01%)
+	MinProfit *big.Int // minimum profit after the on-chain costs, nil means the profit only needs to be non-negative
+	Skew      *Skew    // optional inventory skew pricing, nil charges the fixed fee
+	Rate      *Rate    // prices the pair with an oracle, nil means the assets of the pair are pegged 1:1
+}
+
+// Rate prices a pair whose assets are not pegged with the oracle price of the asset we receive in the asset we send.
+type Rate struct {
+	Oracle          *Oracle
+	Receive         string // symbol of the asset we receive from the maker, like ETH
+	Send            string // symbol of the asset we send to the maker, like BTC
+	ReceiveDecimals int    // decimals of the order amount of the asset we receive
+	SendDecimals    int    // decimals of the order amount of the asset we send
+}
+
+// Convert returns the value of the amount of the asset we receive in the unit of the asset we send at the price.
+func (rate Rate) Convert(amount *big.Int, price float64) *big.Int {
+	value := new(big.Float).Mul(new(big.Float).SetInt(amount), big.NewFloat(price))
+	shift := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(rate.SendDecimals-rate.ReceiveDecimals))), nil))
+	if rate.SendDecimals > rate.ReceiveDecimals {
+		value.Mul(value, shift)
+	} else {
+		value.Quo(value, shift)
+	}
+	converted, _ := value.Int(nil)
+	return converted
+}
+
+// Market is what the price of an order is checked against when it's not fixed, gathered once for all the orders of an
+// update.
+type Market struct {
+	Inventory Inventory // our inventory of the pair, in the unit of the asset we send if the strategy has a rate
+	Price     float64   // oracle price of the asset we receive in the asset we send, only set if the strategy has a rate
 }
 
 // NewStrategy returns a new strategy with
@@ -51,10 +83,27 @@ func (strategy Strategy) Price() float64 {
 	return float64(10000) / float64(10000-strategy.Fee)
 }
 
-// Match checks if the given order matches our strategy. It also gives an error to indicate the unmatched reason.
+// PriceAt returns the price when the fee is skewed by our inventory of the pair. It's the fixed price if the strategy
+// has no skew. The skew never makes us pay the maker, so the fee is at least 0.
+func (strategy Strategy) PriceAt(inventory Inventory) float64 {
+	if strategy.Skew == nil {
+		return strategy.Price()
+	}
+	fee := float64(strategy.Fee) + strategy.Skew.Adjustment(inventory.Share())
+	if fee > 9999 {
+		fee = 9999
+	}
+	if fee < 0 {
+		fee = 0
+	}
+	return float64(10000) / (10000 - fee)
+}
+
+// Match checks if the given order matches our strategy. It also gives an error to indicate the unmatched reason. The
+// price of strategies with skew or rate is checked by MatchMarket instead.
 func (strategy Strategy) Match(order model.Order) (bool, error) {
 	// Check price
-	if order.Price < strategy.Price() {
+	if strategy.Skew == nil && strategy.Rate == nil && order.Price < strategy.Price() {
 		return false, fmt.Errorf("price too low, %v < %v", order.Price, strategy.Price())
 	}
 
@@ -86,6 +135,72 @@ func (strategy Strategy) Match(order model.Order) (bool, error) {
 	return true, nil
 }
 
+// MatchMarket checks if the order pays the fee skewed by our inventory of the pair. For strategies with a rate, the
+// value of what we receive at the oracle price is compared to what we send instead of the order price.
+func (strategy Strategy) MatchMarket(order model.Order, market Market) (bool, error) {
+	required := strategy.PriceAt(market.Inventory)
+	if strategy.Rate == nil {
+		if order.Price < required {
+			return false, fmt.Errorf("price too low, %v < %v, inventory share = %.4f", order.Price, required, market.Inventory.Share())
+		}
+		return true, nil
+	}
+
+	receive, ok := new(big.Int).SetString(order.InitiatorAtomicSwap.Amount, 10)
+	if !ok {
+		return false, fmt.Errorf("invalid order amount = %v", order.InitiatorAtomicSwap.Amount)
+	}
+	send, ok := new(big.Int).SetString(order.FollowerAtomicSwap.Amount, 10)
+	if !ok || send.Sign() <= 0 {
+		return false, fmt.Errorf("invalid order amount = %v", order.FollowerAtomicSwap.Amount)
+	}
+	value, _ := new(big.Float).Quo(new(big.Float).SetInt(strategy.Rate.Convert(receive, market.Price)), new(big.Float).SetInt(send)).Float64()
+	if value < required {
+		return false, fmt.Errorf("rate too low, %v < %v, oracle price = %v", value, required, market.Price)
+	}
+	return true, nil
+}
+
+// MatchProfit checks if the order is still profitable after paying the on-chain cost of filling it. It returns the
+// expected profit, and an error to indicate the unmatched reason. For strategies with a rate, the profit is in the unit
+// of the asset we send at the oracle price of the market.
+func (strategy Strategy) MatchProfit(order model.Order, market Market, cost Cost) (*big.Int, error) {
+	receive, ok := new(big.Int).SetString(order.InitiatorAtomicSwap.Amount, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid order amount = %v", order.InitiatorAtomicSwap.Amount)
+	}
+	// The redeem is paid in the asset we receive
+	redeemCost := cost.Redeem
+	if strategy.Rate != nil {
+		receive = strategy.Rate.Convert(receive, market.Price)
+		redeemCost = strategy.Rate.Convert(redeemCost, market.Price)
+	}
+	send, ok := new(big.Int).SetString(order.FollowerAtomicSwap.Amount, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid order amount = %v", order.FollowerAtomicSwap.Amount)
+	}
+
+	// profit = receive - send - cost
+	fee := new(big.Int).Sub(receive, send)
+	profit := new(big.Int).Sub(fee, new(big.Int).Add(cost.Initiate, redeemCost))
+	minProfit := big.NewInt(0)
+	if strategy.MinProfit != nil {
+		minProfit = strategy.MinProfit
+	}
+	if profit.Cmp(minProfit) < 0 {
+		return profit, fmt.Errorf("profit(%v) lower than minimum(%v), fee = %v, initiate cost = %v, redeem cost = %v",
+			profit.String(), minProfit.String(), fee.String(), cost.Initiate.String(), redeemCost.String())
+	}
+	return profit, nil
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
 func ValidateAddress(chain model.Chain, address string) error {
 	if chain.IsEVM() {
 		if !common.IsHexAddress(address) {
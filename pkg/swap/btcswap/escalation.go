@@ -0,0 +1,136 @@
+package btcswap
+
+import (
+	"context"
+	"math"
+
+	"github.com/catalogfi/blockchain/btc"
+	"github.com/catalogfi/cobi/pkg/swap"
+)
+
+// FeeEscalation raises the fee rate of redeems and refunds as they get closer to their deadline. The fee rate starts
+// from the configured fee tier once an action is within `Horizon` blocks of its deadline and grows quadratically towards
+// `MaxMultiplier` times the fastest fee rate.
+type FeeEscalation struct {
+	Horizon       int64   // number of blocks before the deadline to start escalating, 0 disables escalation
+	UrgentBlocks  int64   // an action is urgent when its deadline is within this many blocks, which triggers RBF
+	MaxMultiplier float64 // multiplier applied to the fastest fee rate when the deadline is reached
+}
+
+// Rate returns the fee rate for an action which has `remaining` blocks before its deadline.
+func (esc FeeEscalation) Rate(base, fastest int, remaining int64) int {
+	if esc.Horizon <= 0 || remaining >= esc.Horizon {
+		return base
+	}
+	target := float64(fastest) * esc.MaxMultiplier
+	if target < float64(base) {
+		target = float64(base)
+	}
+	if remaining <= 0 {
+		return int(math.Ceil(target))
+	}
+
+	progress := float64(esc.Horizon-remaining) / float64(esc.Horizon)
+	return base + int(math.Ceil((target-float64(base))*progress*progress))
+}
+
+// CounterpartyTimelockRatio is how many times our timelock the timelock of the counterparty's swap is assumed to be.
+// We only refund the swaps we follow, and the timelock of the initiator's swap is twice the follower's. It's on another
+// chain and measured in the blocks of that chain, so it's approximated from ours instead of read from the order.
+const CounterpartyTimelockRatio = 2
+
+// Deadline returns the block height by which the action should be confirmed, 0 means there's no deadline. A redeem
+// needs to confirm before the swap expires, otherwise the counterparty can refund first. A refund needs to confirm
+// before the counterparty's swap expires, after which they could refund their side and redeem ours. The counterparty's
+// swap expiry is approximated as CounterpartyTimelockRatio times our timelock from our initiation. The counterparty
+// initiated before us, so the deadline is late by the blocks between both initiations, which the escalation horizon
+// is expected to cover.
+func (item ActionItem) Deadline() uint64 {
+	if item.Expiry == 0 {
+		return 0
+	}
+	switch item.Action {
+	case swap.ActionRedeem:
+		return item.Expiry
+	case swap.ActionRefund:
+		waitBlock := uint64(item.AtomicSwap.WaitBlock)
+		return item.Expiry - waitBlock + CounterpartyTimelockRatio*waitBlock
+	default:
+		return 0
+	}
+}
+
+// batchFeeRate returns the fee rate for a batch which includes actions with the given deadlines. It's the highest
+// escalated fee rate of all the actions.
+func (wallet *wallet) batchFeeRate(ctx context.Context, deadlines map[string]uint64) (int, error) {
+	feeRates, err := wallet.feeEstimator.FeeSuggestion()
+	if err != nil {
+		return 0, err
+	}
+	feeRate := wallet.tierFeeRate(feeRates)
+
+	if wallet.opts.Escalation.Horizon > 0 && len(deadlines) > 0 {
+		tip, err := wallet.client.GetTipBlockHeight(ctx)
+		if err != nil {
+			return 0, err
+		}
+		base := feeRate
+		for _, deadline := range deadlines {
+			rate := wallet.opts.Escalation.Rate(base, feeRates.High, int64(deadline)-int64(tip))
+			if rate > feeRate {
+				feeRate = rate
+			}
+		}
+	}
+
+	if err := wallet.checkFeeRate(feeRate); err != nil {
+		return 0, err
+	}
+	return feeRate, nil
+}
+
+// Urgent returns if any action in the batch is within the urgent threshold of its deadline and its escalated fee rate
+// is higher than the fee rate the batch was submitted with.
+func (wallet *wallet) Urgent(ctx context.Context, rbf OptionRBF) (bool, error) {
+	esc := wallet.opts.Escalation
+	if esc.Horizon <= 0 || len(rbf.PrevDeadlines) == 0 {
+		return false, nil
+	}
+
+	tip, err := wallet.client.GetTipBlockHeight(ctx)
+	if err != nil {
+		return false, err
+	}
+	urgent := map[string]uint64{}
+	for key, deadline := range rbf.PrevDeadlines {
+		if int64(deadline)-int64(tip) <= esc.UrgentBlocks {
+			urgent[key] = deadline
+		}
+	}
+	if len(urgent) == 0 {
+		return false, nil
+	}
+
+	feeRate, err := wallet.batchFeeRate(ctx, urgent)
+	if err != nil {
+		return false, err
+	}
+	return feeRate > rbf.PrevFeeRate, nil
+}
+
+func (wallet *wallet) tierFeeRate(feeRates btc.FeeSuggestion) int {
+	switch wallet.opts.FeeTier {
+	case "minimum":
+		return feeRates.Minimum
+	case "economy":
+		return feeRates.Economy
+	case "low":
+		return feeRates.Low
+	case "medium":
+		return feeRates.Medium
+	case "high":
+		return feeRates.High
+	default:
+		return feeRates.High
+	}
+}
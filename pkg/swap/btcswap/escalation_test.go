@@ -0,0 +1,56 @@
+package btcswap
+
+import (
+	"github.com/catalogfi/cobi/pkg/swap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fee escalation", func() {
+	esc := FeeEscalation{Horizon: 10, UrgentBlocks: 2, MaxMultiplier: 2}
+
+	It("should use the base fee rate outside the horizon or when disabled", func() {
+		Expect(esc.Rate(5, 20, 10)).Should(Equal(5))
+		Expect(esc.Rate(5, 20, 100)).Should(Equal(5))
+		Expect(FeeEscalation{}.Rate(5, 20, 0)).Should(Equal(5))
+	})
+
+	It("should grow quadratically towards the multiple of the fastest fee rate", func() {
+		// target = 40, progress = 0.5, 5 + ceil(35 * 0.25)
+		Expect(esc.Rate(5, 20, 5)).Should(Equal(14))
+		// progress = 0.9, 5 + ceil(35 * 0.81)
+		Expect(esc.Rate(5, 20, 1)).Should(Equal(34))
+		Expect(esc.Rate(5, 20, 0)).Should(Equal(40))
+		Expect(esc.Rate(5, 20, -3)).Should(Equal(40))
+	})
+
+	It("should never go below the base fee rate", func() {
+		Expect(esc.Rate(50, 20, 5)).Should(Equal(50))
+		Expect(esc.Rate(50, 20, 0)).Should(Equal(50))
+	})
+
+	It("should give redeems and refunds a deadline", func() {
+		item := ActionItem{Action: swap.ActionRedeem, Expiry: 100, AtomicSwap: Swap{WaitBlock: 6}}
+		Expect(item.Deadline()).Should(Equal(uint64(100)))
+
+		item.Action = swap.ActionRefund
+		Expect(item.Deadline()).Should(Equal(uint64(106)))
+
+		item.Action = swap.ActionInitiate
+		Expect(item.Deadline()).Should(Equal(uint64(0)))
+
+		item.Action, item.Expiry = swap.ActionRedeem, 0
+		Expect(item.Deadline()).Should(Equal(uint64(0)))
+	})
+
+	It("should assume the counterparty's timelock is twice ours for refunds", func() {
+		// Our swap is initiated at 1000 with a timelock of 144 blocks, the counterparty's one expires 288 blocks after
+		item := ActionItem{Action: swap.ActionRefund, Expiry: 1144, AtomicSwap: Swap{WaitBlock: 144}}
+		Expect(CounterpartyTimelockRatio).Should(Equal(2))
+		Expect(item.Deadline()).Should(Equal(uint64(1288)))
+
+		By("The refund has as many blocks before its deadline as the timelock")
+		Expect(item.Deadline() - item.Expiry).Should(Equal(uint64(item.AtomicSwap.WaitBlock)))
+	})
+})
@@ -0,0 +1,124 @@
+package btcswap
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FeeBudgetWindow is the length of the rolling window used by the daily fee budget.
+const FeeBudgetWindow = 24 * time.Hour
+
+var (
+	FeeLimitRate   = "max fee rate"
+	FeeLimitRatio  = "max fee ratio"
+	FeeLimitBudget = "daily fee budget"
+)
+
+// FeeLimitError is returned when a tx would break one of the fee guardrails configured in the Options. The tx is not
+// broadcast when this error is returned.
+type FeeLimitError struct {
+	Limit  string  // which limit has been hit
+	Value  float64 // the value we were about to use
+	Allows float64 // the maximum value allowed by the limit
+}
+
+func (err FeeLimitError) Error() string {
+	return fmt.Sprintf("%v exceeded, value = %v, allows = %v", err.Limit, err.Value, err.Allows)
+}
+
+type feeRecord struct {
+	timestamp time.Time
+	amount    int64
+}
+
+// feeTracker keeps track of the fees we spent in the last FeeBudgetWindow.
+type feeTracker struct {
+	mu      *sync.Mutex
+	records []feeRecord
+}
+
+func newFeeTracker() *feeTracker {
+	return &feeTracker{
+		mu:      new(sync.Mutex),
+		records: []feeRecord{},
+	}
+}
+
+// Spent returns the total fees spent in the current window.
+func (tracker *feeTracker) Spent() int64 {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	tracker.prune()
+	total := int64(0)
+	for _, record := range tracker.records {
+		total += record.amount
+	}
+	return total
+}
+
+// Add records the fees of a broadcast tx. For a RBF replacement, only the extra fees on top of the replaced tx should
+// be recorded.
+func (tracker *feeTracker) Add(amount int64) {
+	if amount <= 0 {
+		return
+	}
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	tracker.records = append(tracker.records, feeRecord{
+		timestamp: time.Now(),
+		amount:    amount,
+	})
+}
+
+func (tracker *feeTracker) prune() {
+	cutoff := time.Now().Add(-FeeBudgetWindow)
+	i := 0
+	for ; i < len(tracker.records); i++ {
+		if tracker.records[i].timestamp.After(cutoff) {
+			break
+		}
+	}
+	tracker.records = tracker.records[i:]
+}
+
+// checkFeeRate makes sure the fee rate is not higher than the configured maximum.
+func (wallet *wallet) checkFeeRate(feeRate int) error {
+	if wallet.opts.MaxFeeRate > 0 && feeRate > wallet.opts.MaxFeeRate {
+		return FeeLimitError{
+			Limit:  FeeLimitRate,
+			Value:  float64(feeRate),
+			Allows: float64(wallet.opts.MaxFeeRate),
+		}
+	}
+	return nil
+}
+
+// checkFee makes sure the fee of a tx moving `value` sats is within the configured ratio, and the `extra` fees it adds
+// on top of what we have spent is within the daily budget.
+func (wallet *wallet) checkFee(fee, extra int64, value int64) error {
+	if wallet.opts.MaxFeeRatio > 0 && value > 0 {
+		ratio := float64(fee) * 100 / float64(value)
+		if ratio > wallet.opts.MaxFeeRatio {
+			return FeeLimitError{
+				Limit:  FeeLimitRatio,
+				Value:  ratio,
+				Allows: wallet.opts.MaxFeeRatio,
+			}
+		}
+	}
+	if wallet.opts.DailyFeeBudget > 0 {
+		spent := wallet.fees.Spent()
+		if spent+extra > wallet.opts.DailyFeeBudget {
+			return FeeLimitError{
+				Limit:  FeeLimitBudget,
+				Value:  float64(spent + extra),
+				Allows: float64(wallet.opts.DailyFeeBudget),
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package btcswap
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fee guardrails", func() {
+	Context("fee tracker", func() {
+		It("should sum the fees spent in the window and ignore non-positive amounts", func() {
+			tracker := newFeeTracker()
+			tracker.Add(1000)
+			tracker.Add(500)
+			tracker.Add(0)
+			tracker.Add(-200)
+			Expect(tracker.Spent()).Should(Equal(int64(1500)))
+		})
+
+		It("should forget the fees spent before the window", func() {
+			tracker := newFeeTracker()
+			tracker.records = append(tracker.records, feeRecord{
+				timestamp: time.Now().Add(-FeeBudgetWindow - time.Minute),
+				amount:    1000,
+			})
+			tracker.Add(300)
+			Expect(tracker.Spent()).Should(Equal(int64(300)))
+			Expect(tracker.records).Should(HaveLen(1))
+		})
+	})
+
+	Context("fee checks", func() {
+		It("should reject fee rates over the maximum", func() {
+			wallet := &wallet{opts: Options{MaxFeeRate: 50}, fees: newFeeTracker()}
+			Expect(wallet.checkFeeRate(50)).Should(Succeed())
+
+			err := wallet.checkFeeRate(51)
+			Expect(err).Should(Equal(FeeLimitError{Limit: FeeLimitRate, Value: 51, Allows: 50}))
+		})
+
+		It("should not limit anything when the guardrails are not configured", func() {
+			wallet := &wallet{fees: newFeeTracker()}
+			Expect(wallet.checkFeeRate(10000)).Should(Succeed())
+			Expect(wallet.checkFee(1e6, 1e6, 1000)).Should(Succeed())
+		})
+
+		It("should reject fees over the ratio of the value moved", func() {
+			wallet := &wallet{opts: Options{MaxFeeRatio: 1}, fees: newFeeTracker()}
+			Expect(wallet.checkFee(1000, 1000, 100000)).Should(Succeed())
+			Expect(wallet.checkFee(1000, 1000, 0)).Should(Succeed())
+
+			err := wallet.checkFee(2000, 2000, 100000)
+			Expect(err).Should(Equal(FeeLimitError{Limit: FeeLimitRatio, Value: 2, Allows: 1}))
+		})
+
+		It("should reject extra fees over the daily budget", func() {
+			wallet := &wallet{opts: Options{DailyFeeBudget: 5000}, fees: newFeeTracker()}
+			wallet.fees.Add(4000)
+			Expect(wallet.checkFee(1000, 1000, 100000)).Should(Succeed())
+
+			// Only the extra fees of a replacement count towards the budget
+			Expect(wallet.checkFee(3000, 1000, 100000)).Should(Succeed())
+
+			err := wallet.checkFee(1500, 1500, 100000)
+			Expect(err).Should(Equal(FeeLimitError{Limit: FeeLimitBudget, Value: 5500, Allows: 5000}))
+		})
+	})
+})
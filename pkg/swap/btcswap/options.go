@@ -9,11 +9,26 @@ import (
 
 const DefaultMinRelayFee = 1
 
+// DefaultFeeEscalation starts escalating fees a day before the deadline and treats the last 6 blocks as urgent.
+var DefaultFeeEscalation = FeeEscalation{
+	Horizon:       144,
+	UrgentBlocks:  6,
+	MaxMultiplier: 2,
+}
+
 type Options struct {
 	Network     *chaincfg.Params
 	AddressType waddrmgr.AddressType
 	FeeTier     string
 	MinRelayFee int
+
+	MaxFeeRate     int     // maximum fee rate in sats/vB, 0 means no limit
+	MaxFeeRatio    float64 // maximum fee as a percentage of the value moved by a tx, 0 means no limit
+	DailyFeeBudget int64   // maximum fees in sats spent in a rolling 24-hour window, 0 means no limit
+
+	Escalation FeeEscalation // deadline-aware fee escalation for redeems and refunds
+
+	Sweep SweepPolicy // moves the excess funds of the hot wallet to cold storage
 }
 
 func NewWalletOptions(network *chaincfg.Params) Options {
@@ -35,6 +50,7 @@ func OptionsMainnet() Options {
 		AddressType: waddrmgr.WitnessPubKey,
 		FeeTier:     "high",
 		MinRelayFee: DefaultMinRelayFee,
+		Escalation:  DefaultFeeEscalation,
 	}
 }
 
@@ -44,6 +60,7 @@ func OptionsTestnet() Options {
 		AddressType: waddrmgr.WitnessPubKey,
 		FeeTier:     "medium",
 		MinRelayFee: DefaultMinRelayFee,
+		Escalation:  DefaultFeeEscalation,
 	}
 }
 
@@ -75,3 +92,28 @@ func (opts Options) WithMinRelayFee(min int) Options {
 	opts.MinRelayFee = min
 	return opts
 }
+
+func (opts Options) WithMaxFeeRate(max int) Options {
+	opts.MaxFeeRate = max
+	return opts
+}
+
+func (opts Options) WithMaxFeeRatio(percentage float64) Options {
+	opts.MaxFeeRatio = percentage
+	return opts
+}
+
+func (opts Options) WithDailyFeeBudget(budget int64) Options {
+	opts.DailyFeeBudget = budget
+	return opts
+}
+
+func (opts Options) WithEscalation(escalation FeeEscalation) Options {
+	opts.Escalation = escalation
+	return opts
+}
+
+func (opts Options) WithSweep(sweep SweepPolicy) Options {
+	opts.Sweep = sweep
+	return opts
+}
@@ -0,0 +1,127 @@
+package btcswap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/catalogfi/blockchain/btc"
+)
+
+// SweepPolicy moves the funds above a target balance out of the hot wallet. The excess is paid as an extra output of
+// the batch txs, so sweeping doesn't cost an extra tx.
+type SweepPolicy struct {
+	TargetBalance int64  // balance in sats to keep in the hot wallet
+	MinAmount     int64  // minimum amount worth sweeping, smaller excess stays in the hot wallet
+	Address       string // cold storage address
+	XPub          string // extended public key to derive a new cold address for each sweep, used when Address is empty
+}
+
+// Enabled tells if we have somewhere to sweep the funds to.
+func (policy SweepPolicy) Enabled() bool {
+	return policy.Address != "" || policy.XPub != ""
+}
+
+// Sweep is the output of a batch tx which moves the excess funds to cold storage.
+type Sweep struct {
+	To     string `json:"to"`     // cold storage address
+	Amount int64  `json:"amount"` // amount in sats
+	Index  uint32 `json:"index"`  // derivation index of the address when it's derived from the xpub
+}
+
+// sweepAddress returns the cold storage address. When it's derived from the xpub, the address at `index` of the
+// external chain is used.
+func (wallet *wallet) sweepAddress(index uint32) (btcutil.Address, error) {
+	policy := wallet.opts.Sweep
+	if policy.Address != "" {
+		return btcutil.DecodeAddress(policy.Address, wallet.opts.Network)
+	}
+
+	key, err := hdkeychain.NewKeyFromString(policy.XPub)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sweep xpub, %v", err)
+	}
+	if key.IsPrivate() {
+		return nil, fmt.Errorf("sweep xpub must be a public key")
+	}
+	external, err := key.Derive(0)
+	if err != nil {
+		return nil, err
+	}
+	child, err := external.Derive(index)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := child.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+	return btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(pubKey.SerializeCompressed()), wallet.opts.Network)
+}
+
+// sweep decides how much of the funds should be swept by the batch tx. The hot wallet balance after the tx is the
+// change of the tx plus our confirmed utxos which are not used by any batch. Anything above the target balance is
+// swept, but never more than the change of the tx, since the rest of the funds are not spent by it. It returns nil if
+// there's nothing worth sweeping.
+func (wallet *wallet) sweep(ctx context.Context, tx *wire.MsgTx, feeRate int, rbf OptionRBF) (*Sweep, error) {
+	policy := wallet.opts.Sweep
+	if !policy.Enabled() {
+		return nil, nil
+	}
+
+	walletScript, err := txscript.PayToAddrScript(wallet.address)
+	if err != nil {
+		return nil, err
+	}
+	change := int64(0)
+	for _, out := range tx.TxOut {
+		if bytes.Equal(out.PkScript, walletScript) {
+			change += out.Value
+		}
+	}
+
+	// Wallet utxos which are not spent by the tx or reserved by other batches
+	utxos, err := wallet.client.GetUTXOs(ctx, wallet.address)
+	if err != nil {
+		return nil, err
+	}
+	utxos = wallet.removeUnconfirmedUtxo(utxos)
+	used := append([]string{}, rbf.ExcludedUtxos...)
+	for _, in := range tx.TxIn {
+		used = append(used, fmt.Sprintf("%v-%v", in.PreviousOutPoint.Hash.String(), in.PreviousOutPoint.Index))
+	}
+	untouched := utxosValue(removeExcludedUtxo(utxos, used))
+
+	// Use the same address for all the txs of a batch
+	index := rbf.SweepIndex
+	if rbf.Sweep != nil {
+		index = rbf.Sweep.Index
+	}
+	to, err := wallet.sweepAddress(index)
+	if err != nil {
+		return nil, err
+	}
+	toScript, err := txscript.PayToAddrScript(to)
+	if err != nil {
+		return nil, err
+	}
+
+	// The extra output needs to pay for itself
+	outputFee := int64(wire.NewTxOut(0, toScript).SerializeSize() * feeRate)
+	amount := untouched + change - policy.TargetBalance - outputFee
+	if amount > change-outputFee {
+		amount = change - outputFee
+	}
+	if amount < policy.MinAmount || amount <= btc.DustAmount {
+		return nil, nil
+	}
+	return &Sweep{
+		To:     to.EncodeAddress(),
+		Amount: amount,
+		Index:  index,
+	}, nil
+}
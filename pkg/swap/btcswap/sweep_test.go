@@ -0,0 +1,116 @@
+package btcswap
+
+import (
+	"context"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/catalogfi/blockchain/btc"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type utxoIndexer struct {
+	btc.IndexerClient
+	utxos btc.UTXOs
+}
+
+func (indexer utxoIndexer) GetUTXOs(ctx context.Context, address btcutil.Address) (btc.UTXOs, error) {
+	return indexer.utxos, nil
+}
+
+var _ = Describe("Sweeping", func() {
+	network := &chaincfg.RegressionNetParams
+	newAddress := func() btcutil.Address {
+		key, err := btcec.NewPrivateKey()
+		Expect(err).Should(BeNil())
+		addr, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(key.PubKey().SerializeCompressed()), network)
+		Expect(err).Should(BeNil())
+		return addr
+	}
+	utxo := func(b byte, amount int64, confirmed bool) btc.UTXO {
+		hash := chainhash.Hash{b}
+		return btc.UTXO{TxID: hash.String(), Vout: 0, Amount: amount, Status: &btc.Status{Confirmed: confirmed}}
+	}
+
+	var w *wallet
+	var tx *wire.MsgTx
+	var spent, excluded btc.UTXO
+	feeRate := 10
+	outputFee := int64(31 * feeRate) // p2wpkh output
+	BeforeEach(func() {
+		spent, excluded = utxo(1, 1e6, true), utxo(3, 2e6, true)
+		w = &wallet{
+			opts:    OptionsRegression(),
+			address: newAddress(),
+			client: utxoIndexer{utxos: btc.UTXOs{
+				spent,
+				utxo(2, 500000, true),
+				utxo(4, 1e6, false),
+				excluded,
+			}},
+		}
+		w.opts.Sweep = SweepPolicy{Address: newAddress().EncodeAddress(), MinAmount: 1000}
+
+		// The tx spends one of our utxos, pays 690000 to a swap and 300000 back to us as change
+		walletScript, err := txscript.PayToAddrScript(w.address)
+		Expect(err).Should(BeNil())
+		swapScript, err := txscript.PayToAddrScript(newAddress())
+		Expect(err).Should(BeNil())
+		tx = wire.NewMsgTx(2)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+		tx.AddTxOut(wire.NewTxOut(690000, swapScript))
+		tx.AddTxOut(wire.NewTxOut(300000, walletScript))
+	})
+
+	It("should not sweep when there's no cold address", func() {
+		w.opts.Sweep = SweepPolicy{TargetBalance: 0}
+		Expect(w.sweep(context.Background(), tx, feeRate, OptionRBF{})).Should(BeNil())
+	})
+
+	It("should sweep the balance above the target", func() {
+		// 500000 untouched + 300000 change, the excluded and unconfirmed utxos don't count
+		w.opts.Sweep.TargetBalance = 700000
+		sweep, err := w.sweep(context.Background(), tx, feeRate, OptionRBF{ExcludedUtxos: []string{UtxoKey(excluded)}})
+		Expect(err).Should(BeNil())
+		Expect(sweep).ShouldNot(BeNil())
+		Expect(sweep.Amount).Should(Equal(100000 - outputFee))
+		Expect(sweep.To).Should(Equal(w.opts.Sweep.Address))
+	})
+
+	It("should never sweep more than the change of the tx", func() {
+		w.opts.Sweep.TargetBalance = 100000
+		sweep, err := w.sweep(context.Background(), tx, feeRate, OptionRBF{ExcludedUtxos: []string{UtxoKey(excluded)}})
+		Expect(err).Should(BeNil())
+		Expect(sweep.Amount).Should(Equal(300000 - outputFee))
+	})
+
+	It("should not sweep amounts below the minimum", func() {
+		w.opts.Sweep.TargetBalance = 700000
+		w.opts.Sweep.MinAmount = 100000
+		sweep, err := w.sweep(context.Background(), tx, feeRate, OptionRBF{ExcludedUtxos: []string{UtxoKey(excluded)}})
+		Expect(err).Should(BeNil())
+		Expect(sweep).Should(BeNil())
+
+		w.opts.Sweep.MinAmount = 0
+		w.opts.Sweep.TargetBalance = 800000 - outputFee - btc.DustAmount
+		sweep, err = w.sweep(context.Background(), tx, feeRate, OptionRBF{ExcludedUtxos: []string{UtxoKey(excluded)}})
+		Expect(err).Should(BeNil())
+		Expect(sweep).Should(BeNil())
+	})
+
+	It("should keep the derivation index of the batch", func() {
+		sweep, err := w.sweep(context.Background(), tx, feeRate, OptionRBF{SweepIndex: 5})
+		Expect(err).Should(BeNil())
+		Expect(sweep.Index).Should(Equal(uint32(5)))
+
+		sweep, err = w.sweep(context.Background(), tx, feeRate, OptionRBF{SweepIndex: 5, Sweep: &Sweep{Index: 3}})
+		Expect(err).Should(BeNil())
+		Expect(sweep.Index).Should(Equal(uint32(3)))
+	})
+})
@@ -22,6 +22,23 @@ type ActionItem struct {
 	Action     swap.Action
 	AtomicSwap Swap
 	Secret     []byte
+	Expiry     uint64 // block height at which the swap expires, 0 if unknown
+}
+
+// TxInVirtualSize is the virtual size of a tx input excluding the witness (outpoint + sequence + empty sigScript).
+const TxInVirtualSize = 41
+
+// SpendVirtualSize estimates the virtual size added to a tx by spending the swap utxo of a redeem or refund action. It
+// returns 0 for initiations since they don't spend any swap utxo.
+func (item ActionItem) SpendVirtualSize() int {
+	switch item.Action {
+	case swap.ActionRedeem:
+		return TxInVirtualSize + (btc.RedeemHtlcRedeemSigScriptSize(len(item.Secret))+3)/4
+	case swap.ActionRefund:
+		return TxInVirtualSize + (btc.RedeemHtlcRefundSigScriptSize+3)/4
+	default:
+		return 0
+	}
 }
 
 func UtxoKey(utxo btc.UTXO) string {
@@ -45,9 +62,16 @@ type OptionRBF struct {
 	PrevSigScript   map[string][]byte `json:"prev_sig_script"`   // a map links the utxo to its script
 	PrevSigSecret   map[string][]byte `json:"prev_sig_secret"`   // a map links the utxo to the unlocking secret for it
 	PrevSigSequence map[string]uint32 `json:"prev_sig_sequence"` // a map links the refund utxo to its timelock
+	PrevDeadlines   map[string]uint64 `json:"prev_deadlines"`    // a map links the htlc utxo to its action deadline
 
 	FirstInputs []btc.UTXO `json:"first_inputs"` // inputs of the first tx, so we can check if the following tx has intersection
 	FirstUtxos  []btc.UTXO `json:"first_utxos"`  // available utxo list to make up amount difference
+
+	PrevInputs    []btc.UTXO `json:"prev_inputs"`    // all inputs of the previous tx
+	ExcludedUtxos []string   `json:"excluded_utxos"` // wallet utxos reserved by other batches, which the first tx must not use
+
+	Sweep      *Sweep `json:"sweep"`       // sweep output of the previous tx, nil if it didn't sweep
+	SweepIndex uint32 `json:"sweep_index"` // derivation index of the sweep address if the batch starts sweeping
 }
 
 func CopyRBF(opts OptionRBF) OptionRBF {
@@ -65,9 +89,15 @@ func CopyRBF(opts OptionRBF) OptionRBF {
 		PrevSigScript:   map[string][]byte{},
 		PrevSigSecret:   map[string][]byte{},
 		PrevSigSequence: map[string]uint32{},
+		PrevDeadlines:   map[string]uint64{},
 
 		FirstInputs: make([]btc.UTXO, len(opts.FirstInputs)),
 		FirstUtxos:  make([]btc.UTXO, len(opts.FirstUtxos)),
+
+		PrevInputs:    make([]btc.UTXO, len(opts.PrevInputs)),
+		ExcludedUtxos: make([]string, len(opts.ExcludedUtxos)),
+
+		SweepIndex: opts.SweepIndex,
 	}
 	for i, utxo := range opts.PrevRawInputs.VIN {
 		newOptions.PrevRawInputs.VIN[i] = utxo
@@ -87,16 +117,49 @@ func CopyRBF(opts OptionRBF) OptionRBF {
 	for key, sequence := range opts.PrevSigSequence {
 		newOptions.PrevSigSequence[key] = sequence
 	}
+	for key, deadline := range opts.PrevDeadlines {
+		newOptions.PrevDeadlines[key] = deadline
+	}
 	for i, utxo := range opts.FirstInputs {
 		newOptions.FirstInputs[i] = utxo
 	}
 	for i, utxo := range opts.FirstUtxos {
 		newOptions.FirstUtxos[i] = utxo
 	}
+	for i, utxo := range opts.PrevInputs {
+		newOptions.PrevInputs[i] = utxo
+	}
+	for i, key := range opts.ExcludedUtxos {
+		newOptions.ExcludedUtxos[i] = key
+	}
+	if opts.Sweep != nil {
+		sweep := *opts.Sweep
+		newOptions.Sweep = &sweep
+	}
 
 	return newOptions
 }
 
+// SealRBF returns the rbf options of a batch which won't take any new actions. The wallet utxos spent by the previous
+// tx are pinned as raw inputs and the rest of the available utxos are released, so they can be used by other batches.
+// Following txs can only bump the fees by reducing the change.
+func SealRBF(opts OptionRBF) OptionRBF {
+	newOptions := CopyRBF(opts)
+	pinned := map[string]struct{}{}
+	for _, utxo := range newOptions.PrevRawInputs.VIN {
+		pinned[UtxoKey(utxo)] = struct{}{}
+	}
+	for _, utxo := range opts.PrevInputs {
+		if _, ok := pinned[UtxoKey(utxo)]; ok {
+			continue
+		}
+		newOptions.PrevRawInputs.VIN = append(newOptions.PrevRawInputs.VIN, utxo)
+		newOptions.PrevRawInputs.SegwitSize += txsizes.RedeemP2WPKHInputWitnessWeight
+	}
+	newOptions.FirstUtxos = []btc.UTXO{}
+	return newOptions
+}
+
 type Wallet interface {
 	Address() btcutil.Address
 
@@ -104,10 +167,14 @@ type Wallet interface {
 
 	Indexer() btc.IndexerClient
 
+	FeeRate() (int, error)
+
 	BatchExecute(ctx context.Context, actions []ActionItem) (string, error)
 
 	ExecuteRbf(ctx context.Context, actions []ActionItem, rbf OptionRBF) (string, OptionRBF, error)
 
+	Urgent(ctx context.Context, rbf OptionRBF) (bool, error)
+
 	Initiate(ctx context.Context, swap Swap) (string, error)
 
 	Redeem(ctx context.Context, swap Swap, secret []byte, target string) (string, error)
@@ -122,6 +189,7 @@ type wallet struct {
 	feeEstimator btc.FeeEstimator
 	key          *btcec.PrivateKey
 	address      btcutil.Address
+	fees         *feeTracker
 }
 
 func NewWallet(opts Options, client btc.IndexerClient, key *btcec.PrivateKey, estimator btc.FeeEstimator) (Wallet, error) {
@@ -130,14 +198,21 @@ func NewWallet(opts Options, client btc.IndexerClient, key *btcec.PrivateKey, es
 		return nil, fmt.Errorf("fail to parse wallet address, %v", err)
 	}
 
-	return &wallet{
+	w := &wallet{
 		mu:           new(sync.RWMutex),
 		opts:         opts,
 		client:       client,
 		feeEstimator: estimator,
 		key:          key,
 		address:      addr,
-	}, nil
+		fees:         newFeeTracker(),
+	}
+	if opts.Sweep.Enabled() {
+		if _, err := w.sweepAddress(0); err != nil {
+			return nil, fmt.Errorf("fail to parse sweep address, %v", err)
+		}
+	}
+	return w, nil
 }
 
 func (wallet *wallet) Address() btcutil.Address {
@@ -316,10 +391,24 @@ func (wallet *wallet) BatchExecute(ctx context.Context, actions []ActionItem) (s
 		}
 	}
 
+	// Make sure the fees are within our limits
+	value := int64(0)
+	for _, recipient := range recipients {
+		value += recipient.Amount
+	}
+	for _, utxo := range rawInputs.VIN {
+		value += utxo.Amount
+	}
+	fee := int64(btc.TotalFee(tx, fetcher))
+	if err := wallet.checkFee(fee, fee, value); err != nil {
+		return "", err
+	}
+
 	// Submit the transaction
 	if err := wallet.client.SubmitTx(ctx, tx); err != nil {
 		return "", err
 	}
+	wallet.fees.Add(fee)
 	return tx.TxHash().String(), nil
 }
 
@@ -388,6 +477,9 @@ func (wallet *wallet) ExecuteRbf(ctx context.Context, actions []ActionItem, rbf
 				newRbf.PrevSigType[UtxoKey(utxo)] = SigTypeRedeemHTLC
 				newRbf.PrevSigScript[UtxoKey(utxo)] = action.AtomicSwap.Script
 				newRbf.PrevSigSecret[UtxoKey(utxo)] = action.Secret
+				if deadline := action.Deadline(); deadline != 0 {
+					newRbf.PrevDeadlines[UtxoKey(utxo)] = deadline
+				}
 			}
 			newRbf.PrevRawInputs.VIN = append(newRbf.PrevRawInputs.VIN, utxos...)
 			newRbf.PrevRawInputs.SegwitSize += len(utxos) * btc.RedeemHtlcRedeemSigScriptSize(len(action.Secret))
@@ -418,6 +510,9 @@ func (wallet *wallet) ExecuteRbf(ctx context.Context, actions []ActionItem, rbf
 				newRbf.PrevSigType[UtxoKey(utxo)] = SigTypeRefundHTLC
 				newRbf.PrevSigScript[UtxoKey(utxo)] = action.AtomicSwap.Script
 				newRbf.PrevSigSequence[UtxoKey(utxo)] = uint32(action.AtomicSwap.WaitBlock)
+				if deadline := action.Deadline(); deadline != 0 {
+					newRbf.PrevDeadlines[UtxoKey(utxo)] = deadline
+				}
 			}
 
 			newRbf.PrevRawInputs.VIN = append(newRbf.PrevRawInputs.VIN, utxos...)
@@ -427,8 +522,8 @@ func (wallet *wallet) ExecuteRbf(ctx context.Context, actions []ActionItem, rbf
 		}
 	}
 
-	// Estimate the fee and considering RBF
-	feeRate, err := wallet.feeRate()
+	// Estimate the fee considering the deadlines of the actions in the batch and RBF
+	feeRate, err := wallet.batchFeeRate(ctx, newRbf.PrevDeadlines)
 	if err != nil {
 		return "", rbf, err
 	}
@@ -441,6 +536,7 @@ func (wallet *wallet) ExecuteRbf(ctx context.Context, actions []ActionItem, rbf
 			return "", rbf, err
 		}
 		utxos = wallet.removeUnconfirmedUtxo(utxos)
+		utxos = removeExcludedUtxo(utxos, rbf.ExcludedUtxos)
 	} else {
 		utxos = rbf.FirstUtxos
 	}
@@ -462,32 +558,65 @@ func (wallet *wallet) ExecuteRbf(ctx context.Context, actions []ActionItem, rbf
 		if feeRate < rbf.PrevFeeRate+wallet.opts.MinRelayFee {
 			feeRate = rbf.PrevFeeRate + wallet.opts.MinRelayFee
 		}
+		if err := wallet.checkFeeRate(feeRate); err != nil {
+			return "", rbf, err
+		}
 	}
 
-	// Build tx
-	tx, err := btc.BuildRbfTransaction(wallet.opts.Network, feeRate, newRbf.PrevRawInputs, utxos, btc.P2wpkhUpdater, newRbf.PrevRecipient, wallet.address)
-	if err != nil {
-		return "", rbf, err
-	}
-
-	// Make sure the fee meet the rbf requirement
-	if !rbfIsNil {
+	// Build tx, making sure the fee meet the rbf requirement
+	build := func(recipients []btc.Recipient) (*wire.MsgTx, int, error) {
+		feeRate := feeRate
+		tx, err := btc.BuildRbfTransaction(wallet.opts.Network, feeRate, newRbf.PrevRawInputs, utxos, btc.P2wpkhUpdater, recipients, wallet.address)
+		if err != nil {
+			return nil, 0, err
+		}
+		if rbfIsNil {
+			return tx, feeRate, nil
+		}
 		for {
 			// Estimate the tx size (rawInput.SegwitSize + P2WPKH segwit size * number of cobi utxos)
 			extraSegSize := txsizes.RedeemP2WPKHInputWitnessWeight * (len(tx.TxIn) - len(newRbf.PrevRawInputs.VIN))
 			vsize := btc.EstimateVirtualSize(tx, 0, newRbf.PrevRawInputs.SegwitSize+extraSegSize)
 			if btc.TotalFee(tx, fetcher) >= rbf.PrevFee+vsize*wallet.opts.MinRelayFee {
-				break
+				return tx, feeRate, nil
 			}
 			feeRate += 1
+			if err := wallet.checkFeeRate(feeRate); err != nil {
+				return nil, 0, err
+			}
 
 			// Build and sign again
-			tx, err = btc.BuildRbfTransaction(wallet.opts.Network, feeRate, newRbf.PrevRawInputs, utxos, btc.P2wpkhUpdater, newRbf.PrevRecipient, wallet.address)
+			tx, err = btc.BuildRbfTransaction(wallet.opts.Network, feeRate, newRbf.PrevRawInputs, utxos, btc.P2wpkhUpdater, recipients, wallet.address)
 			if err != nil {
-				return "", rbf, err
+				return nil, 0, err
 			}
 		}
 	}
+	tx, txFeeRate, err := build(newRbf.PrevRecipient)
+	if err != nil {
+		return "", rbf, err
+	}
+
+	// Sweep the excess funds to cold storage with an extra output, the tx without the sweep is used if we fail to
+	// build the sweep.
+	newRbf.Sweep = nil
+	sweep, err := wallet.sweep(ctx, tx, txFeeRate, rbf)
+	if err != nil {
+		log.Printf("failed to sweep, %v", err)
+	} else if sweep != nil {
+		recipients := append(append([]btc.Recipient{}, newRbf.PrevRecipient...), btc.Recipient{
+			To:     sweep.To,
+			Amount: sweep.Amount,
+		})
+		sweepTx, sweepFeeRate, err := build(recipients)
+		if err != nil {
+			log.Printf("failed to build the sweep, %v", err)
+		} else {
+			tx, txFeeRate = sweepTx, sweepFeeRate
+			newRbf.Sweep = sweep
+		}
+	}
+	feeRate = txFeeRate
 	log.Printf("fee rate after adjustment = %v", feeRate)
 
 	// Make sure one of the input from the first tx still exit in this transaction to prevent double initiation.
@@ -566,14 +695,40 @@ func (wallet *wallet) ExecuteRbf(ctx context.Context, actions []ActionItem, rbf
 	}
 	log.Print("raw ", hex.EncodeToString(buffer.Bytes()))
 
+	// Make sure the fees are within our limits. Only the extra fees on top of the replaced tx count towards the budget.
+	value := int64(0)
+	for _, recipient := range newRbf.PrevRecipient {
+		value += recipient.Amount
+	}
+	for _, utxo := range newRbf.PrevRawInputs.VIN {
+		sigType := newRbf.PrevSigType[UtxoKey(utxo)]
+		if sigType == SigTypeRedeemHTLC || sigType == SigTypeRefundHTLC {
+			value += utxo.Amount
+		}
+	}
+	fee := btc.TotalFee(tx, fetcher)
+	if err := wallet.checkFee(int64(fee), int64(fee-rbf.PrevFee), value); err != nil {
+		return "", rbf, err
+	}
+
 	// Submit the transaction
 	if err := wallet.client.SubmitTx(ctx, tx); err != nil {
 		return "", rbf, err
 	}
+	wallet.fees.Add(int64(fee - rbf.PrevFee))
 
 	// Update the rbf option for next tx
 	newRbf.PrevFeeRate = feeRate
-	newRbf.PrevFee = btc.TotalFee(tx, fetcher)
+	newRbf.PrevFee = fee
+	newRbf.PrevInputs = make([]btc.UTXO, len(tx.TxIn))
+	for i, in := range tx.TxIn {
+		txOut := fetcher.FetchPrevOutput(in.PreviousOutPoint)
+		newRbf.PrevInputs[i] = btc.UTXO{
+			TxID:   in.PreviousOutPoint.Hash.String(),
+			Vout:   in.PreviousOutPoint.Index,
+			Amount: txOut.Value,
+		}
+	}
 	if rbfIsNil {
 		newRbf.FirstInputs = make([]btc.UTXO, len(tx.TxIn))
 		for i, in := range tx.TxIn {
@@ -661,10 +816,17 @@ func (wallet *wallet) Initiate(ctx context.Context, swap Swap) (string, error) {
 		tx.TxIn[i].Witness = witness
 	}
 
+	// Make sure the fees are within our limits
+	fee := int64(btc.TotalFee(tx, fetcher))
+	if err := wallet.checkFee(fee, fee, swap.Amount); err != nil {
+		return "", err
+	}
+
 	// Submit the transaction and cache the result
 	if err := wallet.client.SubmitTx(ctx, tx); err != nil {
 		return "", err
 	}
+	wallet.fees.Add(fee)
 	return tx.TxHash().String(), nil
 }
 
@@ -728,10 +890,17 @@ func (wallet *wallet) Redeem(ctx context.Context, swap Swap, secret []byte, targ
 		tx.TxIn[i].Witness = btc.HtlcWitness(swap.Script, wallet.key.PubKey().SerializeCompressed(), sig, secret)
 	}
 
+	// Make sure the fees are within our limits
+	fee := int64(btc.TotalFee(tx, fetcher))
+	if err := wallet.checkFee(fee, fee, utxosValue(utxos)); err != nil {
+		return "", err
+	}
+
 	// Submit the tx
 	if err := wallet.client.SubmitTx(ctx, tx); err != nil {
 		return "", err
 	}
+	wallet.fees.Add(fee)
 	return tx.TxHash().String(), nil
 }
 
@@ -800,33 +969,37 @@ func (wallet *wallet) Refund(ctx context.Context, swap Swap, target string) (str
 		tx.TxIn[i].Witness = btc.HtlcWitness(swap.Script, wallet.key.PubKey().SerializeCompressed(), sig, nil)
 	}
 
+	// Make sure the fees are within our limits
+	fee := int64(btc.TotalFee(tx, fetcher))
+	if err := wallet.checkFee(fee, fee, utxosValue(utxos)); err != nil {
+		return "", err
+	}
+
 	// Submit the tx
 	if err := wallet.client.SubmitTx(ctx, tx); err != nil {
 		return "", err
 	}
+	wallet.fees.Add(fee)
 	return tx.TxHash().String(), nil
 }
 
+func (wallet *wallet) FeeRate() (int, error) {
+	return wallet.feeRate()
+}
+
 func (wallet *wallet) feeRate() (int, error) {
 	feeRates, err := wallet.feeEstimator.FeeSuggestion()
 	if err != nil {
 		return 0, err
 	}
 
-	switch wallet.opts.FeeTier {
-	case "minimum":
-		return feeRates.Minimum, nil
-	case "economy":
-		return feeRates.Economy, nil
-	case "low":
-		return feeRates.Low, nil
-	case "medium":
-		return feeRates.Medium, nil
-	case "high":
-		return feeRates.High, nil
-	default:
-		return feeRates.High, nil
+	feeRate := wallet.tierFeeRate(feeRates)
+
+	// Never trust the estimator blindly
+	if err := wallet.checkFeeRate(feeRate); err != nil {
+		return 0, err
 	}
+	return feeRate, nil
 }
 
 func (wallet *wallet) removeUnconfirmedUtxo(utxos []btc.UTXO) []btc.UTXO {
@@ -838,3 +1011,28 @@ func (wallet *wallet) removeUnconfirmedUtxo(utxos []btc.UTXO) []btc.UTXO {
 	}
 	return confirmedUtxos
 }
+
+func utxosValue(utxos []btc.UTXO) int64 {
+	total := int64(0)
+	for _, utxo := range utxos {
+		total += utxo.Amount
+	}
+	return total
+}
+
+func removeExcludedUtxo(utxos []btc.UTXO, excluded []string) []btc.UTXO {
+	if len(excluded) == 0 {
+		return utxos
+	}
+	excludedMap := map[string]struct{}{}
+	for _, key := range excluded {
+		excludedMap[key] = struct{}{}
+	}
+	available := make([]btc.UTXO, 0, len(utxos))
+	for _, utxo := range utxos {
+		if _, ok := excludedMap[UtxoKey(utxo)]; !ok {
+			available = append(available, utxo)
+		}
+	}
+	return available
+}
@@ -0,0 +1,272 @@
+package ethswap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/catalogfi/blockchain/evm/bindings/contracts/htlc/gardenhtlc"
+	"github.com/catalogfi/blockchain/evm/bindings/openzeppelin/contracts/token/ERC20/erc20"
+	"github.com/catalogfi/cobi/pkg/swap"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// ApprovalMode decides how much the wallet approves the HTLC contract to spend.
+type ApprovalMode string
+
+const (
+	ApprovalUnlimited  ApprovalMode = "unlimited"    // approve 2^256-1 once
+	ApprovalBounded    ApprovalMode = "bounded"      // approve a multiple of the expected volume whenever it runs low
+	ApprovalJustInTime ApprovalMode = "just-in-time" // approve the exact amount before each initiation
+)
+
+// ApprovalPolicy decides when and how much of the token the wallet approves the HTLC contract to spend.
+type ApprovalPolicy struct {
+	Mode      ApprovalMode
+	Volume    *big.Int // expected volume, the bounded mode approves Multiple times of it
+	Multiple  int64    // multiple of the volume approved by the bounded mode, default to 1
+	OnStartup bool     // whether the wallet is allowed to send an approval tx when it's created
+}
+
+// DefaultApprovalPolicy approves the exact amount before each initiation and never sends a tx on startup.
+var DefaultApprovalPolicy = ApprovalPolicy{
+	Mode: ApprovalJustInTime,
+}
+
+// EstimatedApproveGas is the rough amount of gas used by an approval of the token.
+var EstimatedApproveGas uint64 = 50000
+
+// pendingApproval is an approval we have sent but haven't seen mined yet.
+type pendingApproval struct {
+	tx   *types.Transaction
+	left *big.Int // allowance left for the initiations sent after the approval
+}
+
+// target returns the allowance to approve when the current allowance is not enough for the amount.
+func (policy ApprovalPolicy) target(amount *big.Int) (*big.Int, error) {
+	switch policy.Mode {
+	case ApprovalUnlimited:
+		return math.MaxBig256, nil
+	case ApprovalBounded:
+		if policy.Volume == nil || policy.Volume.Sign() <= 0 {
+			return nil, fmt.Errorf("bounded approval requires the expected volume")
+		}
+		multiple := policy.Multiple
+		if multiple <= 0 {
+			multiple = 1
+		}
+		bound := new(big.Int).Mul(policy.Volume, big.NewInt(multiple))
+		return maxBig(bound, amount), nil
+	case ApprovalJustInTime, "":
+		return new(big.Int).Set(amount), nil
+	default:
+		return nil, fmt.Errorf("unknown approval mode = %v", policy.Mode)
+	}
+}
+
+// startupAmount returns the amount the allowance should cover when the wallet is created, nil means no approval is
+// needed on startup.
+func (policy ApprovalPolicy) startupAmount(totalSupply *big.Int) *big.Int {
+	if !policy.OnStartup {
+		return nil
+	}
+	switch policy.Mode {
+	case ApprovalUnlimited:
+		return totalSupply
+	case ApprovalBounded:
+		return policy.Volume
+	default:
+		return nil
+	}
+}
+
+// Allowance returns the amount of token the HTLC contract is allowed to spend from the wallet. It's always nil for
+// native HTLCs.
+func (wallet *wallet) Allowance(ctx context.Context) (*big.Int, error) {
+	if wallet.options.Native {
+		return nil, nil
+	}
+	return wallet.token.Allowance(&bind.CallOpts{Context: ctx, Pending: true}, wallet.addr, wallet.options.SwapAddr)
+}
+
+// Approve sets the amount of token the HTLC contract is allowed to spend from the wallet, 0 revokes the approval.
+func (wallet *wallet) Approve(ctx context.Context, amount *big.Int) (*types.Transaction, error) {
+	if wallet.options.Native {
+		return nil, fmt.Errorf("native htlc doesn't need approvals")
+	}
+	f := func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return wallet.token.Approve(opts, wallet.options.SwapAddr, amount)
+	}
+	return wallet.transact(ctx, f)
+}
+
+// ensureAllowance makes sure the HTLC contract can spend the amount from the wallet, approving more according to the
+// approval policy when it can't. It doesn't wait for the approval to be mined, instead it returns true if the amount
+// relies on an approval which is still pending, in which case the initiation can't be estimated and the simulation at
+// the pending block decides if it's sent. Until the approval is mined, it's reused instead of approving again. The caller should hold the approval lock until the initiation is sent and
+// spent from the approval, so the approvals and the initiations relying on them are sent in order.
+func (wallet *wallet) ensureAllowance(ctx context.Context, amount *big.Int) (bool, error) {
+	if wallet.options.Native || amount == nil || amount.Sign() == 0 {
+		return false, nil
+	}
+	approval, err := wallet.pendingApproval(ctx)
+	if err != nil {
+		return false, err
+	}
+	if approval != nil {
+		// The rpc might not have the approval in its pending state yet, so we count on what's left of it.
+		if approval.left.Cmp(amount) >= 0 {
+			return true, nil
+		}
+	} else {
+		allowance, err := wallet.Allowance(ctx)
+		if err != nil {
+			return false, err
+		}
+		if allowance.Cmp(amount) >= 0 {
+			return false, nil
+		}
+	}
+
+	target, err := wallet.options.Approval.target(amount)
+	if err != nil {
+		return false, err
+	}
+	tx, err := wallet.Approve(ctx, target)
+	if err != nil {
+		return false, err
+	}
+	wallet.approval = &pendingApproval{
+		tx:   tx,
+		left: new(big.Int).Set(target),
+	}
+	return true, nil
+}
+
+// pendingApproval returns the approval we have sent if it hasn't been mined yet. An approval is forgotten once its nonce
+// is mined, by itself or by its replacement, and the allowance is read from the rpc instead. The caller should hold the
+// approval lock.
+func (wallet *wallet) pendingApproval(ctx context.Context) (*pendingApproval, error) {
+	if wallet.approval == nil {
+		return nil, nil
+	}
+	mined, err := wallet.client.NonceAt(ctx, wallet.addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	if mined > wallet.approval.tx.Nonce() {
+		wallet.approval = nil
+	}
+	return wallet.approval, nil
+}
+
+// spendApproval takes the amount of the initiations from the pending approval once they are sent. If they would revert,
+// it's most likely because the rpc doesn't see the approval yet, so a RevertPendingApproval is returned instead. The
+// caller should hold the approval lock.
+func (wallet *wallet) spendApproval(amount *big.Int, err error) error {
+	var revertErr *RevertError
+	if errors.As(err, &revertErr) {
+		return &RevertError{Reason: RevertPendingApproval}
+	}
+	if err == nil && wallet.approval != nil {
+		wallet.approval.left.Sub(wallet.approval.left, amount)
+	}
+	return err
+}
+
+// unestimatedGas returns the gas limit of a tx making the calls when they rely on an approval which isn't mined yet, so
+// they can't be estimated. It doubles the rough gas of the calls to leave a margin.
+func unestimatedGas(calls []Call) uint64 {
+	gas := params.TxGas
+	for _, call := range calls {
+		gas += 2 * EstimatedGas[call.Action]
+	}
+	return gas
+}
+
+// initiateGas returns the gas limit of a single initiation which can't be estimated.
+func initiateGas() uint64 {
+	return unestimatedGas([]Call{{Action: swap.ActionInitiate}})
+}
+
+// approvalGas returns the gas of the approval an initiation is expected to need. Just-in-time approvals are sent
+// before every initiation, while the other modes only approve when the allowance runs out.
+func (wallet *wallet) approvalGas(ctx context.Context) (uint64, error) {
+	if wallet.options.Native {
+		return 0, nil
+	}
+	switch wallet.options.Approval.Mode {
+	case ApprovalJustInTime, "":
+		return EstimatedApproveGas, nil
+	default:
+		allowance, err := wallet.Allowance(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if allowance.Sign() == 0 {
+			return EstimatedApproveGas, nil
+		}
+		return 0, nil
+	}
+}
+
+// startupApproval approves the HTLC contract when the wallet is created, if the approval policy allows it.
+func (wallet *wallet) startupApproval() error {
+	if wallet.options.Native {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), wallet.options.Timeout*2)
+	defer cancel()
+	callOpts := &bind.CallOpts{Context: ctx}
+
+	totalSupply, err := wallet.token.TotalSupply(callOpts)
+	if err != nil {
+		return err
+	}
+	amount := wallet.options.Approval.startupAmount(totalSupply)
+	if amount == nil {
+		return nil
+	}
+
+	wallet.approvalMu.Lock()
+	defer wallet.approvalMu.Unlock()
+	approving, err := wallet.ensureAllowance(ctx, amount)
+	if err != nil || !approving {
+		return err
+	}
+
+	// Nothing else is sent yet, so it's fine to wait for the approval to be mined
+	receipt, err := bind.WaitMined(ctx, wallet.client, wallet.approval.tx)
+	if err != nil {
+		return err
+	}
+	if receipt.Status == 0 {
+		return fmt.Errorf("tx reverted, hash = %v", receipt.TxHash.Hex())
+	}
+	return nil
+}
+
+// TokenAllowance returns the token of the HTLC contract and how much of it the HTLC contract is allowed to spend from
+// the owner. It doesn't need a wallet, so approvals can be inspected without the key.
+func TokenAllowance(ctx context.Context, client Backend, htlcAddr, owner common.Address) (common.Address, *big.Int, error) {
+	callOpts := &bind.CallOpts{Context: ctx}
+	htlc, err := gardenhtlc.NewGardenHTLCCaller(htlcAddr, client)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	tokenAddr, err := htlc.Token(callOpts)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	token, err := erc20.NewERC20Caller(tokenAddr, client)
+	if err != nil {
+		return tokenAddr, nil, err
+	}
+	allowance, err := token.Allowance(callOpts, owner, htlcAddr)
+	return tokenAddr, allowance, err
+}
@@ -0,0 +1,146 @@
+package ethswap_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// initiate sends the initiation, retrying while the approval it relies on is not mined yet.
+func initiate(ctx context.Context, wallet ethswap.Wallet, swap ethswap.Swap) *types.Transaction {
+	var tx *types.Transaction
+	Eventually(func() error {
+		var err error
+		tx, err = wallet.Initiate(ctx, swap)
+		var revertErr *ethswap.RevertError
+		if errors.As(err, &revertErr) && revertErr.Reason == ethswap.RevertPendingApproval {
+			return err
+		}
+		Expect(err).To(BeNil())
+		return nil
+	}).WithTimeout(10 * time.Second).Should(Succeed())
+	return tx
+}
+
+var _ = Describe("Token approvals", func() {
+	var options ethswap.Options
+	BeforeEach(func(ctx context.Context) {
+		chainID, err := backend.Client().ChainID(ctx)
+		Expect(err).To(BeNil())
+		fees := ethswap.DefaultFeePolicy
+		fees.PriorityFee = big.NewInt(params.GWei)
+		options = ethswap.NewOptions(chainID, swapAddr).WithTimeout(time.Minute).WithFeePolicy(fees)
+	})
+
+	newSwap := func(amount int64) ethswap.Swap {
+		secret := make([]byte, 32)
+		_, err := rand.Read(secret)
+		Expect(err).To(BeNil())
+		bob := crypto.PubkeyToAddress(bobKey.PublicKey)
+		return ethswap.NewSwap(crypto.PubkeyToAddress(aliceKey.PublicKey), bob, swapAddr, sha256.Sum256(secret), big.NewInt(amount), big.NewInt(1000))
+	}
+
+	// sent initiates the swap and returns how many txs have been sent for it.
+	sent := func(ctx context.Context, wallet ethswap.Wallet, swap ethswap.Swap) uint64 {
+		before, err := backend.Client().PendingNonceAt(ctx, wallet.Address())
+		Expect(err).To(BeNil())
+		receipt, err := bind.WaitMined(ctx, backend.Client(), initiate(ctx, wallet, swap))
+		Expect(err).To(BeNil())
+		Expect(receipt.Status).Should(Equal(types.ReceiptStatusSuccessful))
+		after, err := backend.Client().PendingNonceAt(ctx, wallet.Address())
+		Expect(err).To(BeNil())
+		return after - before
+	}
+
+	// revoke sets the allowance to 0, so the specs don't depend on each other.
+	revoke := func(ctx context.Context, wallet ethswap.Wallet) {
+		tx, err := wallet.Approve(ctx, big.NewInt(0))
+		Expect(err).To(BeNil())
+		_, err = bind.WaitMined(ctx, backend.Client(), tx)
+		Expect(err).To(BeNil())
+	}
+
+	It("should not approve again while the approval is pending", func(ctx context.Context) {
+		wallet, err := ethswap.NewWallet(options, aliceKey, backend.Client())
+		Expect(err).To(BeNil())
+		revoke(ctx, wallet)
+
+		// The initiation is retried until the approval is mined, which is sent only once
+		Expect(sent(ctx, wallet, newSwap(1e6))).Should(Equal(uint64(2)))
+		Expect(sent(ctx, wallet, newSwap(2e6))).Should(Equal(uint64(2)))
+	})
+
+	It("should rely on the approval until it runs out", func(ctx context.Context) {
+		policy := ethswap.ApprovalPolicy{Mode: ethswap.ApprovalBounded, Volume: big.NewInt(3e6)}
+		wallet, err := ethswap.NewWallet(options.WithApprovalPolicy(policy), aliceKey, backend.Client())
+		Expect(err).To(BeNil())
+		revoke(ctx, wallet)
+
+		By("One approval covers the first two initiations")
+		Expect(sent(ctx, wallet, newSwap(1e6))).Should(Equal(uint64(2)))
+		Expect(sent(ctx, wallet, newSwap(2e6))).Should(Equal(uint64(1)))
+
+		By("The next initiation needs another approval")
+		Expect(sent(ctx, wallet, newSwap(1e6))).Should(Equal(uint64(2)))
+		allowance, err := wallet.Allowance(ctx)
+		Expect(err).To(BeNil())
+		Expect(allowance).Should(Equal(big.NewInt(2e6)))
+	})
+
+	It("should tell the initiation to retry while the approval is pending", func(ctx context.Context) {
+		wallet, err := ethswap.NewWallet(options, aliceKey, backend.Client())
+		Expect(err).To(BeNil())
+		revoke(ctx, wallet)
+
+		// Either the rpc sees the pending approval and the initiation is sent, or it's retried later
+		tx, err := wallet.Initiate(ctx, newSwap(1e6))
+		if err != nil {
+			var revertErr *ethswap.RevertError
+			Expect(errors.As(err, &revertErr)).Should(BeTrue())
+			Expect(revertErr.Reason).Should(Equal(ethswap.RevertPendingApproval))
+			return
+		}
+		receipt, err := bind.WaitMined(ctx, backend.Client(), tx)
+		Expect(err).To(BeNil())
+		Expect(receipt.Status).Should(Equal(types.ReceiptStatusSuccessful))
+	})
+
+	It("should count the approval in the cost of just-in-time initiations", func(ctx context.Context) {
+		wallet, err := ethswap.NewWallet(options, aliceKey, backend.Client())
+		Expect(err).To(BeNil())
+		native, err := ethswap.NewWallet(options.WithNative(nil), aliceKey, backend.Client())
+		Expect(err).To(BeNil())
+
+		// The gas price might change between the calls, so compare the costs of the same block
+		Eventually(func() bool {
+			head, err := backend.Client().BlockNumber(ctx)
+			Expect(err).To(BeNil())
+			initiate, err := wallet.ActionCost(ctx, "initiate")
+			Expect(err).To(BeNil())
+			nativeInitiate, err := native.ActionCost(ctx, "initiate")
+			Expect(err).To(BeNil())
+			after, err := backend.Client().BlockNumber(ctx)
+			Expect(err).To(BeNil())
+			if head != after {
+				return false
+			}
+
+			gasPrice := new(big.Int).Div(nativeInitiate, new(big.Int).SetUint64(ethswap.EstimatedGas["initiate"]))
+			expected := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(ethswap.EstimatedGas["initiate"]+ethswap.EstimatedApproveGas))
+			Expect(initiate).Should(Equal(expected))
+			return true
+		}).WithTimeout(10 * time.Second).Should(BeTrue())
+	})
+})
@@ -0,0 +1,20 @@
+package ethswap
+
+import (
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+)
+
+// Backend is the part of an evm node we rely on, which is the contract backend of the bindings plus the block, state,
+// fee and receipt queries. It's satisfied by *ethclient.Client and the client of go-ethereum's simulated backend, so the
+// wallets and swaps can be tested against an in-process chain.
+type Backend interface {
+	bind.ContractBackend
+	ethereum.BlockNumberReader
+	ethereum.ChainIDReader
+	ethereum.ChainReader
+	ethereum.ChainStateReader
+	ethereum.PendingStateReader
+	ethereum.TransactionReader
+	ethereum.FeeHistoryReader
+}
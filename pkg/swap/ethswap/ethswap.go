@@ -10,7 +10,6 @@ import (
 	"github.com/catalogfi/ob/model"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient"
 )
 
 type Swap struct {
@@ -37,32 +36,59 @@ func NewSwap(initiator, redeemer, contract common.Address, secretHash common.Has
 	}
 }
 
-func (swap *Swap) Initiated(ctx context.Context, client *ethclient.Client) (bool, error) {
+// ConfirmedBlock returns the latest block which has the given number of confirmations, the latest block itself has 1
+// confirmation. It returns nil, which means the latest block, if confirmations is 0 or 1.
+func ConfirmedBlock(ctx context.Context, client Backend, confirmations uint64) (*big.Int, error) {
+	if confirmations <= 1 {
+		return nil, nil
+	}
+	latest, err := client.BlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if latest+1 < confirmations {
+		return big.NewInt(0), nil
+	}
+	return new(big.Int).SetUint64(latest + 1 - confirmations), nil
+}
+
+func (swap *Swap) Initiated(ctx context.Context, client Backend) (bool, error) {
+	return swap.InitiatedAt(ctx, client, nil)
+}
+
+// InitiatedAt checks if the swap has been initiated at the given block, nil means the latest block.
+func (swap *Swap) InitiatedAt(ctx context.Context, client Backend, block *big.Int) (bool, error) {
 	htlc, err := gardenhtlc.NewGardenHTLC(swap.Contract, client)
 	if err != nil {
 		return false, err
 	}
-	details, err := htlc.Orders(&bind.CallOpts{Context: ctx}, swap.ID)
+	details, err := htlc.Orders(&bind.CallOpts{Context: ctx, BlockNumber: block}, swap.ID)
 	if err != nil {
 		return false, err
 	}
 	return details.InitiatedAt.Uint64() != 0, nil
 }
 
-func (swap *Swap) Redeemed(ctx context.Context, client *ethclient.Client) (bool, error) {
-	// Check if the swap has been redeemed
+func (swap *Swap) Redeemed(ctx context.Context, client Backend) (bool, error) {
+	return swap.RedeemedAt(ctx, client, nil)
+}
+
+// RedeemedAt checks if the swap has been redeemed or refunded at the given block, nil means the latest block.
+func (swap *Swap) RedeemedAt(ctx context.Context, client Backend, block *big.Int) (bool, error) {
 	htlc, err := gardenhtlc.NewGardenHTLC(swap.Contract, client)
 	if err != nil {
 		return false, err
 	}
-	details, err := htlc.Orders(&bind.CallOpts{Context: ctx}, swap.ID)
+	details, err := htlc.Orders(&bind.CallOpts{Context: ctx, BlockNumber: block}, swap.ID)
 	if err != nil {
 		return false, err
 	}
 	return details.IsFulfilled, err
 }
 
-func (swap *Swap) Secret(ctx context.Context, client *ethclient.Client, step uint64) ([]byte, error) {
+// Secret searches the redeem event of the swap for the secret, `step` blocks at a time. The height tells how the
+// contract measures the timelock, so the search can be bounded to the blocks before the expiry.
+func (swap *Swap) Secret(ctx context.Context, client Backend, height Height, step uint64) ([]byte, error) {
 	// Check if the swap has been redeemed
 	htlc, err := gardenhtlc.NewGardenHTLC(swap.Contract, client)
 	if err != nil {
@@ -76,22 +102,23 @@ func (swap *Swap) Secret(ctx context.Context, client *ethclient.Client, step uin
 		return nil, fmt.Errorf("swap not redeemed")
 	}
 
-	start := details.InitiatedAt
-	latestBlock, err := client.BlockByNumber(ctx, nil)
+	startBlock, err := BlockAtHeight(ctx, client, height, details.InitiatedAt.Uint64())
 	if err != nil {
 		return nil, err
 	}
-	latest := latestBlock.Number()
+	start := new(big.Int).SetUint64(startBlock)
 	if step == 0 {
 		step = 500
 	}
 
 	// Theoretically people can still redeem after the expiry, but we assume the initiator will refund right after the
 	// expiry.
-	expiry := big.NewInt(0).Add(details.InitiatedAt, details.Timelock)
-	if latest.Cmp(expiry) == 1 {
-		latest = expiry
+	expiry := details.InitiatedAt.Uint64() + details.Timelock.Uint64()
+	latestBlock, err := BlockAtHeight(ctx, client, height, expiry)
+	if err != nil {
+		return nil, err
 	}
+	latest := new(big.Int).SetUint64(latestBlock)
 
 	for start.Cmp(latest) == -1 {
 		end := start.Uint64() + step
@@ -119,21 +146,30 @@ func (swap *Swap) Secret(ctx context.Context, client *ethclient.Client, step uin
 	return nil, fmt.Errorf("secret not found")
 }
 
-func (swap *Swap) Expired(ctx context.Context, client *ethclient.Client) (bool, error) {
+// Expired checks if the swap has expired without being redeemed, with the timelock measured in the given height.
+func (swap *Swap) Expired(ctx context.Context, client Backend, height Height) (bool, error) {
+	return swap.ExpiredAt(ctx, client, height, nil)
+}
+
+// ExpiredAt checks if the swap has expired without being redeemed at the given block, nil means the latest block.
+func (swap *Swap) ExpiredAt(ctx context.Context, client Backend, height Height, block *big.Int) (bool, error) {
 	htlc, err := gardenhtlc.NewGardenHTLC(swap.Contract, client)
 	if err != nil {
 		return false, err
 	}
 
-	details, err := htlc.Orders(&bind.CallOpts{Context: ctx}, swap.ID)
+	details, err := htlc.Orders(&bind.CallOpts{Context: ctx, BlockNumber: block}, swap.ID)
 	if err != nil {
 		return false, err
 	}
-	latest, err := client.BlockNumber(ctx)
+	if details.InitiatedAt.Sign() == 0 {
+		return false, nil
+	}
+	current, err := CurrentHeight(ctx, client, height, block)
 	if err != nil {
 		return false, err
 	}
-	return !details.IsFulfilled && latest-details.InitiatedAt.Uint64() >= details.Timelock.Uint64(), nil
+	return !details.IsFulfilled && current-details.InitiatedAt.Uint64() >= details.Timelock.Uint64(), nil
 }
 
 func FromAtomicSwap(atomicSwap *model.AtomicSwap) (Swap, error) {
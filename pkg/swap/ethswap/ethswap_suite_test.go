@@ -1,67 +1,98 @@
 package ethswap_test
 
-// import (
-// 	"context"
-// 	"encoding/hex"
-// 	"os"
-// 	"strings"
-// 	"testing"
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
 
-// 	"github.com/catalogfi/blockchain/evm/bindings/contracts/htlc/gardenhtlc"
-// 	"github.com/catalogfi/blockchain/evm/bindings/openzeppelin/contracts/token/ERC20/erc20"
-// 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
-// 	"github.com/ethereum/go-ethereum/common"
-// 	"github.com/ethereum/go-ethereum/core/types"
-// 	"github.com/ethereum/go-ethereum/crypto"
-// 	"github.com/ethereum/go-ethereum/ethclient"
-// 	"github.com/fatih/color"
-// 	. "github.com/onsi/ginkgo/v2"
-// 	. "github.com/onsi/gomega"
-// )
+	"github.com/catalogfi/blockchain/evm/bindings/contracts/htlc/gardenhtlc"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/fatih/color"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
 
-// var (
-// 	swapAddr  common.Address
-// 	tokenAddr common.Address
-// )
+var (
+	backend   *simulated.Backend
+	aliceKey  *ecdsa.PrivateKey
+	bobKey    *ecdsa.PrivateKey
+	swapAddr  common.Address
+	tokenAddr common.Address
+	mining    chan struct{}
+)
 
-// var _ = BeforeSuite(func() {
-// 	By("Required envs")
-// 	Expect(os.Getenv("ETH_URL")).ShouldNot(BeEmpty())
-// 	Expect(os.Getenv("ETH_KEY_1")).ShouldNot(BeEmpty())
+// deploy sends the creation tx and waits for it to be mined.
+func deploy(ctx context.Context, f func() (common.Address, *types.Transaction, error)) common.Address {
+	addr, tx, err := f()
+	Expect(err).Should(BeNil())
+	receipt, err := bind.WaitMined(ctx, backend.Client(), tx)
+	Expect(err).Should(BeNil())
+	Expect(receipt.Status).Should(Equal(types.ReceiptStatusSuccessful))
+	return addr
+}
 
-// 	By("Initialise client")
-// 	url := os.Getenv("ETH_URL")
-// 	client, err := ethclient.Dial(url)
-// 	Expect(err).Should(BeNil())
-// 	chainID, err := client.ChainID(context.Background())
-// 	Expect(err).Should(BeNil())
+var _ = BeforeSuite(func(ctx context.Context) {
+	By("Initialise the keys")
+	var err error
+	aliceKey, err = crypto.GenerateKey()
+	Expect(err).Should(BeNil())
+	bobKey, err = crypto.GenerateKey()
+	Expect(err).Should(BeNil())
 
-// 	By("Initialise transactor")
-// 	keyStr := strings.TrimPrefix(os.Getenv("ETH_KEY_1"), "0x")
-// 	keyBytes, err := hex.DecodeString(keyStr)
-// 	Expect(err).Should(BeNil())
-// 	key, err := crypto.ToECDSA(keyBytes)
-// 	Expect(err).Should(BeNil())
-// 	transactor, err := bind.NewKeyedTransactorWithChainID(key, chainID)
-// 	Expect(err).Should(BeNil())
+	By("Start the simulated chain")
+	funds := new(big.Int).Mul(big.NewInt(100), big.NewInt(params.Ether))
+	backend = simulated.NewBackend(types.GenesisAlloc{
+		crypto.PubkeyToAddress(aliceKey.PublicKey): {Balance: funds},
+		crypto.PubkeyToAddress(bobKey.PublicKey):   {Balance: funds},
+	})
+	mining = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(50 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				backend.Commit()
+			case <-mining:
+				return
+			}
+		}
+	}()
 
-// 	By("Deploy ERC20 contract")
-// 	var tx *types.Transaction
-// 	tokenAddr, tx, _, err = erc20.Deploy(transactor, client)
-// 	Expect(err).Should(BeNil())
-// 	_, err = bind.WaitMined(context.Background(), client, tx)
-// 	Expect(err).Should(BeNil())
-// 	By(color.GreenString("ERC20 deployed to %v", tokenAddr.Hex()))
+	chainID, err := backend.Client().ChainID(ctx)
+	Expect(err).Should(BeNil())
+	transactor, err := bind.NewKeyedTransactorWithChainID(aliceKey, chainID)
+	Expect(err).Should(BeNil())
 
-// 	By("Deploy atomic swap contract")
-// 	swapAddr, tx, _, err = gardenhtlc.DeployGardenHTLC(transactor, client, tokenAddr, "Garden", "v0")
-// 	Expect(err).Should(BeNil())
-// 	_, err = bind.WaitMined(context.Background(), client, tx)
-// 	Expect(err).Should(BeNil())
-// 	By(color.GreenString("Atomic swap deployed to %v", swapAddr.Hex()))
-// })
+	By("Deploy ERC20 contract")
+	tokenAddr = deploy(ctx, func() (common.Address, *types.Transaction, error) {
+		return deployToken(transactor)
+	})
+	By(color.GreenString("ERC20 deployed to %v", tokenAddr.Hex()))
 
-// func TestEthswap(t *testing.T) {
-// 	RegisterFailHandler(Fail)
-// 	RunSpecs(t, "Ethswap Suite")
-// }
+	By("Deploy atomic swap contract")
+	swapAddr = deploy(ctx, func() (common.Address, *types.Transaction, error) {
+		addr, tx, _, err := gardenhtlc.DeployGardenHTLC(transactor, backend.Client(), tokenAddr, "Garden", "v0")
+		return addr, tx, err
+	})
+	By(color.GreenString("Atomic swap deployed to %v", swapAddr.Hex()))
+})
+
+var _ = AfterSuite(func() {
+	if backend != nil {
+		close(mining)
+		Expect(backend.Close()).Should(Succeed())
+	}
+})
+
+func TestEthswap(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Ethswap Suite")
+}
@@ -29,7 +29,7 @@ package ethswap_test
 // 			Expect(err).To(BeNil())
 
 // 			By("Initialize Alice wallet")
-// 			options := ethswap.NewOptions(model.EthereumLocalnet, swapAddr)
+// 			options := ethswap.NewOptions(ethswap.ChainIDs[model.EthereumLocalnet], swapAddr)
 // 			aliceKeyStr := strings.TrimPrefix(os.Getenv("ETH_KEY_1"), "0x")
 // 			aliceKeyBytes, err := hex.DecodeString(aliceKeyStr)
 // 			Expect(err).To(BeNil())
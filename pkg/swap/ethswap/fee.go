@@ -0,0 +1,234 @@
+package ethswap
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// FeePolicy decides the EIP-1559 fees of the txs sent by the wallet, and how to replace the txs stuck in the mempool.
+type FeePolicy struct {
+	Percentile        float64       // percentile of the priority fees paid in recent blocks, 0 uses the node's suggestion
+	HistoryBlocks     uint64        // number of recent blocks to sample the priority fees from
+	BaseFeeMultiplier float64       // fee cap is the next base fee times this multiplier plus the priority fee
+	PriorityFee       *big.Int      // minimum priority fee in wei, nil means no minimum
+	MaxFeeCap         *big.Int      // maximum fee cap in wei, nil means no limit
+	ReplaceAfter      time.Duration // replace a pending tx with bumped fees after this long, 0 disables replacements
+	BumpPercentage    int64         // percentage to bump the fees by for each replacement, nodes require at least 10
+}
+
+// DefaultFeePolicy pays the median priority fee of the last 10 blocks and replaces a tx if it's not mined in 3 minutes.
+var DefaultFeePolicy = FeePolicy{
+	Percentile:        50,
+	HistoryBlocks:     10,
+	BaseFeeMultiplier: 2,
+	ReplaceAfter:      3 * time.Minute,
+	BumpPercentage:    20,
+}
+
+// pendingTx is a tx we have sent but not yet mined.
+type pendingTx struct {
+	tx     *types.Transaction
+	sentAt time.Time
+}
+
+// suggestFees returns the priority fee and the fee cap for a new tx. Both are nil if the chain doesn't support EIP-1559,
+// in which case the gas price suggested by the node is used.
+func (wallet *wallet) suggestFees(ctx context.Context) (*big.Int, *big.Int, error) {
+	policy := wallet.options.Fees
+
+	blocks := policy.HistoryBlocks
+	if blocks == 0 {
+		blocks = 1
+	}
+	percentiles := []float64{}
+	if policy.Percentile > 0 {
+		percentiles = append(percentiles, policy.Percentile)
+	}
+	history, err := wallet.client.FeeHistory(ctx, blocks, nil, percentiles)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The last base fee in the history is the one of the next block
+	if len(history.BaseFee) == 0 {
+		return nil, nil, nil
+	}
+	baseFee := history.BaseFee[len(history.BaseFee)-1]
+	if baseFee == nil || baseFee.Sign() == 0 {
+		return nil, nil, nil
+	}
+
+	// Use the median of the priority fees paid at the percentile in recent blocks
+	var tip *big.Int
+	if policy.Percentile > 0 {
+		rewards := make([]*big.Int, 0, len(history.Reward))
+		for _, reward := range history.Reward {
+			if len(reward) > 0 && reward[0] != nil {
+				rewards = append(rewards, reward[0])
+			}
+		}
+		if len(rewards) > 0 {
+			sort.Slice(rewards, func(i, j int) bool {
+				return rewards[i].Cmp(rewards[j]) < 0
+			})
+			tip = new(big.Int).Set(rewards[len(rewards)/2])
+		}
+	}
+	if tip == nil {
+		tip, err = wallet.client.SuggestGasTipCap(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if policy.PriorityFee != nil && tip.Cmp(policy.PriorityFee) < 0 {
+		tip = new(big.Int).Set(policy.PriorityFee)
+	}
+
+	multiplier := policy.BaseFeeMultiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	feeCap, _ := new(big.Float).Mul(new(big.Float).SetInt(baseFee), big.NewFloat(multiplier)).Int(nil)
+	feeCap.Add(feeCap, tip)
+
+	// Stay within the max fee cap, the tx won't be mined if the base fee is already above the cap
+	if policy.MaxFeeCap != nil {
+		if baseFee.Cmp(policy.MaxFeeCap) > 0 {
+			return nil, nil, fmt.Errorf("base fee %v exceeds the max fee cap %v", baseFee, policy.MaxFeeCap)
+		}
+		if feeCap.Cmp(policy.MaxFeeCap) > 0 {
+			feeCap = new(big.Int).Set(policy.MaxFeeCap)
+		}
+		if tip.Cmp(feeCap) > 0 {
+			tip = new(big.Int).Set(feeCap)
+		}
+	}
+	return tip, feeCap, nil
+}
+
+// bump increases the fee by the bump percentage of the policy.
+func (policy FeePolicy) bump(fee *big.Int) *big.Int {
+	percentage := policy.BumpPercentage
+	if percentage < 10 {
+		percentage = 10
+	}
+	bumped := new(big.Int).Mul(fee, big.NewInt(100+percentage))
+	bumped.Div(bumped, big.NewInt(100))
+	return bumped.Add(bumped, big.NewInt(1))
+}
+
+// maxBig returns the larger one, nil is treated as the smallest.
+func maxBig(a, b *big.Int) *big.Int {
+	if a == nil || (b != nil && b.Cmp(a) > 0) {
+		return b
+	}
+	return a
+}
+
+// replacement builds a tx with the same nonce and bumped fees to replace the given tx. The new fees are the higher of
+// the bumped fees and the current suggestion. It returns nil if the fees can't be bumped without breaking the max fee
+// cap.
+func (wallet *wallet) replacement(ctx context.Context, tx *types.Transaction) (*types.Transaction, error) {
+	policy := wallet.options.Fees
+	tip, feeCap, err := wallet.suggestFees(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var data types.TxData
+	switch tx.Type() {
+	case types.DynamicFeeTxType:
+		newTip := maxBig(policy.bump(tx.GasTipCap()), tip)
+		newFeeCap := maxBig(policy.bump(tx.GasFeeCap()), feeCap)
+		if policy.MaxFeeCap != nil && newFeeCap.Cmp(policy.MaxFeeCap) > 0 {
+			return nil, nil
+		}
+		data = &types.DynamicFeeTx{
+			ChainID:    tx.ChainId(),
+			Nonce:      tx.Nonce(),
+			GasTipCap:  newTip,
+			GasFeeCap:  newFeeCap,
+			Gas:        tx.Gas(),
+			To:         tx.To(),
+			Value:      tx.Value(),
+			Data:       tx.Data(),
+			AccessList: tx.AccessList(),
+		}
+	case types.LegacyTxType:
+		gasPrice, err := wallet.client.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, err
+		}
+		newGasPrice := maxBig(policy.bump(tx.GasPrice()), gasPrice)
+		if policy.MaxFeeCap != nil && newGasPrice.Cmp(policy.MaxFeeCap) > 0 {
+			return nil, nil
+		}
+		data = &types.LegacyTx{
+			Nonce:    tx.Nonce(),
+			GasPrice: newGasPrice,
+			Gas:      tx.Gas(),
+			To:       tx.To(),
+			Value:    tx.Value(),
+			Data:     tx.Data(),
+		}
+	default:
+		return nil, fmt.Errorf("unsupported tx type = %v", tx.Type())
+	}
+	return wallet.transactOpts.Signer(wallet.addr, types.NewTx(data))
+}
+
+// ReplaceStuck replaces the txs which have been pending for longer than the ReplaceAfter of the fee policy.
+func (wallet *wallet) ReplaceStuck(ctx context.Context) ([]*types.Transaction, error) {
+	wallet.mu.Lock()
+	defer wallet.mu.Unlock()
+
+	if len(wallet.pending) == 0 {
+		return nil, nil
+	}
+
+	// Forget about the txs which have been mined
+	nonce, err := wallet.client.NonceAt(ctx, wallet.addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	for n := range wallet.pending {
+		if n < nonce {
+			delete(wallet.pending, n)
+		}
+	}
+
+	replaceAfter := wallet.options.Fees.ReplaceAfter
+	if replaceAfter <= 0 {
+		return nil, nil
+	}
+	replaced := []*types.Transaction{}
+	for n, pending := range wallet.pending {
+		if time.Since(pending.sentAt) < replaceAfter {
+			continue
+		}
+		tx, err := wallet.replacement(ctx, pending.tx)
+		if err != nil {
+			return replaced, err
+		}
+		if tx == nil {
+			continue
+		}
+		if err := wallet.client.SendTransaction(ctx, tx); err != nil {
+			return replaced, fmt.Errorf("replace tx %v, %v", pending.tx.Hash().Hex(), err)
+		}
+		if err := wallet.nonces.Assign(n, tx.Hash()); err != nil {
+			return replaced, err
+		}
+		wallet.pending[n] = &pendingTx{
+			tx:     tx,
+			sentAt: time.Now(),
+		}
+		replaced = append(replaced, tx)
+	}
+	return replaced, nil
+}
@@ -0,0 +1,207 @@
+package ethswap
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/catalogfi/cobi/pkg/swap"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// feeBackend returns fixed fee suggestions.
+type feeBackend struct {
+	Backend
+	history  *ethereum.FeeHistory
+	tip      *big.Int
+	gasPrice *big.Int
+}
+
+func (backend feeBackend) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error) {
+	return backend.history, nil
+}
+
+func (backend feeBackend) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return backend.tip, nil
+}
+
+func (backend feeBackend) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return backend.gasPrice, nil
+}
+
+var _ = Describe("Fee policy", func() {
+	var w *wallet
+	var backend *feeBackend
+	chainID := big.NewInt(1337)
+	to := common.HexToAddress("0x1")
+	BeforeEach(func() {
+		key, err := crypto.GenerateKey()
+		Expect(err).Should(BeNil())
+		transactor, err := bind.NewKeyedTransactorWithChainID(key, chainID)
+		Expect(err).Should(BeNil())
+		backend = &feeBackend{
+			history: &ethereum.FeeHistory{
+				BaseFee: []*big.Int{big.NewInt(90), big.NewInt(100)},
+				Reward:  [][]*big.Int{{big.NewInt(3)}, {big.NewInt(1)}, {big.NewInt(2)}},
+			},
+			tip:      big.NewInt(7),
+			gasPrice: big.NewInt(150),
+		}
+		w = &wallet{
+			options:      Options{Fees: DefaultFeePolicy},
+			client:       backend,
+			addr:         transactor.From,
+			transactOpts: transactor,
+		}
+	})
+
+	Context("suggesting fees", func() {
+		It("should pay the median reward at the percentile on top of the multiplied base fee", func(ctx context.Context) {
+			tip, feeCap, err := w.suggestFees(ctx)
+			Expect(err).Should(BeNil())
+			Expect(tip.Int64()).Should(Equal(int64(2)))
+			Expect(feeCap.Int64()).Should(Equal(int64(202)))
+		})
+
+		It("should use the node's suggestion without a percentile and respect the minimum priority fee", func(ctx context.Context) {
+			w.options.Fees.Percentile = 0
+			tip, feeCap, err := w.suggestFees(ctx)
+			Expect(err).Should(BeNil())
+			Expect(tip.Int64()).Should(Equal(int64(7)))
+			Expect(feeCap.Int64()).Should(Equal(int64(207)))
+
+			w.options.Fees.PriorityFee = big.NewInt(10)
+			tip, feeCap, err = w.suggestFees(ctx)
+			Expect(err).Should(BeNil())
+			Expect(tip.Int64()).Should(Equal(int64(10)))
+			Expect(feeCap.Int64()).Should(Equal(int64(210)))
+		})
+
+		It("should cap the fees and refuse to pay when the base fee is over the cap", func(ctx context.Context) {
+			w.options.Fees.MaxFeeCap = big.NewInt(150)
+			tip, feeCap, err := w.suggestFees(ctx)
+			Expect(err).Should(BeNil())
+			Expect(tip.Int64()).Should(Equal(int64(2)))
+			Expect(feeCap.Int64()).Should(Equal(int64(150)))
+
+			w.options.Fees.MaxFeeCap = big.NewInt(99)
+			_, _, err = w.suggestFees(ctx)
+			Expect(err).ShouldNot(BeNil())
+		})
+
+		It("should return no fees when the chain doesn't support EIP-1559", func(ctx context.Context) {
+			backend.history = &ethereum.FeeHistory{BaseFee: []*big.Int{big.NewInt(0)}}
+			tip, feeCap, err := w.suggestFees(ctx)
+			Expect(err).Should(BeNil())
+			Expect(tip).Should(BeNil())
+			Expect(feeCap).Should(BeNil())
+		})
+	})
+
+	Context("replacing txs", func() {
+		It("should bump the fees of a dynamic fee tx", func(ctx context.Context) {
+			tx := types.NewTx(&types.DynamicFeeTx{ChainID: chainID, Nonce: 3, GasTipCap: big.NewInt(100), GasFeeCap: big.NewInt(1000), Gas: 21000, To: &to, Value: big.NewInt(1)})
+			replacement, err := w.replacement(ctx, tx)
+			Expect(err).Should(BeNil())
+			Expect(replacement.Nonce()).Should(Equal(uint64(3)))
+			Expect(replacement.GasTipCap().Int64()).Should(Equal(int64(121)))
+			Expect(replacement.GasFeeCap().Int64()).Should(Equal(int64(1201)))
+			Expect(replacement.To()).Should(Equal(&to))
+			Expect(replacement.Value().Int64()).Should(Equal(int64(1)))
+		})
+
+		It("should use the current suggestion when it's higher than the bumped fees", func(ctx context.Context) {
+			tx := types.NewTx(&types.DynamicFeeTx{ChainID: chainID, Nonce: 3, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(10), Gas: 21000, To: &to})
+			replacement, err := w.replacement(ctx, tx)
+			Expect(err).Should(BeNil())
+			Expect(replacement.GasTipCap().Int64()).Should(Equal(int64(2)))
+			Expect(replacement.GasFeeCap().Int64()).Should(Equal(int64(202)))
+		})
+
+		It("should bump the gas price of a legacy tx", func(ctx context.Context) {
+			tx := types.NewTx(&types.LegacyTx{Nonce: 3, GasPrice: big.NewInt(1000), Gas: 21000, To: &to})
+			replacement, err := w.replacement(ctx, tx)
+			Expect(err).Should(BeNil())
+			Expect(replacement.Type()).Should(Equal(uint8(types.LegacyTxType)))
+			Expect(replacement.GasPrice().Int64()).Should(Equal(int64(1201)))
+		})
+
+		It("should not replace a tx when the bumped fees break the max fee cap", func(ctx context.Context) {
+			w.options.Fees.MaxFeeCap = big.NewInt(1100)
+			tx := types.NewTx(&types.DynamicFeeTx{ChainID: chainID, Nonce: 3, GasTipCap: big.NewInt(100), GasFeeCap: big.NewInt(1000), Gas: 21000, To: &to})
+			replacement, err := w.replacement(ctx, tx)
+			Expect(err).Should(BeNil())
+			Expect(replacement).Should(BeNil())
+		})
+	})
+})
+
+// l1FeeBackend returns fixed fee suggestions and the L1 data fee of the OP stack oracle.
+type l1FeeBackend struct {
+	feeBackend
+	l1Fee *big.Int
+}
+
+func (backend l1FeeBackend) CallContract(ctx context.Context, msg ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	if msg.To == nil || *msg.To != OptimismGasPriceOracle {
+		return nil, fmt.Errorf("unexpected call")
+	}
+	return common.LeftPadBytes(backend.l1Fee.Bytes(), 32), nil
+}
+
+var _ = Describe("Action cost", func() {
+	var backend *l1FeeBackend
+	var w *wallet
+	BeforeEach(func() {
+		backend = &l1FeeBackend{
+			feeBackend: feeBackend{
+				history: &ethereum.FeeHistory{
+					BaseFee: []*big.Int{big.NewInt(90), big.NewInt(100)},
+					Reward:  [][]*big.Int{{big.NewInt(3)}, {big.NewInt(1)}, {big.NewInt(2)}},
+				},
+				tip:      big.NewInt(7),
+				gasPrice: big.NewInt(150),
+			},
+			l1Fee: big.NewInt(1e6),
+		}
+		w = &wallet{
+			options: Options{Fees: DefaultFeePolicy, Native: true, Rollup: RollupOptimism},
+			client:  backend,
+		}
+	})
+
+	It("should cost the gas at the fee cap plus the L1 data fee", func(ctx context.Context) {
+		// fee cap = 2 * base fee + median tip
+		feeCap := int64(2*100 + 2)
+		cost, err := w.ActionCost(ctx, swap.ActionInitiate)
+		Expect(err).Should(BeNil())
+		Expect(cost.Int64()).Should(Equal(int64(EstimatedGas[swap.ActionInitiate])*feeCap + 1e6))
+
+		cost, err = w.ActionCost(ctx, swap.ActionRedeem)
+		Expect(err).Should(BeNil())
+		Expect(cost.Int64()).Should(Equal(int64(EstimatedGas[swap.ActionRedeem])*feeCap + 1e6))
+	})
+
+	It("should use the gas price of the node on chains without EIP-1559", func(ctx context.Context) {
+		backend.history = &ethereum.FeeHistory{}
+		w.options.Rollup = RollupNone
+		cost, err := w.ActionCost(ctx, swap.ActionRefund)
+		Expect(err).Should(BeNil())
+		Expect(cost.Int64()).Should(Equal(int64(EstimatedGas[swap.ActionRefund]) * 150))
+	})
+
+	It("should count the approval of just-in-time initiations", func(ctx context.Context) {
+		w.options.Native = false
+		w.options.Rollup = RollupNone
+		cost, err := w.ActionCost(ctx, swap.ActionInitiate)
+		Expect(err).Should(BeNil())
+		Expect(cost.Int64()).Should(Equal(int64(EstimatedGas[swap.ActionInitiate]+EstimatedApproveGas) * 202))
+	})
+})
@@ -0,0 +1,90 @@
+package ethswap
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/catalogfi/ob/model"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Height is the source of the height the HTLC contract measures its timelocks in, which is what `block.number` or
+// `block.timestamp` returns to the contract. The empty height stands for the DefaultHeight of the chain.
+type Height string
+
+const (
+	HeightBlockNumber Height = "block"     // block number of the chain itself
+	HeightL1Block     Height = "l1"        // L1 block number, which `block.number` returns on Arbitrum chains
+	HeightTimestamp   Height = "timestamp" // block timestamp in seconds
+)
+
+// DefaultHeight returns the height source of the HTLC contracts on the chain. On Arbitrum the contracts see the L1 block
+// number instead of the L2 one returned by `eth_blockNumber` and `ArbSys.arbBlockNumber`.
+func DefaultHeight(chain model.Chain, rollup Rollup) Height {
+	if chain == model.EthereumArbitrum || rollup == RollupArbitrum {
+		return HeightL1Block
+	}
+	return HeightBlockNumber
+}
+
+// HeaderHeight returns the height of the block as seen by the contracts.
+func HeaderHeight(header *types.Header, height Height) (uint64, error) {
+	switch height {
+	case HeightBlockNumber:
+		return header.Number.Uint64(), nil
+	case HeightL1Block:
+		// Arbitrum Nitro keeps the L1 block number in the bytes 8 to 16 of the mix digest
+		return binary.BigEndian.Uint64(header.MixDigest[8:16]), nil
+	case HeightTimestamp:
+		return header.Time, nil
+	default:
+		return 0, fmt.Errorf("unknown height = %v", height)
+	}
+}
+
+// CurrentHeight returns the height of the given block as seen by the contracts, nil means the latest block.
+func CurrentHeight(ctx context.Context, client Backend, height Height, block *big.Int) (uint64, error) {
+	if height == HeightBlockNumber {
+		if block != nil {
+			return block.Uint64(), nil
+		}
+		return client.BlockNumber(ctx)
+	}
+	header, err := client.HeaderByNumber(ctx, block)
+	if err != nil {
+		return 0, err
+	}
+	return HeaderHeight(header, height)
+}
+
+// BlockAtHeight returns the first block of the chain which has reached the given height, or the latest block if none
+// has. It's a binary search over the headers when the height is not the block number.
+func BlockAtHeight(ctx context.Context, client Backend, height Height, target uint64) (uint64, error) {
+	latest, err := client.BlockNumber(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if height == HeightBlockNumber {
+		if target > latest {
+			return latest, nil
+		}
+		return target, nil
+	}
+
+	low, high := uint64(0), latest
+	for low < high {
+		mid := low + (high-low)/2
+		current, err := CurrentHeight(ctx, client, height, new(big.Int).SetUint64(mid))
+		if err != nil {
+			return 0, err
+		}
+		if current >= target {
+			high = mid
+		} else {
+			low = mid + 1
+		}
+	}
+	return low, nil
+}
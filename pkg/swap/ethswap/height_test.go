@@ -0,0 +1,85 @@
+package ethswap_test
+
+import (
+	"context"
+	"encoding/binary"
+	"math/big"
+
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
+	"github.com/catalogfi/ob/model"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// arbitrumHeader returns a header of an Arbitrum chain, which keeps the L1 block number in its mix digest.
+func arbitrumHeader(number, l1Block uint64) *types.Header {
+	header := &types.Header{Number: new(big.Int).SetUint64(number)}
+	binary.BigEndian.PutUint64(header.MixDigest[8:16], l1Block)
+	return header
+}
+
+// l1Backend serves the headers of an Arbitrum chain with an L1 block every 4 L2 blocks.
+type l1Backend struct {
+	ethswap.Backend
+	head uint64
+}
+
+func (backend *l1Backend) BlockNumber(ctx context.Context) (uint64, error) {
+	return backend.head, nil
+}
+
+func (backend *l1Backend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	block := backend.head
+	if number != nil {
+		block = number.Uint64()
+	}
+	return arbitrumHeader(block, 1000+block/4), nil
+}
+
+var _ = Describe("Heights", func() {
+	It("should read the height of a header", func() {
+		header := arbitrumHeader(5000, 1234)
+		header.Time = 1700000000
+
+		height, err := ethswap.HeaderHeight(header, ethswap.HeightL1Block)
+		Expect(err).To(BeNil())
+		Expect(height).Should(Equal(uint64(1234)))
+		height, err = ethswap.HeaderHeight(header, ethswap.HeightBlockNumber)
+		Expect(err).To(BeNil())
+		Expect(height).Should(Equal(uint64(5000)))
+		height, err = ethswap.HeaderHeight(header, ethswap.HeightTimestamp)
+		Expect(err).To(BeNil())
+		Expect(height).Should(Equal(uint64(1700000000)))
+
+		By("The default height is resolved by the caller")
+		_, err = ethswap.HeaderHeight(header, "")
+		Expect(err).ShouldNot(BeNil())
+	})
+
+	It("should find the first block at the L1 height", func(ctx context.Context) {
+		backend := &l1Backend{head: 400}
+		height, err := ethswap.CurrentHeight(ctx, backend, ethswap.HeightL1Block, nil)
+		Expect(err).To(BeNil())
+		Expect(height).Should(Equal(uint64(1100)))
+
+		block, err := ethswap.BlockAtHeight(ctx, backend, ethswap.HeightL1Block, 1050)
+		Expect(err).To(BeNil())
+		Expect(block).Should(Equal(uint64(200)))
+		block, err = ethswap.BlockAtHeight(ctx, backend, ethswap.HeightL1Block, 1001)
+		Expect(err).To(BeNil())
+		Expect(block).Should(Equal(uint64(4)))
+
+		By("The latest block is returned when the height is not reached yet")
+		block, err = ethswap.BlockAtHeight(ctx, backend, ethswap.HeightL1Block, 2000)
+		Expect(err).To(BeNil())
+		Expect(block).Should(Equal(uint64(400)))
+	})
+
+	It("should measure the timelocks of Arbitrum chains in L1 blocks by default", func() {
+		Expect(ethswap.DefaultHeight(model.EthereumArbitrum, ethswap.RollupNone)).Should(Equal(ethswap.HeightL1Block))
+		Expect(ethswap.DefaultHeight(model.EthereumLocalnet, ethswap.RollupArbitrum)).Should(Equal(ethswap.HeightL1Block))
+		Expect(ethswap.DefaultHeight(model.Ethereum, ethswap.RollupNone)).Should(Equal(ethswap.HeightBlockNumber))
+	})
+})
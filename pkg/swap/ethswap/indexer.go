@@ -0,0 +1,470 @@
+package ethswap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/catalogfi/blockchain/evm/bindings/contracts/htlc/gardenhtlc"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Kinds of HTLC events
+var (
+	EventInitiated = "initiated"
+	EventRedeemed  = "redeemed"
+	EventRefunded  = "refunded"
+)
+
+var (
+	// DefaultMaxLogRange is the default number of blocks queried in a single eth_getLogs call.
+	DefaultMaxLogRange uint64 = 2000
+
+	// DefaultReorgDepth is the default number of blocks re-indexed when a reorg is detected.
+	DefaultReorgDepth uint64 = 64
+
+	// ErrEventNotFound is returned when the indexer hasn't seen the event being queried.
+	ErrEventNotFound = errors.New("event not found")
+)
+
+// HTLCEvent is an event emitted by a HTLC contract.
+type HTLCEvent struct {
+	Kind        string         `json:"kind"`
+	Contract    common.Address `json:"contract"`
+	OrderID     common.Hash    `json:"order_id"`
+	SecretHash  common.Hash    `json:"secret_hash"`      // empty for refunds
+	Amount      *big.Int       `json:"amount,omitempty"` // only set for initiations
+	Secret      []byte         `json:"secret,omitempty"` // only set for redeems
+	BlockNumber uint64         `json:"block_number"`
+	BlockHash   common.Hash    `json:"block_hash"`
+	TxHash      common.Hash    `json:"tx_hash"`
+	LogIndex    uint           `json:"log_index"`
+}
+
+// Checkpoint is the last block indexed by the Indexer.
+type Checkpoint struct {
+	Block uint64 `json:"block"`
+	Hash  string `json:"hash"` // empty if nothing has been indexed, or the block needs to be re-indexed after a reorg
+}
+
+// EventStore persists the events and the checkpoint of the Indexer.
+type EventStore interface {
+
+	// LoadCheckpoint returns the checkpoint of the chain.
+	LoadCheckpoint(chainID *big.Int) (Checkpoint, error)
+
+	// StoreEvents stores the events and moves the checkpoint forward.
+	StoreEvents(chainID *big.Int, events []HTLCEvent, checkpoint Checkpoint) error
+
+	// Rewind removes the events after the block of the checkpoint and moves the checkpoint back.
+	Rewind(chainID *big.Int, checkpoint Checkpoint) error
+
+	// OrderEvents returns the events of the order in the order they happened.
+	OrderEvents(chainID *big.Int, contract common.Address, orderID common.Hash) ([]HTLCEvent, error)
+
+	// RangeEvents returns the events between the blocks (inclusive) in the order they happened.
+	RangeEvents(chainID *big.Int, from, to uint64) ([]HTLCEvent, error)
+}
+
+type memEventStore struct {
+	mu          *sync.Mutex
+	checkpoints map[string]Checkpoint
+	events      map[string][]HTLCEvent
+}
+
+// NewMemEventStore returns an EventStore which keeps the events in memory.
+func NewMemEventStore() EventStore {
+	return memEventStore{
+		mu:          new(sync.Mutex),
+		checkpoints: map[string]Checkpoint{},
+		events:      map[string][]HTLCEvent{},
+	}
+}
+
+func (store memEventStore) LoadCheckpoint(chainID *big.Int) (Checkpoint, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.checkpoints[chainID.String()], nil
+}
+
+func (store memEventStore) StoreEvents(chainID *big.Int, events []HTLCEvent, checkpoint Checkpoint) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.events[chainID.String()] = append(store.events[chainID.String()], events...)
+	SortEvents(store.events[chainID.String()])
+	store.checkpoints[chainID.String()] = checkpoint
+	return nil
+}
+
+func (store memEventStore) Rewind(chainID *big.Int, checkpoint Checkpoint) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	kept := []HTLCEvent{}
+	for _, event := range store.events[chainID.String()] {
+		if event.BlockNumber <= checkpoint.Block {
+			kept = append(kept, event)
+		}
+	}
+	store.events[chainID.String()] = kept
+	store.checkpoints[chainID.String()] = checkpoint
+	return nil
+}
+
+func (store memEventStore) OrderEvents(chainID *big.Int, contract common.Address, orderID common.Hash) ([]HTLCEvent, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	events := []HTLCEvent{}
+	for _, event := range store.events[chainID.String()] {
+		if event.Contract == contract && event.OrderID == orderID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (store memEventStore) RangeEvents(chainID *big.Int, from, to uint64) ([]HTLCEvent, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	events := []HTLCEvent{}
+	for _, event := range store.events[chainID.String()] {
+		if event.BlockNumber >= from && event.BlockNumber <= to {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+var (
+	htlcFilterer     *gardenhtlc.GardenHTLCFilterer
+	htlcTopics       []common.Hash
+	htlcFiltererErr  error
+	htlcFiltererOnce sync.Once
+)
+
+// eventParser returns the filterer to parse the HTLC logs and the topics of the Initiated, Redeemed and Refunded events.
+func eventParser() (*gardenhtlc.GardenHTLCFilterer, []common.Hash, error) {
+	htlcFiltererOnce.Do(func() {
+		htlcABI, err := gardenhtlc.GardenHTLCMetaData.GetAbi()
+		if err != nil {
+			htlcFiltererErr = err
+			return
+		}
+		htlcTopics = []common.Hash{
+			htlcABI.Events["Initiated"].ID,
+			htlcABI.Events["Redeemed"].ID,
+			htlcABI.Events["Refunded"].ID,
+		}
+
+		// The filterer is only used to parse the logs, so it doesn't need a contract or a client.
+		htlcFilterer, htlcFiltererErr = gardenhtlc.NewGardenHTLCFilterer(common.Address{}, nil)
+	})
+	return htlcFilterer, htlcTopics, htlcFiltererErr
+}
+
+// EventTopics returns the topics of the Initiated, Redeemed and Refunded events, which can be used as the first topic
+// of a log filter.
+func EventTopics() ([]common.Hash, error) {
+	_, topics, err := eventParser()
+	return topics, err
+}
+
+// ParseEvent converts a log of a HTLC contract to a HTLCEvent. It returns false if the log is not a HTLC event.
+func ParseEvent(log types.Log) (HTLCEvent, bool, error) {
+	filterer, topics, err := eventParser()
+	if err != nil || len(log.Topics) == 0 {
+		return HTLCEvent{}, false, err
+	}
+
+	event := HTLCEvent{
+		Contract:    log.Address,
+		BlockNumber: log.BlockNumber,
+		BlockHash:   log.BlockHash,
+		TxHash:      log.TxHash,
+		LogIndex:    log.Index,
+	}
+	switch log.Topics[0] {
+	case topics[0]:
+		initiated, err := filterer.ParseInitiated(log)
+		if err != nil {
+			return HTLCEvent{}, false, err
+		}
+		event.Kind = EventInitiated
+		event.OrderID = initiated.OrderID
+		event.SecretHash = initiated.SecretHash
+		event.Amount = initiated.Amount
+	case topics[1]:
+		redeemed, err := filterer.ParseRedeemed(log)
+		if err != nil {
+			return HTLCEvent{}, false, err
+		}
+		event.Kind = EventRedeemed
+		event.OrderID = redeemed.OrderID
+		event.SecretHash = redeemed.SecretHash
+		event.Secret = redeemed.Secret
+	case topics[2]:
+		refunded, err := filterer.ParseRefunded(log)
+		if err != nil {
+			return HTLCEvent{}, false, err
+		}
+		event.Kind = EventRefunded
+		event.OrderID = refunded.OrderID
+	default:
+		return HTLCEvent{}, false, nil
+	}
+	return event, true, nil
+}
+
+// SortEvents sorts the events in the order they happened.
+func SortEvents(events []HTLCEvent) {
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].BlockNumber != events[j].BlockNumber {
+			return events[i].BlockNumber < events[j].BlockNumber
+		}
+		return events[i].LogIndex < events[j].LogIndex
+	})
+}
+
+// IndexerOptions contains the optional settings of the Indexer.
+type IndexerOptions struct {
+	StartBlock uint64 // first block to index when there's no checkpoint, usually the deployment block of the contracts
+	MaxRange   uint64 // maximum blocks queried in a single eth_getLogs call, fewer are queried while the rpc rejects the range
+	ReorgDepth uint64 // blocks re-indexed when a reorg is detected
+}
+
+// Indexer follows the events of our HTLC contracts on a chain from a persisted checkpoint, so the state of the swaps
+// can be queried locally.
+type Indexer struct {
+	mu        *sync.Mutex
+	chainID   *big.Int
+	client    Backend
+	contracts []common.Address
+	store     EventStore
+	opts      IndexerOptions
+	topics    []common.Hash
+}
+
+func NewIndexer(chainID *big.Int, client Backend, contracts []common.Address, store EventStore, opts IndexerOptions) (*Indexer, error) {
+	if len(contracts) == 0 {
+		return nil, fmt.Errorf("no contract to index")
+	}
+	if store == nil {
+		store = NewMemEventStore()
+	}
+	if opts.MaxRange == 0 {
+		opts.MaxRange = DefaultMaxLogRange
+	}
+	if opts.ReorgDepth == 0 {
+		opts.ReorgDepth = DefaultReorgDepth
+	}
+
+	topics, err := EventTopics()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Indexer{
+		mu:        new(sync.Mutex),
+		chainID:   chainID,
+		client:    client,
+		contracts: contracts,
+		store:     store,
+		opts:      opts,
+		topics:    topics,
+	}, nil
+}
+
+// Sync indexes the events up to the latest block. It returns true if a reorg was detected, in which case the last
+// ReorgDepth blocks are re-indexed.
+func (indexer *Indexer) Sync(ctx context.Context) (bool, error) {
+	indexer.mu.Lock()
+	defer indexer.mu.Unlock()
+
+	checkpoint, err := indexer.store.LoadCheckpoint(indexer.chainID)
+	if err != nil {
+		return false, err
+	}
+	reorged, err := indexer.checkReorg(ctx, &checkpoint)
+	if err != nil {
+		return reorged, err
+	}
+
+	head, err := indexer.client.BlockNumber(ctx)
+	if err != nil {
+		return reorged, err
+	}
+	start := checkpoint.Block + 1
+	if checkpoint.Hash == "" && checkpoint.Block == 0 {
+		start = indexer.opts.StartBlock
+	}
+	span := indexer.opts.MaxRange
+	for start <= head {
+		end := start + span - 1
+		if end > head {
+			end = head
+		}
+
+		// Get the hash before the logs, so a reorg in between is caught by the next sync.
+		header, err := indexer.client.HeaderByNumber(ctx, new(big.Int).SetUint64(end))
+		if err != nil {
+			return reorged, err
+		}
+		logs, err := indexer.client.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(start),
+			ToBlock:   new(big.Int).SetUint64(end),
+			Addresses: indexer.contracts,
+			Topics:    [][]common.Hash{indexer.topics},
+		})
+		if err != nil {
+			// Most rpcs limit the range or the number of results of a query, try again with a smaller range.
+			if isRangeError(err) && span > 1 {
+				span /= 2
+				continue
+			}
+			return reorged, err
+		}
+
+		events, err := indexer.parse(logs)
+		if err != nil {
+			return reorged, err
+		}
+		checkpoint = Checkpoint{
+			Block: end,
+			Hash:  header.Hash().Hex(),
+		}
+		if err := indexer.store.StoreEvents(indexer.chainID, events, checkpoint); err != nil {
+			return reorged, err
+		}
+		start = end + 1
+
+		// The results limit depends on how busy the blocks are, so the range grows back after a successful query.
+		if span < indexer.opts.MaxRange {
+			span = min(span*2, indexer.opts.MaxRange)
+		}
+	}
+	return reorged, nil
+}
+
+// rangeErrors are parts of the messages rpcs return when the range or the number of results of eth_getLogs is too
+// large.
+var rangeErrors = []string{"block range", "limit", "too many", "too large", "more than", "exceed", "response size"}
+
+// isRangeError tells if the eth_getLogs call failed because the range or the number of results is too large.
+func isRangeError(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32005 {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, part := range rangeErrors {
+		if strings.Contains(msg, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkReorg rewinds the checkpoint if the indexed block is no longer in the canonical chain.
+func (indexer *Indexer) checkReorg(ctx context.Context, checkpoint *Checkpoint) (bool, error) {
+	if checkpoint.Hash == "" {
+		return false, nil
+	}
+	header, err := indexer.client.HeaderByNumber(ctx, new(big.Int).SetUint64(checkpoint.Block))
+	if err != nil {
+		return false, err
+	}
+	if header.Hash().Hex() == checkpoint.Hash {
+		return false, nil
+	}
+
+	rewound := Checkpoint{}
+	if checkpoint.Block > indexer.opts.ReorgDepth {
+		rewound.Block = checkpoint.Block - indexer.opts.ReorgDepth
+	}
+	if rewound.Block < indexer.opts.StartBlock {
+		rewound.Block = 0
+	}
+	if err := indexer.store.Rewind(indexer.chainID, rewound); err != nil {
+		return true, err
+	}
+	*checkpoint = rewound
+	return true, nil
+}
+
+// parse converts the logs to HTLC events, logs removed by a reorg are ignored.
+func (indexer *Indexer) parse(logs []types.Log) ([]HTLCEvent, error) {
+	events := make([]HTLCEvent, 0, len(logs))
+	for _, log := range logs {
+		if log.Removed {
+			continue
+		}
+		event, ok, err := ParseEvent(log)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// Checkpoint returns the last block indexed.
+func (indexer *Indexer) Checkpoint() (Checkpoint, error) {
+	return indexer.store.LoadCheckpoint(indexer.chainID)
+}
+
+// History returns the indexed events of the swap in the order they happened.
+func (indexer *Indexer) History(swap Swap) ([]HTLCEvent, error) {
+	return indexer.store.OrderEvents(indexer.chainID, swap.Contract, swap.ID)
+}
+
+// Status returns the kind of the latest indexed event of the swap, empty if the indexer hasn't seen the swap.
+func (indexer *Indexer) Status(swap Swap) (string, error) {
+	events, err := indexer.History(swap)
+	if err != nil || len(events) == 0 {
+		return "", err
+	}
+	return events[len(events)-1].Kind, nil
+}
+
+// StatusAt returns the kind of the latest indexed event of the swap at or before the given block, empty if the indexer
+// hasn't seen any.
+func (indexer *Indexer) StatusAt(swap Swap, block uint64) (string, error) {
+	events, err := indexer.History(swap)
+	if err != nil {
+		return "", err
+	}
+	status := ""
+	for _, event := range events {
+		if event.BlockNumber <= block {
+			status = event.Kind
+		}
+	}
+	return status, nil
+}
+
+// Secret returns the secret revealed by the redeem of the swap, or ErrEventNotFound if the indexer hasn't seen it.
+func (indexer *Indexer) Secret(swap Swap) ([]byte, error) {
+	events, err := indexer.History(swap)
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		if event.Kind == EventRedeemed {
+			return event.Secret, nil
+		}
+	}
+	return nil, ErrEventNotFound
+}
@@ -0,0 +1,173 @@
+package ethswap_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// logBackend serves the initiations we set, like an rpc which limits the range of eth_getLogs.
+type logBackend struct {
+	ethswap.Backend
+	head      uint64
+	fork      byte            // changes the hash of the blocks after forkBlock
+	forkBlock uint64          // first block of the fork
+	maxRange  uint64          // larger ranges are rejected
+	failures  int             // calls failing with a transient error
+	initiated map[uint64]byte // block => order of the initiation in the block
+	queries   [][2]uint64     // ranges of the accepted queries
+}
+
+func (backend *logBackend) BlockNumber(ctx context.Context) (uint64, error) {
+	return backend.head, nil
+}
+
+func (backend *logBackend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	header := &types.Header{Number: new(big.Int).Set(number)}
+	if number.Uint64() >= backend.forkBlock {
+		header.Extra = []byte{backend.fork}
+	}
+	return header, nil
+}
+
+func (backend *logBackend) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	if backend.failures > 0 {
+		backend.failures--
+		return nil, errors.New("connection reset by peer")
+	}
+	from, to := query.FromBlock.Uint64(), query.ToBlock.Uint64()
+	if to-from+1 > backend.maxRange {
+		return nil, fmt.Errorf("exceed maximum block range: %v", backend.maxRange)
+	}
+	backend.queries = append(backend.queries, [2]uint64{from, to})
+
+	topics, err := ethswap.EventTopics()
+	if err != nil {
+		return nil, err
+	}
+	logs := []types.Log{}
+	for block := from; block <= to; block++ {
+		order, ok := backend.initiated[block]
+		if !ok {
+			continue
+		}
+		logs = append(logs, types.Log{
+			Address:     query.Addresses[0],
+			Topics:      []common.Hash{topics[0], common.BytesToHash([]byte{order}), common.BytesToHash([]byte{order, order})},
+			Data:        common.LeftPadBytes(big.NewInt(1e6).Bytes(), 32),
+			BlockNumber: block,
+		})
+	}
+	return logs, nil
+}
+
+var _ = Describe("Indexer", func() {
+	chainID := big.NewInt(1337)
+	contract := common.HexToAddress("0xC")
+
+	var backend *logBackend
+	var store ethswap.EventStore
+	var indexer *ethswap.Indexer
+	BeforeEach(func() {
+		backend = &logBackend{
+			head:      950,
+			forkBlock: 1e9,
+			maxRange:  1000,
+			initiated: map[uint64]byte{10: 1, 500: 2, 900: 3},
+		}
+		store = ethswap.NewMemEventStore()
+		var err error
+		indexer, err = ethswap.NewIndexer(chainID, backend, []common.Address{contract}, store, ethswap.IndexerOptions{
+			StartBlock: 1,
+			MaxRange:   1000,
+			ReorgDepth: 100,
+		})
+		Expect(err).Should(BeNil())
+	})
+
+	orders := func() []byte {
+		events, err := store.RangeEvents(chainID, 0, backend.head)
+		Expect(err).Should(BeNil())
+		orders := []byte{}
+		for _, event := range events {
+			Expect(event.Kind).Should(Equal(ethswap.EventInitiated))
+			orders = append(orders, event.OrderID[31])
+		}
+		return orders
+	}
+
+	It("should index the events up to the head", func(ctx context.Context) {
+		reorged, err := indexer.Sync(ctx)
+		Expect(err).Should(BeNil())
+		Expect(reorged).Should(BeFalse())
+		Expect(orders()).Should(Equal([]byte{1, 2, 3}))
+
+		checkpoint, err := store.LoadCheckpoint(chainID)
+		Expect(err).Should(BeNil())
+		Expect(checkpoint.Block).Should(Equal(uint64(950)))
+	})
+
+	It("should query smaller ranges while the rpc rejects the range and grow them back", func(ctx context.Context) {
+		backend.maxRange = 200
+		_, err := indexer.Sync(ctx)
+		Expect(err).Should(BeNil())
+		Expect(orders()).Should(Equal([]byte{1, 2, 3}))
+
+		// 1000 and 500 are rejected, then every successful query tries a range twice as large.
+		Expect(backend.queries[0]).Should(Equal([2]uint64{1, 125}))
+		Expect(backend.queries[1]).Should(Equal([2]uint64{126, 250}))
+		for _, query := range backend.queries {
+			Expect(query[1] - query[0] + 1).Should(BeNumerically("<=", 200))
+		}
+
+		// Once the rpc accepts larger ranges, the next sync uses the whole range again.
+		backend.maxRange = 1000
+		backend.head = 1950
+		backend.queries = nil
+		_, err = indexer.Sync(ctx)
+		Expect(err).Should(BeNil())
+		Expect(backend.queries).Should(Equal([][2]uint64{{951, 1950}}))
+	})
+
+	It("should return other errors without shrinking the range", func(ctx context.Context) {
+		backend.failures = 1
+		_, err := indexer.Sync(ctx)
+		Expect(err).ShouldNot(BeNil())
+		Expect(backend.queries).Should(BeEmpty())
+
+		_, err = indexer.Sync(ctx)
+		Expect(err).Should(BeNil())
+		Expect(backend.queries).Should(Equal([][2]uint64{{1, 950}}))
+	})
+
+	It("should re-index the last blocks after a reorg", func(ctx context.Context) {
+		_, err := indexer.Sync(ctx)
+		Expect(err).Should(BeNil())
+
+		// The initiation at block 900 is dropped by a reorg and another one is mined instead.
+		backend.fork = 1
+		backend.forkBlock = 880
+		delete(backend.initiated, 900)
+		backend.initiated[920] = 4
+		backend.queries = nil
+
+		reorged, err := indexer.Sync(ctx)
+		Expect(err).Should(BeNil())
+		Expect(reorged).Should(BeTrue())
+		Expect(backend.queries).Should(Equal([][2]uint64{{851, 950}}))
+		Expect(orders()).Should(Equal([]byte{1, 2, 4}))
+
+		reorged, err = indexer.Sync(ctx)
+		Expect(err).Should(BeNil())
+		Expect(reorged).Should(BeFalse())
+	})
+})
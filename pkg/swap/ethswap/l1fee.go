@@ -0,0 +1,171 @@
+package ethswap
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/catalogfi/blockchain/evm/bindings/contracts/htlc/gardenhtlc"
+	"github.com/catalogfi/blockchain/evm/bindings/openzeppelin/contracts/token/ERC20/erc20"
+	"github.com/catalogfi/cobi/pkg/swap"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Rollup is the kind of rollup an evm chain is, it decides how the L1 data fee is charged.
+type Rollup string
+
+const (
+	RollupNone     Rollup = ""         // L1 or a chain without L1 data fee
+	RollupOptimism Rollup = "optimism" // OP stack chains like Optimism and Base
+	RollupArbitrum Rollup = "arbitrum" // Arbitrum chains
+)
+
+var (
+	// OptimismGasPriceOracle is the predeploy of OP stack chains which reports the L1 data fee.
+	OptimismGasPriceOracle = common.HexToAddress("0x420000000000000000000000000000000000000F")
+
+	// ArbitrumNodeInterface is the virtual contract of Arbitrum chains which estimates the L1 component of the gas.
+	ArbitrumNodeInterface = common.HexToAddress("0x00000000000000000000000000000000000000C8")
+)
+
+// EstimatedGas is the rough amount of L2 gas used by the actions of the HTLC contract.
+var EstimatedGas = map[swap.Action]uint64{
+	swap.ActionInitiate: 150000,
+	swap.ActionRedeem:   100000,
+	swap.ActionRefund:   80000,
+}
+
+const l1FeeABI = `[{"inputs":[{"internalType":"bytes","name":"_data","type":"bytes"}],"name":"getL1Fee","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"address","name":"to","type":"address"},{"internalType":"bool","name":"contractCreation","type":"bool"},{"internalType":"bytes","name":"data","type":"bytes"}],"name":"gasEstimateL1Component","outputs":[{"internalType":"uint64","name":"gasEstimateForL1","type":"uint64"},{"internalType":"uint256","name":"baseFee","type":"uint256"},{"internalType":"uint256","name":"l1BaseFeeEstimate","type":"uint256"}],"stateMutability":"payable","type":"function"}]`
+
+// ActionCalldata returns the calldata of a typical call of the action, which can be used to estimate the L1 data fee.
+func ActionCalldata(action swap.Action) ([]byte, error) {
+	htlcABI, err := gardenhtlc.GardenHTLCMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	word := common.HexToHash("0x" + strings.Repeat("ff", 32))
+	switch action {
+	case swap.ActionInitiate:
+		return htlcABI.Pack("initiate", common.BytesToAddress(word[:20]), word.Big(), word.Big(), word)
+	case swap.ActionRedeem:
+		return htlcABI.Pack("redeem", word, word[:])
+	case swap.ActionRefund:
+		return htlcABI.Pack("refund", word)
+	default:
+		return nil, fmt.Errorf("unknown action = %v", action)
+	}
+}
+
+// ActionCost estimates the cost in wei of executing the action at the fee cap of the fee policy, which is the most we'd
+// pay, including the L1 data fee if the chain is a rollup. The cost of an initiation includes the approval it's expected
+// to need.
+func (wallet *wallet) ActionCost(ctx context.Context, action swap.Action) (*big.Int, error) {
+	gas, ok := EstimatedGas[action]
+	if !ok {
+		return nil, fmt.Errorf("unknown action = %v", action)
+	}
+	approveGas := uint64(0)
+	if action == swap.ActionInitiate {
+		var err error
+		approveGas, err = wallet.approvalGas(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, gasPrice, err := wallet.suggestFees(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if gasPrice == nil {
+		// The chain doesn't support EIP-1559, the txs are sent at the gas price suggested by the node
+		gasPrice, err = wallet.client.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cost := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gas+approveGas))
+
+	data, err := ActionCalldata(action)
+	if err != nil {
+		return nil, err
+	}
+	l1Fee, err := L1Fee(ctx, wallet.client, wallet.options.Rollup, wallet.options.SwapAddr, data)
+	if err != nil {
+		return nil, err
+	}
+	cost.Add(cost, l1Fee)
+	if approveGas == 0 {
+		return cost, nil
+	}
+
+	// The approval is a tx of its own, so it pays its own L1 data fee
+	approveData, err := approveCalldata()
+	if err != nil {
+		return nil, err
+	}
+	approveFee, err := L1Fee(ctx, wallet.client, wallet.options.Rollup, wallet.options.SwapAddr, approveData)
+	if err != nil {
+		return nil, err
+	}
+	return cost.Add(cost, approveFee), nil
+}
+
+// approveCalldata returns the calldata of a typical approval of the token.
+func approveCalldata() ([]byte, error) {
+	tokenABI, err := erc20.ERC20MetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	word := common.HexToHash("0x" + strings.Repeat("ff", 32))
+	return tokenABI.Pack("approve", common.BytesToAddress(word[:20]), word.Big())
+}
+
+// L1Fee estimates the L1 data fee in wei of calling the contract with the data on the rollup. It's always 0 for chains
+// which are not rollups.
+func L1Fee(ctx context.Context, client Backend, rollup Rollup, to common.Address, data []byte) (*big.Int, error) {
+	parsed, err := abi.JSON(strings.NewReader(l1FeeABI))
+	if err != nil {
+		return nil, err
+	}
+
+	switch rollup {
+	case RollupNone:
+		return big.NewInt(0), nil
+	case RollupOptimism:
+		input, err := parsed.Pack("getL1Fee", data)
+		if err != nil {
+			return nil, err
+		}
+		output, err := client.CallContract(ctx, ethereum.CallMsg{To: &OptimismGasPriceOracle, Data: input}, nil)
+		if err != nil {
+			return nil, err
+		}
+		values, err := parsed.Unpack("getL1Fee", output)
+		if err != nil {
+			return nil, err
+		}
+		return values[0].(*big.Int), nil
+	case RollupArbitrum:
+		input, err := parsed.Pack("gasEstimateL1Component", to, false, data)
+		if err != nil {
+			return nil, err
+		}
+		output, err := client.CallContract(ctx, ethereum.CallMsg{To: &ArbitrumNodeInterface, Data: input}, nil)
+		if err != nil {
+			return nil, err
+		}
+		values, err := parsed.Unpack("gasEstimateL1Component", output)
+		if err != nil {
+			return nil, err
+		}
+
+		// The L1 component is charged as extra L2 gas at the L2 base fee
+		l1Gas := new(big.Int).SetUint64(values[0].(uint64))
+		return l1Gas.Mul(l1Gas, values[1].(*big.Int)), nil
+	default:
+		return nil, fmt.Errorf("unknown rollup = %v", rollup)
+	}
+}
@@ -0,0 +1,236 @@
+package ethswap
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/catalogfi/blockchain/evm/bindings/contracts/htlc/gardenhtlc"
+	"github.com/catalogfi/cobi/pkg/swap"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// Multicall3Address is the address of the Multicall3 contract, which is deployed at the same address on most evm
+// chains.
+var Multicall3Address = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+const multicall3ABI = `[{"inputs":[{"components":[{"internalType":"address","name":"target","type":"address"},{"internalType":"bool","name":"allowFailure","type":"bool"},{"internalType":"bytes","name":"callData","type":"bytes"}],"internalType":"struct Multicall3.Call3[]","name":"calls","type":"tuple[]"}],"name":"aggregate3","outputs":[{"components":[{"internalType":"bool","name":"success","type":"bool"},{"internalType":"bytes","name":"returnData","type":"bytes"}],"internalType":"struct Multicall3.Result[]","name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"}]`
+
+// multicall3Call is the Call3 struct of Multicall3.
+type multicall3Call struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+// Call is a swap action to be executed as part of a batch tx.
+type Call struct {
+	Action swap.Action
+	Swap   Swap
+	Secret []byte // secret of a redeem
+}
+
+// Batchable tells if the action can be executed as part of a batch tx. Initiations of native HTLCs are always sent as
+// single txs, since initiating a native HTLC with a signature through Multicall3 has not been verified.
+func (wallet *wallet) Batchable(action swap.Action) bool {
+	if wallet.options.Multicall == (common.Address{}) {
+		return false
+	}
+	return !wallet.options.Native || action != swap.ActionInitiate
+}
+
+// BatchExecute submits the calls in a single Multicall3 tx. Each call is allowed to fail without reverting the others,
+// use CallSucceeded to check the result of each call once the tx is mined. Since the HTLC sees the Multicall3 contract
+// as the sender, initiations are sent with an EIP-712 signature of the wallet. All the calls must be Batchable.
+func (wallet *wallet) BatchExecute(ctx context.Context, calls []Call) (*types.Transaction, error) {
+	if wallet.options.Multicall == (common.Address{}) {
+		return nil, fmt.Errorf("multicall not enabled")
+	}
+	if len(calls) == 0 {
+		return nil, fmt.Errorf("empty batch")
+	}
+
+	mcCalls := make([]multicall3Call, len(calls))
+	for i, call := range calls {
+		if !wallet.Batchable(call.Action) {
+			return nil, fmt.Errorf("%v can't be batched", call.Action)
+		}
+		data, err := wallet.callData(ctx, call)
+		if err != nil {
+			return nil, err
+		}
+		mcCalls[i] = multicall3Call{
+			Target:       wallet.options.SwapAddr,
+			AllowFailure: true,
+			CallData:     data,
+		}
+	}
+
+	// Make sure the HTLC contract can spend the tokens of all the initiations
+	initiated := big.NewInt(0)
+	for _, call := range calls {
+		if call.Action == swap.ActionInitiate {
+			initiated.Add(initiated, call.Swap.Amount)
+		}
+	}
+	wallet.approvalMu.Lock()
+	defer wallet.approvalMu.Unlock()
+	approving, err := wallet.ensureAllowance(ctx, initiated)
+	if err != nil {
+		return nil, fmt.Errorf("approve %v, %v", initiated, err)
+	}
+
+	parsed, err := abi.JSON(strings.NewReader(multicall3ABI))
+	if err != nil {
+		return nil, err
+	}
+	multicall := bind.NewBoundContract(wallet.options.Multicall, parsed, wallet.client, wallet.client, wallet.client)
+	f := func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		if approving {
+			opts.GasLimit = unestimatedGas(calls)
+		}
+		return multicall.Transact(opts, "aggregate3", mcCalls)
+	}
+	tx, err := wallet.transact(ctx, f)
+	if approving {
+		return tx, wallet.spendApproval(initiated, err)
+	}
+	return tx, err
+}
+
+// callData returns the calldata of the call to the HTLC contract.
+func (wallet *wallet) callData(ctx context.Context, call Call) ([]byte, error) {
+	parsed, err := htlcABI(wallet.options.Native)
+	if err != nil {
+		return nil, err
+	}
+
+	switch call.Action {
+	case swap.ActionInitiate:
+		signature, err := wallet.initiateSignature(ctx, call.Swap)
+		if err != nil {
+			return nil, err
+		}
+		return parsed.Pack("initiateWithSignature", call.Swap.Redeemer, call.Swap.Expiry, call.Swap.Amount, call.Swap.SecretHash, signature)
+	case swap.ActionRedeem:
+		return parsed.Pack("redeem", call.Swap.ID, call.Secret)
+	case swap.ActionRefund:
+		return parsed.Pack("refund", call.Swap.ID)
+	default:
+		return nil, fmt.Errorf("unknown action = %v", call.Action)
+	}
+}
+
+// initiateSignature signs the EIP-712 Initiate message of the HTLC contract.
+func (wallet *wallet) initiateSignature(ctx context.Context, swap Swap) ([]byte, error) {
+	htlc, err := gardenhtlc.NewGardenHTLCCaller(wallet.options.SwapAddr, wallet.client)
+	if err != nil {
+		return nil, err
+	}
+	domain, err := htlc.Eip712Domain(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, err
+	}
+	typedData := apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+			"Initiate": {
+				{Name: "redeemer", Type: "address"},
+				{Name: "timelock", Type: "uint256"},
+				{Name: "amount", Type: "uint256"},
+				{Name: "secretHash", Type: "bytes32"},
+			},
+		},
+		PrimaryType: "Initiate",
+		Domain: apitypes.TypedDataDomain{
+			Name:              domain.Name,
+			Version:           domain.Version,
+			ChainId:           (*math.HexOrDecimal256)(domain.ChainId),
+			VerifyingContract: domain.VerifyingContract.Hex(),
+		},
+		Message: apitypes.TypedDataMessage{
+			"redeemer":   swap.Redeemer.Hex(),
+			"timelock":   swap.Expiry,
+			"amount":     swap.Amount,
+			"secretHash": swap.SecretHash,
+		},
+	}
+	hash, _, err := apitypes.TypedDataAndHash(typedData)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := crypto.Sign(hash, wallet.key)
+	if err != nil {
+		return nil, err
+	}
+	signature[crypto.RecoveryIDOffset] += 27
+	return signature, nil
+}
+
+// CallSucceeded tells if the call of a batch tx succeeded by looking for the event the HTLC emits for it in the receipt.
+func CallSucceeded(receipt *types.Receipt, htlc common.Address, call Call) (bool, error) {
+	htlcABI, err := gardenhtlc.GardenHTLCMetaData.GetAbi()
+	if err != nil {
+		return false, err
+	}
+	var event abi.Event
+	switch call.Action {
+	case swap.ActionInitiate:
+		event = htlcABI.Events["Initiated"]
+	case swap.ActionRedeem:
+		event = htlcABI.Events["Redeemed"]
+	case swap.ActionRefund:
+		event = htlcABI.Events["Refunded"]
+	default:
+		return false, fmt.Errorf("unknown action = %v", call.Action)
+	}
+
+	for _, log := range receipt.Logs {
+		if log.Address != htlc || len(log.Topics) < 2 {
+			continue
+		}
+		if log.Topics[0] == event.ID && log.Topics[1] == common.Hash(call.Swap.ID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CallRevertReason replays a failed call of a batch tx on top of the state of the block before the tx is mined, and
+// returns the revert reason.
+func (wallet *wallet) CallRevertReason(ctx context.Context, call Call, block *big.Int) (string, error) {
+	data, err := wallet.callData(ctx, call)
+	if err != nil {
+		return "", err
+	}
+	msg := ethereum.CallMsg{
+		From: wallet.options.Multicall,
+		To:   &wallet.options.SwapAddr,
+		Data: data,
+	}
+	var previous *big.Int
+	if block != nil && block.Sign() > 0 {
+		previous = new(big.Int).Sub(block, big.NewInt(1))
+	}
+	_, err = wallet.client.CallContract(ctx, msg, previous)
+	if err == nil {
+		return "", nil
+	}
+	if reason := DecodeRevert(err); reason != "" {
+		return reason, nil
+	}
+	return "", err
+}
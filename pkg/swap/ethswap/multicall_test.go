@@ -0,0 +1,86 @@
+package ethswap_test
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/catalogfi/blockchain/evm/bindings/contracts/htlc/gardenhtlc"
+	"github.com/catalogfi/cobi/pkg/swap"
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Batching through multicall", func() {
+	newSwap := func(initiator, redeemer common.Address) ethswap.Swap {
+		return ethswap.NewSwap(initiator, redeemer, swapAddr, common.Hash{1}, big.NewInt(1e8), big.NewInt(1000))
+	}
+
+	It("should send native initiations as single txs", func(ctx context.Context) {
+		chainID, err := backend.Client().ChainID(ctx)
+		Expect(err).To(BeNil())
+		options := ethswap.NewOptions(chainID, swapAddr).WithTimeout(time.Minute).WithMulticall(ethswap.Multicall3Address)
+		tokenWallet, err := ethswap.NewWallet(options, aliceKey, backend.Client())
+		Expect(err).To(BeNil())
+		nativeWallet, err := ethswap.NewWallet(options.WithNative(nil), bobKey, backend.Client())
+		Expect(err).To(BeNil())
+		noMulticall, err := ethswap.NewWallet(options.WithMulticall(common.Address{}), aliceKey, backend.Client())
+		Expect(err).To(BeNil())
+
+		for _, action := range []swap.Action{swap.ActionInitiate, swap.ActionRedeem, swap.ActionRefund} {
+			Expect(tokenWallet.Batchable(action)).Should(BeTrue())
+			Expect(noMulticall.Batchable(action)).Should(BeFalse())
+		}
+		Expect(nativeWallet.Batchable(swap.ActionInitiate)).Should(BeFalse())
+		Expect(nativeWallet.Batchable(swap.ActionRedeem)).Should(BeTrue())
+		Expect(nativeWallet.Batchable(swap.ActionRefund)).Should(BeTrue())
+
+		By("A batched native initiation is refused without using a nonce")
+		nonce, err := backend.Client().PendingNonceAt(ctx, nativeWallet.Address())
+		Expect(err).To(BeNil())
+		calls := []ethswap.Call{
+			{Action: swap.ActionInitiate, Swap: newSwap(nativeWallet.Address(), tokenWallet.Address())},
+			{Action: swap.ActionRefund, Swap: newSwap(nativeWallet.Address(), tokenWallet.Address())},
+		}
+		_, err = nativeWallet.BatchExecute(ctx, calls)
+		Expect(err).ShouldNot(BeNil())
+		after, err := backend.Client().PendingNonceAt(ctx, nativeWallet.Address())
+		Expect(err).To(BeNil())
+		Expect(after).Should(Equal(nonce))
+	})
+
+	It("should tell which calls of a batch succeeded from the htlc events", func() {
+		htlcABI, err := gardenhtlc.GardenHTLCMetaData.GetAbi()
+		Expect(err).To(BeNil())
+		initiator := crypto.PubkeyToAddress(aliceKey.PublicKey)
+		redeemer := crypto.PubkeyToAddress(bobKey.PublicKey)
+		initiated := newSwap(initiator, redeemer)
+		redeemed := ethswap.NewSwap(initiator, redeemer, swapAddr, common.Hash{2}, big.NewInt(1e8), big.NewInt(1000))
+		receipt := &types.Receipt{Logs: []*types.Log{
+			{Address: swapAddr, Topics: []common.Hash{htlcABI.Events["Initiated"].ID, initiated.ID, initiated.SecretHash}},
+			{Address: swapAddr, Topics: []common.Hash{htlcABI.Events["Redeemed"].ID, redeemed.ID, redeemed.SecretHash}},
+			{Address: common.HexToAddress("0x1"), Topics: []common.Hash{htlcABI.Events["Refunded"].ID, redeemed.ID}},
+		}}
+
+		succeeded := func(action swap.Action, swap ethswap.Swap) bool {
+			ok, err := ethswap.CallSucceeded(receipt, swapAddr, ethswap.Call{Action: action, Swap: swap})
+			Expect(err).To(BeNil())
+			return ok
+		}
+		Expect(succeeded(swap.ActionInitiate, initiated)).Should(BeTrue())
+		Expect(succeeded(swap.ActionRedeem, redeemed)).Should(BeTrue())
+		Expect(succeeded(swap.ActionRedeem, initiated)).Should(BeFalse())
+		Expect(succeeded(swap.ActionInitiate, redeemed)).Should(BeFalse())
+
+		// Events of other contracts don't count
+		Expect(succeeded(swap.ActionRefund, redeemed)).Should(BeFalse())
+
+		_, err = ethswap.CallSucceeded(receipt, swapAddr, ethswap.Call{Action: "unknown"})
+		Expect(err).ShouldNot(BeNil())
+	})
+})
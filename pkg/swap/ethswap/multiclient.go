@@ -0,0 +1,553 @@
+package ethswap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// MultiClientOptions decides how the providers of a MultiClient are health-checked.
+type MultiClientOptions struct {
+	CheckInterval time.Duration // interval of the health checks, default to 15 seconds
+	CheckTimeout  time.Duration // timeout of a health check, default to 5 seconds
+	MaxHeadLag    uint64        // providers more than this many blocks behind the highest head are unhealthy, default to 5
+	MaxErrorRate  float64       // providers whose recent error rate is above this are unhealthy, default to 0.5
+}
+
+// DefaultMultiClientOptions checks the providers every 15 seconds.
+var DefaultMultiClientOptions = MultiClientOptions{
+	CheckInterval: 15 * time.Second,
+	CheckTimeout:  5 * time.Second,
+	MaxHeadLag:    5,
+	MaxErrorRate:  0.5,
+}
+
+// ProviderHealth is the latest health check result of a provider.
+type ProviderHealth struct {
+	URL       string
+	Head      uint64        // latest block reported by the provider
+	Latency   time.Duration // latency of the latest health check
+	ErrorRate float64       // moving average of the failed requests
+	Healthy   bool
+}
+
+type provider struct {
+	client Backend
+	health ProviderHealth
+	alive  bool // whether the latest health check succeeded
+}
+
+// MultiClient is a Backend over multiple RPC providers of the same chain. Reads go to the healthiest provider and fail
+// over to the others when the provider can't be reached, txs are broadcast to all of them.
+type MultiClient struct {
+	opts      MultiClientOptions
+	mu        *sync.RWMutex
+	providers []*provider
+	quit      chan struct{}
+}
+
+// DialMulti connects to the providers and starts health-checking them. It only fails if none of the providers can be
+// dialed, the providers which can't be dialed are ignored.
+func DialMulti(urls []string, opts MultiClientOptions) (*MultiClient, error) {
+	clients := map[string]Backend{}
+	var dialErr error
+	for _, url := range urls {
+		client, err := ethclient.Dial(url)
+		if err != nil {
+			dialErr = fmt.Errorf("dial %v, %v", url, err)
+			continue
+		}
+		clients[url] = client
+	}
+	if len(clients) == 0 {
+		if dialErr == nil {
+			dialErr = fmt.Errorf("no rpc url")
+		}
+		return nil, dialErr
+	}
+	return NewMultiClient(urls, clients, opts), nil
+}
+
+// NewMultiClient returns a MultiClient over the given clients, the urls decide the initial preference of the providers.
+func NewMultiClient(urls []string, clients map[string]Backend, opts MultiClientOptions) *MultiClient {
+	if opts.CheckInterval <= 0 {
+		opts.CheckInterval = DefaultMultiClientOptions.CheckInterval
+	}
+	if opts.CheckTimeout <= 0 {
+		opts.CheckTimeout = DefaultMultiClientOptions.CheckTimeout
+	}
+	if opts.MaxHeadLag == 0 {
+		opts.MaxHeadLag = DefaultMultiClientOptions.MaxHeadLag
+	}
+	if opts.MaxErrorRate <= 0 {
+		opts.MaxErrorRate = DefaultMultiClientOptions.MaxErrorRate
+	}
+
+	mc := &MultiClient{
+		opts:      opts,
+		mu:        new(sync.RWMutex),
+		providers: []*provider{},
+		quit:      make(chan struct{}),
+	}
+	for _, url := range urls {
+		client, ok := clients[url]
+		if !ok {
+			continue
+		}
+		mc.providers = append(mc.providers, &provider{
+			client: client,
+			health: ProviderHealth{URL: url, Healthy: true},
+			alive:  true,
+		})
+	}
+
+	mc.check()
+	go mc.checkWorker(mc.quit)
+	return mc
+}
+
+// Close stops the health checks.
+func (mc *MultiClient) Close() {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if mc.quit != nil {
+		close(mc.quit)
+		mc.quit = nil
+	}
+}
+
+// Health returns the latest health of the providers, ordered by preference.
+func (mc *MultiClient) Health() []ProviderHealth {
+	providers := mc.ranked()
+	health := make([]ProviderHealth, 0, len(providers))
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	for _, p := range providers {
+		health = append(health, p.health)
+	}
+	return health
+}
+
+func (mc *MultiClient) checkWorker(quit chan struct{}) {
+	ticker := time.NewTicker(mc.opts.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			mc.check()
+		case <-quit:
+			return
+		}
+	}
+}
+
+// check gets the latest block from all the providers, and marks the ones which are unreachable, lagging behind or
+// failing too many requests as unhealthy.
+func (mc *MultiClient) check() {
+	type result struct {
+		head    uint64
+		latency time.Duration
+		err     error
+	}
+	results := make([]result, len(mc.providers))
+	wg := new(sync.WaitGroup)
+	for i, p := range mc.providers {
+		wg.Add(1)
+		go func(i int, client Backend) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), mc.opts.CheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			head, err := client.BlockNumber(ctx)
+			results[i] = result{head: head, latency: time.Since(start), err: err}
+		}(i, p.client)
+	}
+	wg.Wait()
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	var highest uint64
+	for i, p := range mc.providers {
+		p.alive = results[i].err == nil
+		p.health.ErrorRate = movingRate(p.health.ErrorRate, !p.alive)
+		if p.alive {
+			p.health.Head = results[i].head
+			p.health.Latency = results[i].latency
+			if p.health.Head > highest {
+				highest = p.health.Head
+			}
+		}
+	}
+	for _, p := range mc.providers {
+		p.health.Healthy = p.alive && p.health.Head+mc.opts.MaxHeadLag >= highest && p.health.ErrorRate <= mc.opts.MaxErrorRate
+	}
+}
+
+// movingRate updates the moving average of the error rate with the result of a request.
+func movingRate(rate float64, failed bool) float64 {
+	if failed {
+		return rate*0.9 + 0.1
+	}
+	return rate * 0.9
+}
+
+// ranked returns the providers ordered by preference. Healthy providers come first ordered by latency, followed by the
+// unhealthy ones ordered by their heads.
+func (mc *MultiClient) ranked() []*provider {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+
+	providers := make([]*provider, len(mc.providers))
+	copy(providers, mc.providers)
+	sort.SliceStable(providers, func(i, j int) bool {
+		a, b := providers[i].health, providers[j].health
+		if a.Healthy != b.Healthy {
+			return a.Healthy
+		}
+		if a.Healthy {
+			return a.Latency < b.Latency
+		}
+		return a.Head > b.Head
+	})
+	return providers
+}
+
+func (mc *MultiClient) record(p *provider, failed bool) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	p.health.ErrorRate = movingRate(p.health.ErrorRate, failed)
+}
+
+// isProviderError tells if the request failed because of the provider rather than the request itself, in which case
+// another provider may succeed.
+func isProviderError(err error) bool {
+	if err == nil || errors.Is(err, ethereum.NotFound) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	// The provider has processed the request if it replies with a json-rpc error, unless it's rate limiting us.
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr.ErrorCode() == -32005
+	}
+	return true
+}
+
+// read sends the request to the healthiest provider, and fails over to the next one if the provider can't serve it.
+func (mc *MultiClient) read(ctx context.Context, f func(client Backend) error) error {
+	var err error
+	for _, p := range mc.ranked() {
+		err = f(p.client)
+		failed := isProviderError(err)
+		mc.record(p, failed)
+		if !failed || ctx.Err() != nil {
+			return err
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("no rpc provider")
+	}
+	return err
+}
+
+// SendTransaction broadcasts the tx to all the providers. It returns as soon as one of the providers accepts the tx, and
+// the broadcast to the slower providers carries on. If none of them accepts it, the error of the healthiest provider is
+// returned.
+func (mc *MultiClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	providers := mc.ranked()
+	if len(providers) == 0 {
+		return fmt.Errorf("no rpc provider")
+	}
+
+	// Don't let the caller abort the broadcast to the slower providers once it returns
+	broadcastCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), mc.opts.CheckInterval)
+	type result struct {
+		index int
+		err   error
+	}
+	results := make(chan result, len(providers))
+	wg := new(sync.WaitGroup)
+	for i, p := range providers {
+		wg.Add(1)
+		go func(i int, p *provider) {
+			defer wg.Done()
+			err := p.client.SendTransaction(broadcastCtx, tx)
+			mc.record(p, isProviderError(err))
+			results <- result{index: i, err: err}
+		}(i, p)
+	}
+	go func() {
+		wg.Wait()
+		cancel()
+	}()
+
+	errs := make([]error, len(providers))
+	for range providers {
+		select {
+		case res := <-results:
+			if res.err == nil {
+				return nil
+			}
+			errs[res.index] = res.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return errs[0]
+}
+
+func (mc *MultiClient) ChainID(ctx context.Context) (*big.Int, error) {
+	var id *big.Int
+	err := mc.read(ctx, func(client Backend) (err error) {
+		id, err = client.ChainID(ctx)
+		return
+	})
+	return id, err
+}
+
+func (mc *MultiClient) BlockNumber(ctx context.Context) (uint64, error) {
+	var number uint64
+	err := mc.read(ctx, func(client Backend) (err error) {
+		number, err = client.BlockNumber(ctx)
+		return
+	})
+	return number, err
+}
+
+func (mc *MultiClient) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	var block *types.Block
+	err := mc.read(ctx, func(client Backend) (err error) {
+		block, err = client.BlockByHash(ctx, hash)
+		return
+	})
+	return block, err
+}
+
+func (mc *MultiClient) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	var block *types.Block
+	err := mc.read(ctx, func(client Backend) (err error) {
+		block, err = client.BlockByNumber(ctx, number)
+		return
+	})
+	return block, err
+}
+
+func (mc *MultiClient) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	var header *types.Header
+	err := mc.read(ctx, func(client Backend) (err error) {
+		header, err = client.HeaderByHash(ctx, hash)
+		return
+	})
+	return header, err
+}
+
+func (mc *MultiClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	var header *types.Header
+	err := mc.read(ctx, func(client Backend) (err error) {
+		header, err = client.HeaderByNumber(ctx, number)
+		return
+	})
+	return header, err
+}
+
+func (mc *MultiClient) TransactionCount(ctx context.Context, blockHash common.Hash) (uint, error) {
+	var count uint
+	err := mc.read(ctx, func(client Backend) (err error) {
+		count, err = client.TransactionCount(ctx, blockHash)
+		return
+	})
+	return count, err
+}
+
+func (mc *MultiClient) TransactionInBlock(ctx context.Context, blockHash common.Hash, index uint) (*types.Transaction, error) {
+	var tx *types.Transaction
+	err := mc.read(ctx, func(client Backend) (err error) {
+		tx, err = client.TransactionInBlock(ctx, blockHash, index)
+		return
+	})
+	return tx, err
+}
+
+func (mc *MultiClient) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	var tx *types.Transaction
+	var isPending bool
+	err := mc.read(ctx, func(client Backend) (err error) {
+		tx, isPending, err = client.TransactionByHash(ctx, hash)
+		return
+	})
+	return tx, isPending, err
+}
+
+func (mc *MultiClient) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	var receipt *types.Receipt
+	err := mc.read(ctx, func(client Backend) (err error) {
+		receipt, err = client.TransactionReceipt(ctx, hash)
+		return
+	})
+	return receipt, err
+}
+
+func (mc *MultiClient) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	var balance *big.Int
+	err := mc.read(ctx, func(client Backend) (err error) {
+		balance, err = client.BalanceAt(ctx, account, blockNumber)
+		return
+	})
+	return balance, err
+}
+
+func (mc *MultiClient) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	var value []byte
+	err := mc.read(ctx, func(client Backend) (err error) {
+		value, err = client.StorageAt(ctx, account, key, blockNumber)
+		return
+	})
+	return value, err
+}
+
+func (mc *MultiClient) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	var code []byte
+	err := mc.read(ctx, func(client Backend) (err error) {
+		code, err = client.CodeAt(ctx, account, blockNumber)
+		return
+	})
+	return code, err
+}
+
+func (mc *MultiClient) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	var nonce uint64
+	err := mc.read(ctx, func(client Backend) (err error) {
+		nonce, err = client.NonceAt(ctx, account, blockNumber)
+		return
+	})
+	return nonce, err
+}
+
+func (mc *MultiClient) PendingBalanceAt(ctx context.Context, account common.Address) (*big.Int, error) {
+	var balance *big.Int
+	err := mc.read(ctx, func(client Backend) (err error) {
+		balance, err = client.PendingBalanceAt(ctx, account)
+		return
+	})
+	return balance, err
+}
+
+func (mc *MultiClient) PendingStorageAt(ctx context.Context, account common.Address, key common.Hash) ([]byte, error) {
+	var value []byte
+	err := mc.read(ctx, func(client Backend) (err error) {
+		value, err = client.PendingStorageAt(ctx, account, key)
+		return
+	})
+	return value, err
+}
+
+func (mc *MultiClient) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	var code []byte
+	err := mc.read(ctx, func(client Backend) (err error) {
+		code, err = client.PendingCodeAt(ctx, account)
+		return
+	})
+	return code, err
+}
+
+func (mc *MultiClient) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	var nonce uint64
+	err := mc.read(ctx, func(client Backend) (err error) {
+		nonce, err = client.PendingNonceAt(ctx, account)
+		return
+	})
+	return nonce, err
+}
+
+func (mc *MultiClient) PendingTransactionCount(ctx context.Context) (uint, error) {
+	var count uint
+	err := mc.read(ctx, func(client Backend) (err error) {
+		count, err = client.PendingTransactionCount(ctx)
+		return
+	})
+	return count, err
+}
+
+func (mc *MultiClient) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	var output []byte
+	err := mc.read(ctx, func(client Backend) (err error) {
+		output, err = client.CallContract(ctx, call, blockNumber)
+		return
+	})
+	return output, err
+}
+
+func (mc *MultiClient) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	var gas uint64
+	err := mc.read(ctx, func(client Backend) (err error) {
+		gas, err = client.EstimateGas(ctx, call)
+		return
+	})
+	return gas, err
+}
+
+func (mc *MultiClient) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	var price *big.Int
+	err := mc.read(ctx, func(client Backend) (err error) {
+		price, err = client.SuggestGasPrice(ctx)
+		return
+	})
+	return price, err
+}
+
+func (mc *MultiClient) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	var tip *big.Int
+	err := mc.read(ctx, func(client Backend) (err error) {
+		tip, err = client.SuggestGasTipCap(ctx)
+		return
+	})
+	return tip, err
+}
+
+func (mc *MultiClient) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error) {
+	var history *ethereum.FeeHistory
+	err := mc.read(ctx, func(client Backend) (err error) {
+		history, err = client.FeeHistory(ctx, blockCount, lastBlock, rewardPercentiles)
+		return
+	})
+	return history, err
+}
+
+func (mc *MultiClient) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	err := mc.read(ctx, func(client Backend) (err error) {
+		logs, err = client.FilterLogs(ctx, query)
+		return
+	})
+	return logs, err
+}
+
+func (mc *MultiClient) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	var sub ethereum.Subscription
+	err := mc.read(ctx, func(client Backend) (err error) {
+		sub, err = client.SubscribeFilterLogs(ctx, query, ch)
+		return
+	})
+	return sub, err
+}
+
+func (mc *MultiClient) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	var sub ethereum.Subscription
+	err := mc.read(ctx, func(client Backend) (err error) {
+		sub, err = client.SubscribeNewHead(ctx, ch)
+		return
+	})
+	return sub, err
+}
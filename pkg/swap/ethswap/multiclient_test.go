@@ -0,0 +1,176 @@
+package ethswap_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// rpcError is a json-rpc error replied by a provider.
+type rpcError struct {
+	code int
+	msg  string
+}
+
+func (err rpcError) Error() string {
+	return err.msg
+}
+
+func (err rpcError) ErrorCode() int {
+	return err.code
+}
+
+// providerBackend is a provider which can be taken down, and fails the requests with the error we set.
+type providerBackend struct {
+	ethswap.Backend
+	mu     *sync.Mutex
+	head   uint64
+	delay  time.Duration
+	down   bool
+	err    error // error of the requests other than the health checks
+	reads  int
+	sent   int
+	reject error
+}
+
+func newProviderBackend(head uint64, delay time.Duration) *providerBackend {
+	return &providerBackend{mu: new(sync.Mutex), head: head, delay: delay}
+}
+
+func (backend *providerBackend) set(f func(backend *providerBackend)) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	f(backend)
+}
+
+func (backend *providerBackend) BlockNumber(ctx context.Context) (uint64, error) {
+	time.Sleep(backend.delay)
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if backend.down {
+		return 0, errors.New("connection refused")
+	}
+	return backend.head, nil
+}
+
+func (backend *providerBackend) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	backend.reads++
+	if backend.down {
+		return nil, errors.New("connection refused")
+	}
+	if backend.err != nil {
+		return nil, backend.err
+	}
+	return &types.Receipt{TxHash: hash, BlockNumber: new(big.Int).SetUint64(backend.head)}, nil
+}
+
+func (backend *providerBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	backend.sent++
+	if backend.down {
+		return errors.New("connection refused")
+	}
+	return backend.reject
+}
+
+var _ = Describe("Multi-provider client", func() {
+	urls := []string{"http://a", "http://b"}
+	opts := ethswap.MultiClientOptions{CheckInterval: time.Hour, MaxHeadLag: 5}
+
+	var a, b *providerBackend
+	var mc *ethswap.MultiClient
+	BeforeEach(func() {
+		// a answers faster, so it's preferred while it's healthy
+		a = newProviderBackend(100, 0)
+		b = newProviderBackend(100, 20*time.Millisecond)
+	})
+	JustBeforeEach(func() {
+		mc = ethswap.NewMultiClient(urls, map[string]ethswap.Backend{urls[0]: a, urls[1]: b}, opts)
+	})
+	AfterEach(func() {
+		mc.Close()
+	})
+
+	It("should read from the healthiest provider and fail over when it can't be reached", func(ctx context.Context) {
+		receipt, err := mc.TransactionReceipt(ctx, common.Hash{})
+		Expect(err).Should(BeNil())
+		Expect(receipt).ShouldNot(BeNil())
+		Expect(a.reads).Should(Equal(1))
+		Expect(b.reads).Should(Equal(0))
+
+		a.set(func(backend *providerBackend) { backend.down = true })
+		_, err = mc.TransactionReceipt(ctx, common.Hash{})
+		Expect(err).Should(BeNil())
+		Expect(a.reads).Should(Equal(2))
+		Expect(b.reads).Should(Equal(1))
+	})
+
+	It("should not fail over when the provider has processed the request", func(ctx context.Context) {
+		a.set(func(backend *providerBackend) { backend.err = ethereum.NotFound })
+		_, err := mc.TransactionReceipt(ctx, common.Hash{})
+		Expect(err).Should(MatchError(ethereum.NotFound))
+
+		a.set(func(backend *providerBackend) { backend.err = rpcError{code: -32000, msg: "execution reverted"} })
+		_, err = mc.TransactionReceipt(ctx, common.Hash{})
+		Expect(err).Should(MatchError("execution reverted"))
+		Expect(b.reads).Should(Equal(0))
+
+		By("Rate limits are the provider's fault")
+		a.set(func(backend *providerBackend) { backend.err = rpcError{code: -32005, msg: "rate limited"} })
+		_, err = mc.TransactionReceipt(ctx, common.Hash{})
+		Expect(err).Should(BeNil())
+		Expect(b.reads).Should(Equal(1))
+	})
+
+	Context("when a provider lags behind", func() {
+		BeforeEach(func() {
+			a.head = 90
+		})
+
+		It("should prefer the providers at the head", func(ctx context.Context) {
+			health := mc.Health()
+			Expect(health).Should(HaveLen(2))
+			Expect(health[0].URL).Should(Equal(urls[1]))
+			Expect(health[0].Healthy).Should(BeTrue())
+			Expect(health[1].URL).Should(Equal(urls[0]))
+			Expect(health[1].Healthy).Should(BeFalse())
+
+			receipt, err := mc.TransactionReceipt(ctx, common.Hash{})
+			Expect(err).Should(BeNil())
+			Expect(receipt.BlockNumber.Uint64()).Should(Equal(uint64(100)))
+		})
+	})
+
+	It("should broadcast txs to all the providers", func(ctx context.Context) {
+		tx := types.NewTx(&types.LegacyTx{})
+		a.set(func(backend *providerBackend) { backend.down = true })
+		Expect(mc.SendTransaction(ctx, tx)).Should(Succeed())
+		Eventually(func() int {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			return a.sent
+		}).Should(Equal(1))
+		Eventually(func() int {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			return b.sent
+		}).Should(Equal(1))
+
+		By("It fails only if none of them accepts the tx")
+		b.set(func(backend *providerBackend) { backend.reject = errors.New("nonce too low") })
+		Expect(mc.SendTransaction(ctx, tx)).ShouldNot(Succeed())
+	})
+})
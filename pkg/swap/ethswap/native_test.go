@@ -0,0 +1,444 @@
+package ethswap_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/asm"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// nativeHTLCRuntime is a minimal native HTLC implementing ethswap.NativeHTLCMetaData. The order ID is
+// sha256(secretHash, initiator) like the GardenHTLC, and the fields of an order are stored at the slots following the
+// order ID: isFulfilled, initiator, redeemer, initiatedAt, timelock, amount and secretHash. It reverts without a reason.
+//
+// The bindings we depend on don't ship a native HTLC and there's no compiler in the build, so the contract is assembled
+// here from the selectors and the event topics of the ABI.
+const nativeHTLCRuntime = `
+	PUSH 0
+	CALLDATALOAD
+	PUSH 0xe0
+	SHR
+	DUP1
+	PUSH %[1]v
+	EQ
+	JUMPI @initiate
+	DUP1
+	PUSH %[2]v
+	EQ
+	JUMPI @redeem
+	DUP1
+	PUSH %[3]v
+	EQ
+	JUMPI @refund
+	DUP1
+	PUSH %[4]v
+	EQ
+	JUMPI @orders
+fail:
+	PUSH 0
+	DUP1
+	REVERT
+initiate:
+	PUSH 68
+	CALLDATALOAD
+	DUP1
+	CALLVALUE
+	EQ
+	ISZERO
+	JUMPI @fail
+	DUP1
+	ISZERO
+	JUMPI @fail
+	PUSH 100
+	CALLDATALOAD
+	PUSH 0
+	MSTORE
+	CALLER
+	PUSH 32
+	MSTORE
+	PUSH 32
+	PUSH 0
+	PUSH 64
+	PUSH 0
+	PUSH 2
+	GAS
+	STATICCALL
+	ISZERO
+	JUMPI @fail
+	PUSH 0
+	MLOAD
+	DUP1
+	PUSH 3
+	ADD
+	SLOAD
+	JUMPI @fail
+	CALLER
+	DUP2
+	PUSH 1
+	ADD
+	SSTORE
+	PUSH 4
+	CALLDATALOAD
+	DUP2
+	PUSH 2
+	ADD
+	SSTORE
+	NUMBER
+	DUP2
+	PUSH 3
+	ADD
+	SSTORE
+	PUSH 36
+	CALLDATALOAD
+	DUP2
+	PUSH 4
+	ADD
+	SSTORE
+	DUP2
+	DUP2
+	PUSH 5
+	ADD
+	SSTORE
+	PUSH 100
+	CALLDATALOAD
+	DUP2
+	PUSH 6
+	ADD
+	SSTORE
+	DUP2
+	PUSH 0
+	MSTORE
+	PUSH 100
+	CALLDATALOAD
+	DUP2
+	PUSH %[5]v
+	PUSH 32
+	PUSH 0
+	LOG3
+	STOP
+redeem:
+	PUSH 4
+	CALLDATALOAD
+	DUP1
+	PUSH 3
+	ADD
+	SLOAD
+	ISZERO
+	JUMPI @fail
+	DUP1
+	SLOAD
+	JUMPI @fail
+	PUSH 68
+	CALLDATALOAD
+	DUP1
+	PUSH 100
+	PUSH 0
+	CALLDATACOPY
+	PUSH 32
+	PUSH 0
+	DUP3
+	PUSH 0
+	PUSH 2
+	GAS
+	STATICCALL
+	ISZERO
+	JUMPI @fail
+	PUSH 0
+	MLOAD
+	DUP3
+	PUSH 6
+	ADD
+	SLOAD
+	EQ
+	ISZERO
+	JUMPI @fail
+	PUSH 1
+	DUP3
+	SSTORE
+	PUSH 0
+	PUSH 0
+	PUSH 0
+	PUSH 0
+	DUP6
+	PUSH 5
+	ADD
+	SLOAD
+	DUP7
+	PUSH 2
+	ADD
+	SLOAD
+	GAS
+	CALL
+	ISZERO
+	JUMPI @fail
+	PUSH 32
+	PUSH 0
+	MSTORE
+	DUP1
+	PUSH 32
+	MSTORE
+	DUP1
+	PUSH 100
+	PUSH 64
+	CALLDATACOPY
+	DUP2
+	PUSH 6
+	ADD
+	SLOAD
+	DUP3
+	PUSH %[6]v
+	DUP4
+	PUSH 31
+	ADD
+	PUSH 5
+	SHR
+	PUSH 5
+	SHL
+	PUSH 64
+	ADD
+	PUSH 0
+	LOG3
+	STOP
+refund:
+	PUSH 4
+	CALLDATALOAD
+	DUP1
+	PUSH 3
+	ADD
+	SLOAD
+	DUP1
+	ISZERO
+	JUMPI @fail
+	DUP2
+	SLOAD
+	JUMPI @fail
+	DUP2
+	PUSH 4
+	ADD
+	SLOAD
+	ADD
+	NUMBER
+	LT
+	JUMPI @fail
+	PUSH 1
+	DUP2
+	SSTORE
+	PUSH 0
+	PUSH 0
+	PUSH 0
+	PUSH 0
+	DUP5
+	PUSH 5
+	ADD
+	SLOAD
+	DUP6
+	PUSH 1
+	ADD
+	SLOAD
+	GAS
+	CALL
+	ISZERO
+	JUMPI @fail
+	DUP1
+	PUSH %[7]v
+	PUSH 0
+	PUSH 0
+	LOG2
+	STOP
+orders:
+	PUSH 4
+	CALLDATALOAD
+	DUP1
+	SLOAD
+	PUSH 0
+	MSTORE
+	DUP1
+	PUSH 1
+	ADD
+	SLOAD
+	PUSH 32
+	MSTORE
+	DUP1
+	PUSH 2
+	ADD
+	SLOAD
+	PUSH 64
+	MSTORE
+	DUP1
+	PUSH 3
+	ADD
+	SLOAD
+	PUSH 96
+	MSTORE
+	DUP1
+	PUSH 4
+	ADD
+	SLOAD
+	PUSH 128
+	MSTORE
+	DUP1
+	PUSH 5
+	ADD
+	SLOAD
+	PUSH 160
+	MSTORE
+	PUSH 192
+	PUSH 0
+	RETURN
+`
+
+// deployNativeHTLC sends the creation tx of the test native HTLC.
+func deployNativeHTLC(transactor *bind.TransactOpts) (common.Address, *types.Transaction, error) {
+	htlcABI, err := ethswap.NativeHTLCMetaData.GetAbi()
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	runtimeCode := fmt.Sprintf(nativeHTLCRuntime,
+		"0x"+hex.EncodeToString(htlcABI.Methods["initiate"].ID),
+		"0x"+hex.EncodeToString(htlcABI.Methods["redeem"].ID),
+		"0x"+hex.EncodeToString(htlcABI.Methods["refund"].ID),
+		"0x"+hex.EncodeToString(htlcABI.Methods["orders"].ID),
+		htlcABI.Events["Initiated"].ID.Hex(),
+		htlcABI.Events["Redeemed"].ID.Hex(),
+		htlcABI.Events["Refunded"].ID.Hex(),
+	)
+	compiler := asm.NewCompiler(false)
+	compiler.Feed(asm.Lex([]byte(runtimeCode), false))
+	output, errs := compiler.Compile()
+	if len(errs) != 0 {
+		return common.Address{}, nil, fmt.Errorf("compile native htlc, %v", errs)
+	}
+	runtime, err := hex.DecodeString(output)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	// Copy the runtime code which follows the 12 bytes of creation code and return it
+	code := []byte{0x61, byte(len(runtime) >> 8), byte(len(runtime)), 0x80, 0x60, 12, 0x60, 0x00, 0x39, 0x60, 0x00, 0xf3}
+	addr, tx, _, err := bind.DeployContract(transactor, *htlcABI, append(code, runtime...), backend.Client())
+	return addr, tx, err
+}
+
+var _ = Describe("Native htlc wallets", func() {
+	var nativeAddr common.Address
+	var options ethswap.Options
+	BeforeEach(func(ctx context.Context) {
+		chainID, err := backend.Client().ChainID(ctx)
+		Expect(err).To(BeNil())
+		transactor, err := bind.NewKeyedTransactorWithChainID(aliceKey, chainID)
+		Expect(err).To(BeNil())
+		transactor.Context = ctx
+		nativeAddr = deploy(ctx, func() (common.Address, *types.Transaction, error) {
+			return deployNativeHTLC(transactor)
+		})
+
+		fees := ethswap.DefaultFeePolicy
+		fees.PriorityFee = big.NewInt(params.GWei)
+		options = ethswap.NewOptions(chainID, nativeAddr).WithTimeout(time.Minute).WithFeePolicy(fees)
+	})
+
+	It("should keep the gas reserve out of the swappable balance and need no approvals", func(ctx context.Context) {
+		reserve := big.NewInt(params.Ether)
+		options := options.WithNative(reserve)
+		wallet, err := ethswap.NewWallet(options, bobKey, backend.Client())
+		Expect(err).To(BeNil())
+
+		balance, err := wallet.Balance(ctx, false)
+		Expect(err).To(BeNil())
+		swappable, err := wallet.TokenBalance(ctx, false)
+		Expect(err).To(BeNil())
+		Expect(swappable).Should(Equal(new(big.Int).Sub(balance, reserve)))
+
+		By("The balance is never negative")
+		wallet, err = ethswap.NewWallet(options.WithNative(new(big.Int).Add(balance, big.NewInt(1))), bobKey, backend.Client())
+		Expect(err).To(BeNil())
+		swappable, err = wallet.TokenBalance(ctx, false)
+		Expect(err).To(BeNil())
+		Expect(swappable.Sign()).Should(Equal(0))
+
+		By("There's nothing to approve")
+		allowance, err := wallet.Allowance(ctx)
+		Expect(err).To(BeNil())
+		Expect(allowance).Should(BeNil())
+		_, err = wallet.Approve(ctx, big.NewInt(1))
+		Expect(err).ShouldNot(BeNil())
+	})
+
+	It("should initiate, redeem and refund swaps of the native asset", func(ctx context.Context) {
+		alice, err := ethswap.NewWallet(options.WithNative(nil), aliceKey, backend.Client())
+		Expect(err).To(BeNil())
+		bob, err := ethswap.NewWallet(options.WithNative(nil), bobKey, backend.Client())
+		Expect(err).To(BeNil())
+
+		newSwap := func(expiry int64) (ethswap.Swap, []byte) {
+			secret := make([]byte, 32)
+			_, err := rand.Read(secret)
+			Expect(err).To(BeNil())
+			return ethswap.NewSwap(alice.Address(), bob.Address(), nativeAddr, sha256.Sum256(secret), big.NewInt(params.Ether), big.NewInt(expiry)), secret
+		}
+		waitMined := func(tx *types.Transaction, err error) {
+			Expect(err).To(BeNil())
+			receipt, err := bind.WaitMined(ctx, backend.Client(), tx)
+			Expect(err).To(BeNil())
+			Expect(receipt.Status).Should(Equal(types.ReceiptStatusSuccessful))
+		}
+		locked := func() *big.Int {
+			balance, err := backend.Client().BalanceAt(ctx, nativeAddr, nil)
+			Expect(err).To(BeNil())
+			return balance
+		}
+
+		By("Alice locks the ether in the contract")
+		swap, secret := newSwap(1000)
+		waitMined(alice.Initiate(ctx, swap))
+		Expect(locked()).Should(Equal(big.NewInt(params.Ether)))
+		initiated, err := swap.Initiated(ctx, backend.Client())
+		Expect(err).To(BeNil())
+		Expect(initiated).Should(BeTrue())
+
+		By("Bob redeems it with the secret")
+		before, err := bob.Balance(ctx, false)
+		Expect(err).To(BeNil())
+		waitMined(bob.Redeem(ctx, swap, secret))
+		after, err := bob.Balance(ctx, false)
+		Expect(err).To(BeNil())
+		Expect(locked().Sign()).Should(Equal(0))
+		Expect(new(big.Int).Sub(after, before).Cmp(big.NewInt(params.Ether / 2))).Should(Equal(1))
+		revealed, err := swap.Secret(ctx, backend.Client(), ethswap.HeightBlockNumber, 500)
+		Expect(err).To(BeNil())
+		Expect(revealed).Should(Equal(secret))
+
+		By("Alice can't refund before the expiry")
+		swap, _ = newSwap(100)
+		waitMined(alice.Initiate(ctx, swap))
+		_, err = alice.Refund(ctx, swap)
+		var revertErr *ethswap.RevertError
+		Expect(errors.As(err, &revertErr)).Should(BeTrue())
+
+		By("Alice refunds once it expires")
+		Eventually(func() bool {
+			expired, err := swap.Expired(ctx, backend.Client(), ethswap.HeightBlockNumber)
+			Expect(err).To(BeNil())
+			return expired
+		}).WithTimeout(20 * time.Second).Should(BeTrue())
+		waitMined(alice.Refund(ctx, swap))
+		Expect(locked().Sign()).Should(Equal(0))
+		fulfilled, err := swap.Redeemed(ctx, backend.Client())
+		Expect(err).To(BeNil())
+		Expect(fulfilled).Should(BeTrue())
+	})
+})
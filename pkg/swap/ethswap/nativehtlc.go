@@ -0,0 +1,22 @@
+package ethswap
+
+import (
+	"github.com/catalogfi/blockchain/evm/bindings/contracts/htlc/gardenhtlc"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+)
+
+// NativeHTLCMetaData is the ABI of the HTLC contract swapping the native asset. Its `initiate` is payable and takes the
+// amount as the value of the tx, and there's no token. The other calls, the `orders` getter and the events are the same
+// as the ERC-20 GardenHTLC, so the state of both kinds of swaps is read with the GardenHTLC bindings.
+var NativeHTLCMetaData = &bind.MetaData{
+	ABI: `[{"anonymous":false,"inputs":[{"indexed":true,"internalType":"bytes32","name":"orderID","type":"bytes32"},{"indexed":true,"internalType":"bytes32","name":"secretHash","type":"bytes32"},{"indexed":false,"internalType":"uint256","name":"amount","type":"uint256"}],"name":"Initiated","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"bytes32","name":"orderID","type":"bytes32"},{"indexed":true,"internalType":"bytes32","name":"secretHash","type":"bytes32"},{"indexed":false,"internalType":"bytes","name":"secret","type":"bytes"}],"name":"Redeemed","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"bytes32","name":"orderID","type":"bytes32"}],"name":"Refunded","type":"event"},{"inputs":[{"internalType":"address","name":"redeemer","type":"address"},{"internalType":"uint256","name":"timelock","type":"uint256"},{"internalType":"uint256","name":"amount","type":"uint256"},{"internalType":"bytes32","name":"secretHash","type":"bytes32"}],"name":"initiate","outputs":[],"stateMutability":"payable","type":"function"},{"inputs":[{"internalType":"bytes32","name":"","type":"bytes32"}],"name":"orders","outputs":[{"internalType":"bool","name":"isFulfilled","type":"bool"},{"internalType":"address","name":"initiator","type":"address"},{"internalType":"address","name":"redeemer","type":"address"},{"internalType":"uint256","name":"initiatedAt","type":"uint256"},{"internalType":"uint256","name":"timelock","type":"uint256"},{"internalType":"uint256","name":"amount","type":"uint256"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"bytes32","name":"orderID","type":"bytes32"},{"internalType":"bytes","name":"secret","type":"bytes"}],"name":"redeem","outputs":[],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"internalType":"bytes32","name":"orderID","type":"bytes32"}],"name":"refund","outputs":[],"stateMutability":"nonpayable","type":"function"}]`,
+}
+
+// htlcABI returns the ABI of the HTLC contract we send txs to.
+func htlcABI(native bool) (*abi.ABI, error) {
+	if native {
+		return NativeHTLCMetaData.GetAbi()
+	}
+	return gardenhtlc.GardenHTLCMetaData.GetAbi()
+}
@@ -0,0 +1,241 @@
+package ethswap
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SentHistory is how many mined nonces the NonceManager remembers the sent txs of, so the receipts of replaced txs can
+// still be found after the nonce is mined.
+const SentHistory = 1024
+
+// NonceState is the nonces we have assigned on a chain.
+type NonceState struct {
+	Next     uint64            `json:"next"`     // next nonce to assign
+	Assigned map[uint64]string `json:"assigned"` // hash of the tx which uses the nonce, empty for txs sent by others
+}
+
+// NonceStore persists the nonces assigned by the NonceManager, so they survive restarts.
+type NonceStore interface {
+
+	// LoadNonces returns the nonce state of the address on the chain.
+	LoadNonces(chainID *big.Int, addr common.Address) (NonceState, error)
+
+	// StoreNonces stores the nonce state of the address on the chain.
+	StoreNonces(chainID *big.Int, addr common.Address, state NonceState) error
+}
+
+type memNonceStore struct {
+	mu     *sync.Mutex
+	states map[string]NonceState
+}
+
+// NewMemNonceStore returns a NonceStore which keeps the nonces in memory.
+func NewMemNonceStore() NonceStore {
+	return memNonceStore{
+		mu:     new(sync.Mutex),
+		states: map[string]NonceState{},
+	}
+}
+
+func (store memNonceStore) LoadNonces(chainID *big.Int, addr common.Address) (NonceState, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	state, ok := store.states[fmt.Sprintf("%v-%v", chainID, addr.Hex())]
+	if !ok {
+		return NonceState{Assigned: map[uint64]string{}}, nil
+	}
+	return state.copy(), nil
+}
+
+func (store memNonceStore) StoreNonces(chainID *big.Int, addr common.Address, state NonceState) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.states[fmt.Sprintf("%v-%v", chainID, addr.Hex())] = state.copy()
+	return nil
+}
+
+func (state NonceState) copy() NonceState {
+	assigned := make(map[uint64]string, len(state.Assigned))
+	for nonce, hash := range state.Assigned {
+		assigned[nonce] = hash
+	}
+	return NonceState{
+		Next:     state.Next,
+		Assigned: assigned,
+	}
+}
+
+// NonceManager assigns nonces to the txs of an address on a chain. Nonces are reserved before sending a tx, so multiple
+// txs can be in flight at the same time. A nonce which is reserved but never used by a tx leaves a gap, which blocks
+// all the following txs until it's filled.
+type NonceManager struct {
+	mu      *sync.Mutex
+	chainID *big.Int
+	addr    common.Address
+	client  Backend
+	store   NonceStore
+	state   NonceState
+
+	reserved map[uint64]struct{}      // nonces reserved by the txs being sent
+	sent     map[uint64][]common.Hash // hashes of all the txs sent with the nonce, including replacements
+}
+
+func NewNonceManager(ctx context.Context, chainID *big.Int, addr common.Address, client Backend, store NonceStore) (*NonceManager, error) {
+	if store == nil {
+		store = NewMemNonceStore()
+	}
+	state, err := store.LoadNonces(chainID, addr)
+	if err != nil {
+		return nil, err
+	}
+	if state.Assigned == nil {
+		state.Assigned = map[uint64]string{}
+	}
+
+	nm := &NonceManager{
+		mu:      new(sync.Mutex),
+		chainID: chainID,
+		addr:    addr,
+		client:  client,
+		store:   store,
+		state:   state,
+
+		reserved: map[uint64]struct{}{},
+		sent:     map[uint64][]common.Hash{},
+	}
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	if _, err := nm.sync(ctx); err != nil {
+		return nil, err
+	}
+	return nm, nil
+}
+
+// sync catches up with the chain. Nonces used by txs outside the manager are skipped and the mined ones are forgotten.
+// It returns the nonce of the next tx to be mined.
+func (nm *NonceManager) sync(ctx context.Context) (uint64, error) {
+	pending, err := nm.client.PendingNonceAt(ctx, nm.addr)
+	if err != nil {
+		return 0, err
+	}
+	mined, err := nm.client.NonceAt(ctx, nm.addr, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	// Nonces taken by txs outside the manager are marked with an empty hash, so they are not treated as gaps.
+	for ; nm.state.Next < pending; nm.state.Next++ {
+		if _, ok := nm.state.Assigned[nm.state.Next]; !ok {
+			nm.state.Assigned[nm.state.Next] = ""
+		}
+	}
+	for nonce := range nm.state.Assigned {
+		if nonce < mined {
+			delete(nm.state.Assigned, nonce)
+		}
+	}
+	for nonce := range nm.sent {
+		if nonce+SentHistory < mined {
+			delete(nm.sent, nonce)
+		}
+	}
+	return mined, nm.store.StoreNonces(nm.chainID, nm.addr, nm.state)
+}
+
+// Reserve returns the next nonce to use.
+func (nm *NonceManager) Reserve() (uint64, error) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	nonce := nm.state.Next
+	nm.state.Next++
+	if err := nm.store.StoreNonces(nm.chainID, nm.addr, nm.state); err != nil {
+		nm.state.Next--
+		return 0, err
+	}
+	nm.reserved[nonce] = struct{}{}
+	return nonce, nil
+}
+
+// Assign records the tx which uses the nonce. A tx replacing an earlier one with the same nonce is assigned again.
+func (nm *NonceManager) Assign(nonce uint64, hash common.Hash) error {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	delete(nm.reserved, nonce)
+	nm.state.Assigned[nonce] = hash.Hex()
+	nm.sent[nonce] = append(nm.sent[nonce], hash)
+	return nm.store.StoreNonces(nm.chainID, nm.addr, nm.state)
+}
+
+// Sent returns the hashes of all the txs we have sent with the nonce in the order they were sent, the last one is the
+// latest replacement. Only the txs sent since the manager was created are known.
+func (nm *NonceManager) Sent(nonce uint64) []common.Hash {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	return append([]common.Hash{}, nm.sent[nonce]...)
+}
+
+// Release gives back a reserved nonce which is not used by any tx. The nonce will be reused if it's the latest one,
+// otherwise it becomes a gap.
+func (nm *NonceManager) Release(nonce uint64) error {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	delete(nm.reserved, nonce)
+	if nonce+1 != nm.state.Next {
+		return nil
+	}
+	nm.state.Next = nonce
+	return nm.store.StoreNonces(nm.chainID, nm.addr, nm.state)
+}
+
+// Resync catches up with the chain, it should be called when a tx is rejected because of the nonce.
+func (nm *NonceManager) Resync(ctx context.Context) error {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	_, err := nm.sync(ctx)
+	return err
+}
+
+// Gaps returns the nonces which are not mined and not used by any tx we know, in ascending order.
+func (nm *NonceManager) Gaps(ctx context.Context) ([]uint64, error) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	mined, err := nm.sync(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the nonces below the highest assigned one block other txs
+	highest, ok := uint64(0), false
+	for nonce := range nm.state.Assigned {
+		if !ok || nonce > highest {
+			highest, ok = nonce, true
+		}
+	}
+	if !ok {
+		return nil, nil
+	}
+	gaps := []uint64{}
+	for nonce := mined; nonce < highest; nonce++ {
+		if _, ok := nm.state.Assigned[nonce]; ok {
+			continue
+		}
+		if _, ok := nm.reserved[nonce]; ok {
+			continue
+		}
+		gaps = append(gaps, nonce)
+	}
+	return gaps, nil
+}
@@ -0,0 +1,114 @@
+package ethswap_test
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
+	"github.com/ethereum/go-ethereum/common"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// nonceBackend reports the nonces we set.
+type nonceBackend struct {
+	ethswap.Backend
+	pending uint64
+	mined   uint64
+}
+
+func (backend *nonceBackend) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return backend.pending, nil
+}
+
+func (backend *nonceBackend) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	return backend.mined, nil
+}
+
+var _ = Describe("Nonce manager", func() {
+	chainID := big.NewInt(1337)
+	addr := common.HexToAddress("0xA")
+
+	var backend *nonceBackend
+	var store ethswap.NonceStore
+	var nm *ethswap.NonceManager
+	BeforeEach(func(ctx context.Context) {
+		backend = &nonceBackend{pending: 3, mined: 3}
+		store = ethswap.NewMemNonceStore()
+		var err error
+		nm, err = ethswap.NewNonceManager(ctx, chainID, addr, backend, store)
+		Expect(err).Should(BeNil())
+	})
+
+	reserve := func() uint64 {
+		nonce, err := nm.Reserve()
+		Expect(err).Should(BeNil())
+		return nonce
+	}
+
+	It("should start from the pending nonce and persist the reserved nonces", func() {
+		Expect(reserve()).Should(Equal(uint64(3)))
+		Expect(reserve()).Should(Equal(uint64(4)))
+
+		state, err := store.LoadNonces(chainID, addr)
+		Expect(err).Should(BeNil())
+		Expect(state.Next).Should(Equal(uint64(5)))
+	})
+
+	It("should reuse a released nonce only if it's the latest one", func(ctx context.Context) {
+		first, second := reserve(), reserve()
+		Expect(nm.Release(first)).Should(Succeed())
+		Expect(reserve()).Should(Equal(uint64(5)))
+
+		Expect(nm.Assign(5, common.Hash{5})).Should(Succeed())
+		Expect(nm.Release(second)).Should(Succeed())
+
+		// The released nonce is left as a gap which blocks the tx using nonce 5
+		gaps, err := nm.Gaps(ctx)
+		Expect(err).Should(BeNil())
+		Expect(gaps).Should(Equal([]uint64{first, second}))
+	})
+
+	It("should not treat the nonces being sent or used by others as gaps", func(ctx context.Context) {
+		// A tx sent outside the manager
+		backend.pending = 4
+		Expect(nm.Resync(ctx)).Should(Succeed())
+
+		sending := reserve()
+		Expect(sending).Should(Equal(uint64(4)))
+		Expect(nm.Assign(reserve(), common.Hash{5})).Should(Succeed())
+		gaps, err := nm.Gaps(ctx)
+		Expect(err).Should(BeNil())
+		Expect(gaps).Should(BeEmpty())
+	})
+
+	It("should forget the mined nonces", func(ctx context.Context) {
+		Expect(nm.Release(reserve())).Should(Succeed())
+		nonce := reserve()
+		Expect(nm.Assign(nonce, common.Hash{1})).Should(Succeed())
+		Expect(nm.Assign(reserve(), common.Hash{2})).Should(Succeed())
+
+		backend.mined, backend.pending = 5, 5
+		gaps, err := nm.Gaps(ctx)
+		Expect(err).Should(BeNil())
+		Expect(gaps).Should(BeEmpty())
+		state, err := store.LoadNonces(chainID, addr)
+		Expect(err).Should(BeNil())
+		Expect(state.Assigned).Should(BeEmpty())
+
+		// The txs sent with a mined nonce are still known
+		Expect(nm.Sent(nonce)).Should(Equal([]common.Hash{{1}}))
+	})
+
+	It("should remember the replacements of a tx", func() {
+		nonce := reserve()
+		Expect(nm.Assign(nonce, common.Hash{1})).Should(Succeed())
+		Expect(nm.Assign(nonce, common.Hash{2})).Should(Succeed())
+		Expect(nm.Sent(nonce)).Should(Equal([]common.Hash{{1}, {2}}))
+
+		state, err := store.LoadNonces(chainID, addr)
+		Expect(err).Should(BeNil())
+		Expect(state.Assigned[nonce]).Should(Equal(common.Hash{2}.Hex()))
+	})
+})
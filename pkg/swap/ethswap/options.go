@@ -1,7 +1,6 @@
 package ethswap
 
 import (
-	"fmt"
 	"math/big"
 	"time"
 
@@ -9,37 +8,42 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 )
 
+// DefaultGasReserve is the amount of native asset kept for gas when the HTLC contract swaps the native asset.
+var DefaultGasReserve = big.NewInt(1e16)
+
 type Options struct {
-	ChainID  *big.Int
-	SwapAddr common.Address
-	Timeout  time.Duration
-}
+	ChainID      *big.Int
+	SwapAddr     common.Address
+	Timeout      time.Duration
+	Fees         FeePolicy
+	Approval     ApprovalPolicy
+	Nonces       NonceStore     // persists the assigned nonces, nil keeps them in memory
+	NonceManager *NonceManager  // shared by the wallets of the same address on the chain, nil creates one from Nonces
+	Multicall    common.Address // address of the Multicall3 contract used for batching, zero address disables batching
 
-func NewOptions(chain model.Chain, swapAddr common.Address) Options {
-	if !chain.IsEVM() {
-		panic("not a evm chain")
-	}
+	Rollup     Rollup   // kind of rollup the chain is, used to estimate the L1 data fee
+	Native     bool     // whether the HTLC contract swaps the native asset instead of an ERC-20 token
+	GasReserve *big.Int // native balance which is not available for swaps, only used by native HTLCs
+}
 
-	var chainID *big.Int
-	switch chain {
-	case model.Ethereum:
-		chainID = big.NewInt(1)
-	case model.EthereumSepolia:
-		chainID = big.NewInt(11155111)
-	case model.EthereumLocalnet:
-		chainID = big.NewInt(31337)
-	case model.EthereumArbitrumLocalnet:
-		chainID = big.NewInt(31338)
-	case model.EthereumArbitrum:
-		chainID = big.NewInt(42161)
-	default:
-		panic(fmt.Sprintf("unknown evm chain = %v", chain))
-	}
+// ChainIDs are the chain IDs of the well-known evm chains, other chains need to have the chain ID configured.
+var ChainIDs = map[model.Chain]*big.Int{
+	model.Ethereum:                 big.NewInt(1),
+	model.EthereumSepolia:          big.NewInt(11155111),
+	model.EthereumLocalnet:         big.NewInt(31337),
+	model.EthereumArbitrumLocalnet: big.NewInt(31338),
+	model.EthereumArbitrum:         big.NewInt(42161),
+}
 
+// NewOptions returns the default options for the HTLC contract on the chain with the given chain ID. The chain ID is
+// checked against the one returned by the client when creating the wallet.
+func NewOptions(chainID *big.Int, swapAddr common.Address) Options {
 	return Options{
 		ChainID:  chainID,
 		SwapAddr: swapAddr,
 		Timeout:  5 * time.Second,
+		Fees:     DefaultFeePolicy,
+		Approval: DefaultApprovalPolicy,
 	}
 }
 
@@ -57,3 +61,46 @@ func (opts Options) WithTimeout(timeout time.Duration) Options {
 	opts.Timeout = timeout
 	return opts
 }
+
+// WithNative marks the HTLC contract as a native asset HTLC, the reserve is kept aside for gas. A nil reserve uses
+// DefaultGasReserve.
+func (opts Options) WithNative(reserve *big.Int) Options {
+	if reserve == nil {
+		reserve = DefaultGasReserve
+	}
+	opts.Native = true
+	opts.GasReserve = reserve
+	return opts
+}
+
+func (opts Options) WithRollup(rollup Rollup) Options {
+	opts.Rollup = rollup
+	return opts
+}
+
+func (opts Options) WithMulticall(multicall common.Address) Options {
+	opts.Multicall = multicall
+	return opts
+}
+
+func (opts Options) WithNonceStore(store NonceStore) Options {
+	opts.Nonces = store
+	return opts
+}
+
+// WithNonceManager shares the nonce manager with other wallets of the same address, which is required when we have
+// wallets for multiple HTLC contracts on the same chain.
+func (opts Options) WithNonceManager(nm *NonceManager) Options {
+	opts.NonceManager = nm
+	return opts
+}
+
+func (opts Options) WithApprovalPolicy(policy ApprovalPolicy) Options {
+	opts.Approval = policy
+	return opts
+}
+
+func (opts Options) WithFeePolicy(policy FeePolicy) Options {
+	opts.Fees = policy
+	return opts
+}
@@ -0,0 +1,118 @@
+package ethswap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Revert reasons of the HTLC contract
+var (
+	RevertNotInitiated    = "HTLC: order not initiated"
+	RevertFulfilled       = "HTLC: order fulfilled"
+	RevertNotExpired      = "HTLC: order not expired"
+	RevertDuplicateOrder  = "HTLC: duplicate order"
+	RevertIncorrectSecret = "HTLC: incorrect secret"
+)
+
+// RevertPendingApproval is not given by the contracts, it's the reason of the RevertError returned when an initiation
+// relying on an approval which isn't mined yet would revert. Rpcs don't always have our approval in their pending state,
+// so the initiation should be retried once the approval is mined.
+var RevertPendingApproval = "approval pending"
+
+// RevertError is returned instead of sending a tx whose simulation reverts.
+type RevertError struct {
+	Reason string // decoded revert reason, empty if the contract didn't give one
+}
+
+func (re *RevertError) Error() string {
+	return fmt.Sprintf("simulation reverted, reason = %q", re.Reason)
+}
+
+// DecodeRevert extracts the revert reason from the error returned by an `eth_call`. It returns an empty string if the
+// error is not caused by a revert.
+func DecodeRevert(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	// Prefer the revert data returned by the node
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		if data, ok := dataErr.ErrorData().(string); ok {
+			if raw, decodeErr := hexutil.Decode(data); decodeErr == nil {
+				if reason, unpackErr := abi.UnpackRevert(raw); unpackErr == nil {
+					return reason
+				}
+			}
+		}
+	}
+
+	msg := err.Error()
+	if index := strings.Index(msg, "execution reverted"); index >= 0 {
+		reason := strings.TrimPrefix(msg[index:], "execution reverted")
+		return strings.TrimSpace(strings.TrimPrefix(reason, ":"))
+	}
+	return ""
+}
+
+// asRevert converts the error of a call which reverted to a RevertError, other errors are returned as they are.
+func asRevert(err error) error {
+	if reason := DecodeRevert(err); reason != "" || strings.Contains(err.Error(), "execution reverted") {
+		return &RevertError{Reason: reason}
+	}
+	return err
+}
+
+// Simulate calls the signed tx at the pending block without sending it. It returns a RevertError with the decoded
+// reason if the tx would revert.
+func Simulate(ctx context.Context, client Backend, from common.Address, tx *types.Transaction) error {
+	_, err := client.CallContract(ctx, callMsg(from, tx), big.NewInt(int64(rpc.PendingBlockNumber)))
+	if err != nil {
+		return asRevert(err)
+	}
+	return nil
+}
+
+// RevertReason replays a reverted tx on top of the state of its previous block and returns the revert reason.
+func RevertReason(ctx context.Context, client Backend, from common.Address, tx *types.Transaction, block *big.Int) (string, error) {
+	var previous *big.Int
+	if block != nil && block.Sign() > 0 {
+		previous = new(big.Int).Sub(block, big.NewInt(1))
+	}
+	_, err := client.CallContract(ctx, callMsg(from, tx), previous)
+	if err == nil {
+		return "", nil
+	}
+	if reason := DecodeRevert(err); reason != "" {
+		return reason, nil
+	}
+	return "", err
+}
+
+// callMsg converts the tx to a call from the sender.
+func callMsg(from common.Address, tx *types.Transaction) ethereum.CallMsg {
+	msg := ethereum.CallMsg{
+		From:     from,
+		To:       tx.To(),
+		Gas:      tx.Gas(),
+		Value:    tx.Value(),
+		Data:     tx.Data(),
+		GasPrice: tx.GasPrice(),
+	}
+	if tx.Type() == types.DynamicFeeTxType {
+		msg.GasPrice = nil
+		msg.GasFeeCap = tx.GasFeeCap()
+		msg.GasTipCap = tx.GasTipCap()
+	}
+	return msg
+}
@@ -0,0 +1,166 @@
+package ethswap_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/fatih/color"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Ethereum Atomic Swap on a simulated chain", func() {
+	var (
+		aliceWallet ethswap.Wallet
+		bobWallet   ethswap.Wallet
+	)
+
+	newSwap := func(expiry int64) (ethswap.Swap, []byte) {
+		secret := make([]byte, 32)
+		_, err := rand.Read(secret)
+		Expect(err).To(BeNil())
+		secretHash := sha256.Sum256(secret)
+		amount := big.NewInt(1e8)
+		return ethswap.NewSwap(aliceWallet.Address(), bobWallet.Address(), swapAddr, secretHash, amount, big.NewInt(expiry)), secret
+	}
+
+	waitMined := func(ctx context.Context, tx *types.Transaction) {
+		receipt, err := bind.WaitMined(ctx, backend.Client(), tx)
+		Expect(err).To(BeNil())
+		Expect(receipt.Status).Should(Equal(types.ReceiptStatusSuccessful))
+	}
+
+	BeforeEach(func(ctx context.Context) {
+		By("Initialise the wallets")
+		chainID, err := backend.Client().ChainID(ctx)
+		Expect(err).To(BeNil())
+		// Blocks of the simulated chain are mostly empty, so we need a minimum priority fee
+		fees := ethswap.DefaultFeePolicy
+		fees.PriorityFee = big.NewInt(params.GWei)
+		options := ethswap.NewOptions(chainID, swapAddr).WithTimeout(time.Minute).WithFeePolicy(fees)
+		aliceWallet, err = ethswap.NewWallet(options, aliceKey, backend.Client())
+		Expect(err).To(BeNil())
+		bobWallet, err = ethswap.NewWallet(options, bobKey, backend.Client())
+		Expect(err).To(BeNil())
+	})
+
+	Context("Alice and Bob wants to do a swap", func() {
+		It("should work", func(ctx context.Context) {
+			By("Get balance of both user")
+			aliceBalance, err := aliceWallet.TokenBalance(ctx, false)
+			Expect(err).To(BeNil())
+			bobBalance, err := bobWallet.TokenBalance(ctx, false)
+			Expect(err).To(BeNil())
+
+			By("Alice initiates the swap")
+			swap, secret := newSwap(1000)
+			initTx := initiate(ctx, aliceWallet, swap)
+			waitMined(ctx, initTx)
+			By(color.GreenString("Initiation tx hash = %v", initTx.Hash().Hex()))
+			initiated, err := swap.Initiated(ctx, backend.Client())
+			Expect(err).To(BeNil())
+			Expect(initiated).Should(BeTrue())
+
+			By("Bob redeems the swap")
+			redeemTx, err := bobWallet.Redeem(ctx, swap, secret)
+			Expect(err).To(BeNil())
+			waitMined(ctx, redeemTx)
+			By(color.GreenString("Redeem tx hash = %v", redeemTx.Hash().Hex()))
+			redeemed, err := swap.Redeemed(ctx, backend.Client())
+			Expect(err).To(BeNil())
+			Expect(redeemed).Should(BeTrue())
+
+			By("Alice learns the secret")
+			revealed, err := swap.Secret(ctx, backend.Client(), ethswap.HeightBlockNumber, 0)
+			Expect(err).To(BeNil())
+			Expect(revealed).Should(Equal(secret))
+
+			By("Check balance again")
+			newAliceBalance, err := aliceWallet.TokenBalance(ctx, false)
+			Expect(err).To(BeNil())
+			newBobBalance, err := bobWallet.TokenBalance(ctx, false)
+			Expect(err).To(BeNil())
+			Expect(newAliceBalance.Cmp(big.NewInt(0).Sub(aliceBalance, swap.Amount))).Should(Equal(0))
+			Expect(newBobBalance.Cmp(big.NewInt(0).Add(bobBalance, swap.Amount))).Should(Equal(0))
+		})
+	})
+
+	Context("Bob redeems with a wrong secret", func() {
+		It("should not send the tx", func(ctx context.Context) {
+			By("Alice initiates the swap")
+			swap, _ := newSwap(1000)
+			initTx := initiate(ctx, aliceWallet, swap)
+			waitMined(ctx, initTx)
+
+			By("Bob redeems with a random secret")
+			nonce, err := backend.Client().PendingNonceAt(ctx, bobWallet.Address())
+			Expect(err).To(BeNil())
+			wrong, _ := newSwap(1000)
+			_, err = bobWallet.Redeem(ctx, swap, wrong.SecretHash[:])
+			var revertErr *ethswap.RevertError
+			Expect(errors.As(err, &revertErr)).Should(BeTrue())
+			Expect(revertErr.Reason).Should(Equal(ethswap.RevertIncorrectSecret))
+			after, err := backend.Client().PendingNonceAt(ctx, bobWallet.Address())
+			Expect(err).To(BeNil())
+			Expect(after).Should(Equal(nonce))
+		})
+	})
+
+	Context("Alice wants to refund after expiry", func() {
+		It("should work", func(ctx context.Context) {
+			By("Get token balance")
+			aliceBalance, err := aliceWallet.TokenBalance(ctx, false)
+			Expect(err).To(BeNil())
+
+			By("Alice initiates the swap")
+			swap, _ := newSwap(3)
+			initTx := initiate(ctx, aliceWallet, swap)
+			waitMined(ctx, initTx)
+			By(color.GreenString("Initiation tx hash = %v", initTx.Hash().Hex()))
+
+			By("Wait for the swap to expire")
+			Eventually(func() bool {
+				expired, err := swap.Expired(ctx, backend.Client(), ethswap.HeightBlockNumber)
+				return err == nil && expired
+			}).WithTimeout(10 * time.Second).Should(BeTrue())
+
+			By("Alice refunds the swap")
+			refundTx, err := aliceWallet.Refund(ctx, swap)
+			Expect(err).To(BeNil())
+			waitMined(ctx, refundTx)
+			By(color.GreenString("Refund tx hash = %v", refundTx.Hash().Hex()))
+
+			By("Check balance again")
+			newAliceBalance, err := aliceWallet.TokenBalance(ctx, false)
+			Expect(err).To(BeNil())
+			Expect(newAliceBalance.Cmp(aliceBalance)).Should(Equal(0))
+		})
+	})
+
+	Context("Timelocks measured in timestamps", func() {
+		It("should find the block of a height", func(ctx context.Context) {
+			latest, err := backend.Client().BlockNumber(ctx)
+			Expect(err).To(BeNil())
+			header, err := backend.Client().HeaderByNumber(ctx, new(big.Int).SetUint64(latest))
+			Expect(err).To(BeNil())
+
+			height, err := ethswap.CurrentHeight(ctx, backend.Client(), ethswap.HeightTimestamp, header.Number)
+			Expect(err).To(BeNil())
+			Expect(height).Should(Equal(header.Time))
+			block, err := ethswap.BlockAtHeight(ctx, backend.Client(), ethswap.HeightTimestamp, header.Time)
+			Expect(err).To(BeNil())
+			Expect(block).Should(BeNumerically("<=", latest))
+			found, err := backend.Client().HeaderByNumber(ctx, new(big.Int).SetUint64(block))
+			Expect(err).To(BeNil())
+			Expect(found.Time).Should(Equal(header.Time))
+		})
+	})
+})
@@ -0,0 +1,289 @@
+package ethswap_test
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/catalogfi/blockchain/evm/bindings/openzeppelin/contracts/token/ERC20/erc20"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/asm"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// tokenSupply is minted to the deployer of the test token.
+var tokenSupply, _ = new(big.Int).SetString("1000000000000000000000000000", 10)
+
+// tokenRuntime is a minimal ERC-20 token which is enough for the HTLC contract. Balances are stored at the slot of the
+// holder address and allowances at keccak256(owner, spender). It doesn't emit events, and reverts without a reason.
+//
+// The bindings we depend on don't ship the bytecode of an ERC-20 token and there's no compiler in the build, so the
+// token is assembled here. The spec below checks it behaves like an ERC-20 through the erc20 bindings.
+const tokenRuntime = `
+	PUSH 0
+	CALLDATALOAD
+	PUSH 0xe0
+	SHR
+	DUP1
+	PUSH 0x70a08231
+	EQ
+	JUMPI @balanceOf
+	DUP1
+	PUSH 0x18160ddd
+	EQ
+	JUMPI @totalSupply
+	DUP1
+	PUSH 0x313ce567
+	EQ
+	JUMPI @decimals
+	DUP1
+	PUSH 0xdd62ed3e
+	EQ
+	JUMPI @allowance
+	DUP1
+	PUSH 0x095ea7b3
+	EQ
+	JUMPI @approve
+	DUP1
+	PUSH 0xa9059cbb
+	EQ
+	JUMPI @transfer
+	DUP1
+	PUSH 0x23b872dd
+	EQ
+	JUMPI @transferFrom
+fail:
+	PUSH 0
+	DUP1
+	REVERT
+ret:
+	PUSH 0
+	MSTORE
+	PUSH 32
+	PUSH 0
+	RETURN
+balanceOf:
+	PUSH 4
+	CALLDATALOAD
+	SLOAD
+	JUMP @ret
+totalSupply:
+	PUSH %v
+	JUMP @ret
+decimals:
+	PUSH 18
+	JUMP @ret
+allowance:
+	PUSH 4
+	CALLDATALOAD
+	PUSH 0
+	MSTORE
+	PUSH 36
+	CALLDATALOAD
+	PUSH 32
+	MSTORE
+	PUSH 64
+	PUSH 0
+	KECCAK256
+	SLOAD
+	JUMP @ret
+approve:
+	CALLER
+	PUSH 0
+	MSTORE
+	PUSH 4
+	CALLDATALOAD
+	PUSH 32
+	MSTORE
+	PUSH 36
+	CALLDATALOAD
+	PUSH 64
+	PUSH 0
+	KECCAK256
+	SSTORE
+	PUSH 1
+	JUMP @ret
+transfer:
+	PUSH 36
+	CALLDATALOAD
+	PUSH 4
+	CALLDATALOAD
+	CALLER
+	JUMP @move
+transferFrom:
+	PUSH 4
+	CALLDATALOAD
+	PUSH 0
+	MSTORE
+	CALLER
+	PUSH 32
+	MSTORE
+	PUSH 64
+	PUSH 0
+	KECCAK256
+	DUP1
+	SLOAD
+	PUSH 68
+	CALLDATALOAD
+	DUP1
+	DUP3
+	LT
+	JUMPI @fail
+	SWAP1
+	SUB
+	SWAP1
+	SSTORE
+	PUSH 68
+	CALLDATALOAD
+	PUSH 36
+	CALLDATALOAD
+	PUSH 4
+	CALLDATALOAD
+	JUMP @move
+move:
+	DUP1
+	SLOAD
+	DUP4
+	DUP2
+	LT
+	JUMPI @fail
+	DUP4
+	SWAP1
+	SUB
+	SWAP1
+	SSTORE
+	DUP1
+	SLOAD
+	DUP3
+	ADD
+	SWAP1
+	SSTORE
+	PUSH 1
+	JUMP @ret
+`
+
+// tokenBytecode returns the creation code of the test token, which mints the supply to the deployer and returns the
+// runtime code.
+func tokenBytecode() ([]byte, error) {
+	compiler := asm.NewCompiler(false)
+	compiler.Feed(asm.Lex([]byte(fmt.Sprintf(tokenRuntime, tokenSupply)), false))
+	output, errs := compiler.Compile()
+	if len(errs) != 0 {
+		return nil, fmt.Errorf("compile token, %v", errs)
+	}
+	runtime, err := hex.DecodeString(output)
+	if err != nil {
+		return nil, err
+	}
+
+	// PUSH32 supply, CALLER, SSTORE, then copy the runtime code which follows the 47 bytes of creation code and return it
+	supply := common.LeftPadBytes(tokenSupply.Bytes(), 32)
+	code := append([]byte{0x7f}, supply...)
+	code = append(code, 0x33, 0x55, 0x61, byte(len(runtime)>>8), byte(len(runtime)), 0x80, 0x60, 47, 0x60, 0x00, 0x39, 0x60, 0x00, 0xf3)
+	return append(code, runtime...), nil
+}
+
+// deployToken sends the creation tx of the test token, the supply is minted to the sender.
+func deployToken(transactor *bind.TransactOpts) (common.Address, *types.Transaction, error) {
+	code, err := tokenBytecode()
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	tokenABI, err := erc20.ERC20MetaData.GetAbi()
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	tokenABI.Constructor.Inputs = nil // the test token takes no constructor arguments
+	addr, tx, _, err := bind.DeployContract(transactor, *tokenABI, code, backend.Client())
+	return addr, tx, err
+}
+
+var _ = Describe("Test token", func() {
+	var token *erc20.ERC20
+	var alice, bob *bind.TransactOpts
+	BeforeEach(func(ctx context.Context) {
+		chainID, err := backend.Client().ChainID(ctx)
+		Expect(err).Should(BeNil())
+		alice, err = bind.NewKeyedTransactorWithChainID(aliceKey, chainID)
+		Expect(err).Should(BeNil())
+		bob, err = bind.NewKeyedTransactorWithChainID(bobKey, chainID)
+		Expect(err).Should(BeNil())
+
+		// A fresh token, so the balances don't depend on the other specs
+		transactor := *alice
+		transactor.Context = ctx
+		tokenAddr := deploy(ctx, func() (common.Address, *types.Transaction, error) {
+			return deployToken(&transactor)
+		})
+		token, err = erc20.NewERC20(tokenAddr, backend.Client())
+		Expect(err).Should(BeNil())
+	})
+
+	send := func(ctx context.Context, from *bind.TransactOpts, f func(opts *bind.TransactOpts) (*types.Transaction, error)) error {
+		opts := *from
+		opts.Context = ctx
+		tx, err := f(&opts)
+		if err != nil {
+			return err
+		}
+		receipt, err := bind.WaitMined(ctx, backend.Client(), tx)
+		Expect(err).Should(BeNil())
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			return fmt.Errorf("tx reverted")
+		}
+		return nil
+	}
+	balance := func(ctx context.Context, owner common.Address) *big.Int {
+		balance, err := token.BalanceOf(&bind.CallOpts{Context: ctx}, owner)
+		Expect(err).Should(BeNil())
+		return balance
+	}
+
+	It("should behave like an erc20 token", func(ctx context.Context) {
+		callOpts := &bind.CallOpts{Context: ctx}
+		aliceAddr, bobAddr := crypto.PubkeyToAddress(aliceKey.PublicKey), crypto.PubkeyToAddress(bobKey.PublicKey)
+
+		By("The supply is minted to the deployer")
+		supply, err := token.TotalSupply(callOpts)
+		Expect(err).Should(BeNil())
+		Expect(supply).Should(Equal(tokenSupply))
+		Expect(balance(ctx, aliceAddr)).Should(Equal(tokenSupply))
+		decimals, err := token.Decimals(callOpts)
+		Expect(err).Should(BeNil())
+		Expect(decimals).Should(Equal(uint8(18)))
+
+		By("Transfers move the balance")
+		Expect(send(ctx, alice, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return token.Transfer(opts, bobAddr, big.NewInt(100))
+		})).Should(Succeed())
+		Expect(balance(ctx, bobAddr)).Should(Equal(big.NewInt(100)))
+		Expect(send(ctx, bob, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return token.Transfer(opts, aliceAddr, big.NewInt(101))
+		})).ShouldNot(Succeed())
+
+		By("Transfers from others are limited by the allowance")
+		Expect(send(ctx, alice, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return token.Approve(opts, bobAddr, big.NewInt(60))
+		})).Should(Succeed())
+		allowance, err := token.Allowance(callOpts, aliceAddr, bobAddr)
+		Expect(err).Should(BeNil())
+		Expect(allowance).Should(Equal(big.NewInt(60)))
+		Expect(send(ctx, bob, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return token.TransferFrom(opts, aliceAddr, bobAddr, big.NewInt(40))
+		})).Should(Succeed())
+		Expect(balance(ctx, bobAddr)).Should(Equal(big.NewInt(140)))
+		allowance, err = token.Allowance(callOpts, aliceAddr, bobAddr)
+		Expect(err).Should(BeNil())
+		Expect(allowance).Should(Equal(big.NewInt(20)))
+		Expect(send(ctx, bob, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return token.TransferFrom(opts, aliceAddr, bobAddr, big.NewInt(21))
+		})).ShouldNot(Succeed())
+		Expect(new(big.Int).Add(balance(ctx, aliceAddr), balance(ctx, bobAddr))).Should(Equal(tokenSupply))
+	})
+})
@@ -7,14 +7,16 @@ import (
 	"math/big"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/catalogfi/blockchain/evm/bindings/contracts/htlc/gardenhtlc"
 	"github.com/catalogfi/blockchain/evm/bindings/openzeppelin/contracts/token/ERC20/erc20"
+	"github.com/catalogfi/cobi/pkg/swap"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 type TransactFunc func(*bind.TransactOpts) (*types.Transaction, error)
@@ -25,15 +27,24 @@ type Wallet interface {
 	Address() common.Address
 
 	// Client returns the blockchain client.
-	Client() *ethclient.Client
+	Client() Backend
 
 	// Balance returns the ETH balance of the wallet address
 	Balance(ctx context.Context, pending bool) (*big.Int, error)
 
-	// TokenBalance returns the token balance of the wallet address. Token is assumed an ERC-20 token and retrieved from
-	// the HTLC contract.
+	// TokenBalance returns the balance of the asset swapped by the HTLC contract. For ERC-20 HTLCs, the token is retrieved
+	// from the HTLC contract. For native HTLCs, it's the native balance minus the gas reserve.
 	TokenBalance(ctx context.Context, pending bool) (*big.Int, error)
 
+	// Allowance returns how much token the HTLC contract is allowed to spend from the wallet, nil for native HTLCs.
+	Allowance(ctx context.Context) (*big.Int, error)
+
+	// Approve sets how much token the HTLC contract is allowed to spend from the wallet, 0 revokes the approval.
+	Approve(ctx context.Context, amount *big.Int) (*types.Transaction, error)
+
+	// ActionCost estimates the cost in wei of executing the action, including the L1 data fee on rollups.
+	ActionCost(ctx context.Context, action swap.Action) (*big.Int, error)
+
 	// Initiate an atomic swap.
 	Initiate(ctx context.Context, swap Swap) (*types.Transaction, error)
 
@@ -42,21 +53,43 @@ type Wallet interface {
 
 	// Refund an atomic swap.
 	Refund(ctx context.Context, swap Swap) (*types.Transaction, error)
+
+	// ReplaceStuck sends same-nonce replacements with bumped fees for the txs which have been pending for too long.
+	ReplaceStuck(ctx context.Context) ([]*types.Transaction, error)
+
+	// FillGaps sends no-op txs for the nonces which are skipped and blocking the following txs.
+	FillGaps(ctx context.Context) ([]*types.Transaction, error)
+
+	// Sent returns the hashes of the txs we have sent with the nonce, including the replacements of the original tx.
+	Sent(nonce uint64) []common.Hash
+
+	// Batchable tells if the action can be submitted with BatchExecute.
+	Batchable(action swap.Action) bool
+
+	// BatchExecute submits multiple swap actions in a single tx through the multicall contract.
+	BatchExecute(ctx context.Context, calls []Call) (*types.Transaction, error)
+
+	// CallRevertReason returns why a call of a batch tx mined in the given block failed.
+	CallRevertReason(ctx context.Context, call Call, block *big.Int) (string, error)
 }
 
 type wallet struct {
 	options Options
 	key     *ecdsa.PrivateKey
-	client  *ethclient.Client
+	client  Backend
 
 	mu           *sync.Mutex
+	approvalMu   *sync.Mutex      // serializes the approvals and the initiations relying on them
+	approval     *pendingApproval // last approval sent, guarded by approvalMu
 	addr         common.Address
-	htlc         *gardenhtlc.GardenHTLC
-	token        *erc20.ERC20
+	htlc         *bind.BoundContract // bound to the ABI of the native or the ERC-20 HTLC contract
+	token        *erc20.ERC20        // nil for native HTLCs
 	transactOpts *bind.TransactOpts
+	nonces       *NonceManager
+	pending      map[uint64]*pendingTx
 }
 
-func NewWallet(options Options, key *ecdsa.PrivateKey, client *ethclient.Client) (Wallet, error) {
+func NewWallet(options Options, key *ecdsa.PrivateKey, client Backend) (Wallet, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), options.Timeout)
 	defer cancel()
 	callOpts := &bind.CallOpts{Context: ctx}
@@ -72,29 +105,41 @@ func NewWallet(options Options, key *ecdsa.PrivateKey, client *ethclient.Client)
 	}
 
 	// Initialise bindings.
-	htlc, err := gardenhtlc.NewGardenHTLC(options.SwapAddr, client)
-	if err != nil {
-		return nil, err
-	}
-	tokenAddr, err := htlc.Token(callOpts)
+	parsed, err := htlcABI(options.Native)
 	if err != nil {
 		return nil, err
 	}
-	erc20, err := erc20.NewERC20(tokenAddr, client)
-	if err != nil {
-		return nil, err
+	htlc := bind.NewBoundContract(options.SwapAddr, *parsed, client, client, client)
+	var token *erc20.ERC20
+	if !options.Native {
+		caller, err := gardenhtlc.NewGardenHTLCCaller(options.SwapAddr, client)
+		if err != nil {
+			return nil, err
+		}
+		tokenAddr, err := caller.Token(callOpts)
+		if err != nil {
+			return nil, err
+		}
+		token, err = erc20.NewERC20(tokenAddr, client)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Initialise the transactor
-	nonce, err := client.PendingNonceAt(ctx, crypto.PubkeyToAddress(key.PublicKey))
-	if err != nil {
-		return nil, err
-	}
+	// Initialise the transactor and the nonce manager
 	transactor, err := bind.NewKeyedTransactorWithChainID(key, options.ChainID)
 	if err != nil {
 		return nil, err
 	}
-	transactor.Nonce = big.NewInt(int64(nonce))
+	nonces := options.NonceManager
+	if nonces == nil {
+		nonces, err = NewNonceManager(ctx, options.ChainID, addr, client, options.Nonces)
+		if err != nil {
+			return nil, err
+		}
+	} else if nonces.addr != addr || nonces.chainID.Cmp(options.ChainID) != 0 {
+		return nil, fmt.Errorf("nonce manager of %v on chain %v doesn't match the wallet", nonces.addr.Hex(), nonces.chainID)
+	}
 
 	wal := &wallet{
 		options: options,
@@ -102,14 +147,17 @@ func NewWallet(options Options, key *ecdsa.PrivateKey, client *ethclient.Client)
 		client:  client,
 
 		mu:           new(sync.Mutex),
+		approvalMu:   new(sync.Mutex),
 		addr:         addr,
 		htlc:         htlc,
-		token:        erc20,
+		token:        token,
 		transactOpts: transactor,
+		nonces:       nonces,
+		pending:      map[uint64]*pendingTx{},
 	}
 
-	// Check token allowance against the token contract
-	if err := wal.allowanceCheck(); err != nil {
+	// Approve the swap contract if the approval policy asks for it, native HTLCs don't need approvals.
+	if err := wal.startupApproval(); err != nil {
 		return nil, err
 	}
 
@@ -120,7 +168,7 @@ func (wallet *wallet) Address() common.Address {
 	return wallet.addr
 }
 
-func (wallet *wallet) Client() *ethclient.Client {
+func (wallet *wallet) Client() Backend {
 	return wallet.client
 }
 
@@ -132,6 +180,18 @@ func (wallet *wallet) Balance(ctx context.Context, pending bool) (*big.Int, erro
 }
 
 func (wallet *wallet) TokenBalance(ctx context.Context, pending bool) (*big.Int, error) {
+	if wallet.options.Native {
+		balance, err := wallet.Balance(ctx, pending)
+		if err != nil {
+			return nil, err
+		}
+		balance.Sub(balance, wallet.options.GasReserve)
+		if balance.Sign() < 0 {
+			return big.NewInt(0), nil
+		}
+		return balance, nil
+	}
+
 	callOpts := &bind.CallOpts{
 		Pending: pending,
 		Context: ctx,
@@ -140,96 +200,158 @@ func (wallet *wallet) TokenBalance(ctx context.Context, pending bool) (*big.Int,
 }
 
 func (wallet *wallet) Initiate(ctx context.Context, swap Swap) (*types.Transaction, error) {
-	wallet.mu.Lock()
-	defer wallet.mu.Unlock()
+	wallet.approvalMu.Lock()
+	defer wallet.approvalMu.Unlock()
+	approving, err := wallet.ensureAllowance(ctx, swap.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("approve %v, %v", swap.Amount, err)
+	}
 
 	// Initiate the atomic swap
 	f := func(opts *bind.TransactOpts) (*types.Transaction, error) {
-		return wallet.htlc.Initiate(opts, swap.Redeemer, swap.Expiry, swap.Amount, swap.SecretHash)
+		if wallet.options.Native {
+			opts.Value = swap.Amount
+		}
+		if approving {
+			opts.GasLimit = initiateGas()
+		}
+		return wallet.htlc.Transact(opts, "initiate", swap.Redeemer, swap.Expiry, swap.Amount, swap.SecretHash)
 	}
-	return wallet.transact(ctx, f)
+	tx, err := wallet.transact(ctx, f)
+	if approving {
+		return tx, wallet.spendApproval(swap.Amount, err)
+	}
+	return tx, err
 }
 
 func (wallet *wallet) Redeem(ctx context.Context, swap Swap, secret []byte) (*types.Transaction, error) {
-	wallet.mu.Lock()
-	defer wallet.mu.Unlock()
-
 	f := func(opts *bind.TransactOpts) (*types.Transaction, error) {
-		return wallet.htlc.Redeem(opts, swap.ID, secret)
+		return wallet.htlc.Transact(opts, "redeem", swap.ID, secret)
 	}
 	return wallet.transact(ctx, f)
 }
 
 func (wallet *wallet) Refund(ctx context.Context, swap Swap) (*types.Transaction, error) {
-	wallet.mu.Lock()
-	defer wallet.mu.Unlock()
-
 	f := func(opts *bind.TransactOpts) (*types.Transaction, error) {
-		return wallet.htlc.Refund(opts, swap.ID)
+		return wallet.htlc.Transact(opts, "refund", swap.ID)
 	}
 	return wallet.transact(ctx, f)
 }
 
-func (wallet *wallet) allowanceCheck() error {
-	ctx, cancel := context.WithTimeout(context.Background(), wallet.options.Timeout*2)
-	defer cancel()
-	callOpts := &bind.CallOpts{Context: ctx}
-
-	// Check we have enough allowance for the swap contract
-	allowance, err := wallet.token.Allowance(callOpts, wallet.addr, wallet.options.SwapAddr)
-	if err != nil {
-		return err
-	}
-	totalSupply, err := wallet.token.TotalSupply(callOpts)
-	if err != nil {
-		return err
-	}
-
-	// Do a large approval when the allowance is low, we should only need to do this once.
-	if allowance.Cmp(totalSupply) == -1 {
-		data := make([]byte, 32)
-		for i := 0; i < 32; i++ {
-			data[i] = 0xff
-		}
-		max := big.NewInt(0).SetBytes(data)
-		f := func(opts *bind.TransactOpts) (*types.Transaction, error) {
-			return wallet.token.Approve(opts, wallet.options.SwapAddr, max)
-		}
-		tx, err := wallet.transact(ctx, f)
+// transact sends a tx with the next nonce, a tx which would revert at the pending block is not sent and a RevertError
+// is returned instead. It doesn't hold the wallet lock while sending, so multiple txs can be in
+// flight at the same time.
+func (wallet *wallet) transact(ctx context.Context, f TransactFunc) (*types.Transaction, error) {
+	for {
+		tip, feeCap, err := wallet.suggestFees(ctx)
 		if err != nil {
-			return err
+			return nil, err
 		}
-
-		// Wait for the tx to be mined and check receipt status
-		receipt, err := bind.WaitMined(ctx, wallet.client, tx)
+		nonce, err := wallet.nonces.Reserve()
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if receipt.Status == 0 {
-			return fmt.Errorf("tx reverted, hash = %v", receipt.TxHash.Hex())
+		opts := *wallet.transactOpts
+		opts.Context = ctx
+		opts.Nonce = new(big.Int).SetUint64(nonce)
+		opts.GasTipCap = tip
+		opts.GasFeeCap = feeCap
+		opts.NoSend = true
+
+		// Simulate the signed tx before sending it, so we don't pay for txs which would revert
+		tx, err := f(&opts)
+		if err != nil {
+			err = asRevert(err)
+		} else if err = Simulate(ctx, wallet.client, wallet.addr, tx); err == nil {
+			err = wallet.client.SendTransaction(ctx, tx)
 		}
-	}
-	return nil
-}
-
-func (wallet *wallet) transact(ctx context.Context, f TransactFunc) (*types.Transaction, error) {
-	for {
-		tx, err := f(wallet.transactOpts)
 		if err != nil {
+			if releaseErr := wallet.nonces.Release(nonce); releaseErr != nil {
+				return nil, releaseErr
+			}
+
 			// If nonce is incorrect
 			if strings.Contains(err.Error(), "nonce too low") || strings.Contains(err.Error(), "tx doesn't have the correct nonce") {
-				nonce, err := wallet.client.PendingNonceAt(ctx, wallet.addr)
-				if err != nil {
+				if err := wallet.nonces.Resync(ctx); err != nil {
 					return nil, err
 				}
-				wallet.transactOpts.Nonce = big.NewInt(int64(nonce))
 				continue
 			}
 
 			// Return other errors immediately without retrying
 			return nil, err
 		}
-		wallet.transactOpts.Nonce = big.NewInt(wallet.transactOpts.Nonce.Int64() + 1)
+
+		// The tx has been sent, failing to persist the nonce only means it will be treated as a tx sent by others.
+		_ = wallet.nonces.Assign(nonce, tx.Hash())
+		wallet.mu.Lock()
+		wallet.pending[nonce] = &pendingTx{
+			tx:     tx,
+			sentAt: time.Now(),
+		}
+		wallet.mu.Unlock()
 		return tx, nil
 	}
 }
+
+// FillGaps sends a zero-value transfer to ourselves for each nonce gap.
+func (wallet *wallet) FillGaps(ctx context.Context) ([]*types.Transaction, error) {
+	gaps, err := wallet.nonces.Gaps(ctx)
+	if err != nil || len(gaps) == 0 {
+		return nil, err
+	}
+	tip, feeCap, err := wallet.suggestFees(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filled := make([]*types.Transaction, 0, len(gaps))
+	for _, nonce := range gaps {
+		var data types.TxData
+		if feeCap == nil {
+			gasPrice, err := wallet.client.SuggestGasPrice(ctx)
+			if err != nil {
+				return filled, err
+			}
+			data = &types.LegacyTx{
+				Nonce:    nonce,
+				GasPrice: gasPrice,
+				Gas:      params.TxGas,
+				To:       &wallet.addr,
+				Value:    big.NewInt(0),
+			}
+		} else {
+			data = &types.DynamicFeeTx{
+				ChainID:   wallet.options.ChainID,
+				Nonce:     nonce,
+				GasTipCap: tip,
+				GasFeeCap: feeCap,
+				Gas:       params.TxGas,
+				To:        &wallet.addr,
+				Value:     big.NewInt(0),
+			}
+		}
+		tx, err := wallet.transactOpts.Signer(wallet.addr, types.NewTx(data))
+		if err != nil {
+			return filled, err
+		}
+		if err := wallet.client.SendTransaction(ctx, tx); err != nil {
+			return filled, fmt.Errorf("fill nonce %v, %v", nonce, err)
+		}
+		if err := wallet.nonces.Assign(nonce, tx.Hash()); err != nil {
+			return filled, err
+		}
+		wallet.mu.Lock()
+		wallet.pending[nonce] = &pendingTx{
+			tx:     tx,
+			sentAt: time.Now(),
+		}
+		wallet.mu.Unlock()
+		filled = append(filled, tx)
+	}
+	return filled, nil
+}
+
+func (wallet *wallet) Sent(nonce uint64) []common.Hash {
+	return wallet.nonces.Sent(nonce)
+}
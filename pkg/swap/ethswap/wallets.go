@@ -0,0 +1,85 @@
+package ethswap
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/catalogfi/ob/model"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// WalletKey identifies a wallet by the chain and the HTLC contract it's bound to.
+type WalletKey struct {
+	Chain    model.Chain
+	Contract common.Address
+}
+
+func NewWalletKey(chain model.Chain, contract common.Address) WalletKey {
+	return WalletKey{
+		Chain:    chain,
+		Contract: contract,
+	}
+}
+
+func (key WalletKey) String() string {
+	return fmt.Sprintf("%v:%v", key.Chain, key.Contract.Hex())
+}
+
+// Wallets are the evm wallets keyed by the chain and HTLC contract. All wallets are assumed to use the same key.
+type Wallets map[WalletKey]Wallet
+
+// Get returns the wallet bound to the HTLC contract on the chain.
+func (wallets Wallets) Get(chain model.Chain, contract common.Address) (Wallet, bool) {
+	wallet, ok := wallets[NewWalletKey(chain, contract)]
+	return wallet, ok
+}
+
+// Asset returns the wallet bound to the HTLC contract of the asset on the chain. The asset of an evm atomic swap is the
+// address of the HTLC contract.
+func (wallets Wallets) Asset(chain model.Chain, asset model.Asset) (Wallet, bool) {
+	if !common.IsHexAddress(string(asset)) {
+		return nil, false
+	}
+	return wallets.Get(chain, common.HexToAddress(string(asset)))
+}
+
+// Chain returns a wallet on the chain, for things which don't depend on the HTLC contract like the address or the gas
+// balance.
+func (wallets Wallets) Chain(chain model.Chain) (Wallet, bool) {
+	keys := wallets.Keys(chain)
+	if len(keys) == 0 {
+		return nil, false
+	}
+	return wallets[keys[0]], true
+}
+
+// Keys returns the keys of the wallets on the chain in a stable order.
+func (wallets Wallets) Keys(chain model.Chain) []WalletKey {
+	keys := make([]WalletKey, 0, len(wallets))
+	for key := range wallets {
+		if key.Chain == chain {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Contract.Hex() < keys[j].Contract.Hex()
+	})
+	return keys
+}
+
+// Chains returns all the chains we have wallets on.
+func (wallets Wallets) Chains() []model.Chain {
+	seen := map[model.Chain]struct{}{}
+	chains := make([]model.Chain, 0, len(wallets))
+	for key := range wallets {
+		if _, ok := seen[key.Chain]; ok {
+			continue
+		}
+		seen[key.Chain] = struct{}{}
+		chains = append(chains, key.Chain)
+	}
+	sort.Slice(chains, func(i, j int) bool {
+		return chains[i] < chains[j]
+	})
+	return chains
+}
@@ -0,0 +1,61 @@
+package ethswap_test
+
+import (
+	"github.com/catalogfi/cobi/pkg/swap/ethswap"
+	"github.com/catalogfi/ob/model"
+	"github.com/ethereum/go-ethereum/common"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// addrWallet is a wallet which only tells its address, so we can tell the wallets apart.
+type addrWallet struct {
+	ethswap.Wallet
+	addr common.Address
+}
+
+func (wallet addrWallet) Address() common.Address {
+	return wallet.addr
+}
+
+var _ = Describe("Wallets", func() {
+	wbtc := common.HexToAddress("0x2")
+	usdc := common.HexToAddress("0x1")
+	arbWbtc := common.HexToAddress("0x3")
+	wallets := ethswap.Wallets{
+		ethswap.NewWalletKey(model.Ethereum, wbtc):         addrWallet{addr: wbtc},
+		ethswap.NewWalletKey(model.Ethereum, usdc):         addrWallet{addr: usdc},
+		ethswap.NewWalletKey(model.EthereumArbitrum, wbtc): addrWallet{addr: arbWbtc},
+	}
+	address := func(wallet ethswap.Wallet, ok bool) common.Address {
+		Expect(ok).Should(BeTrue())
+		return wallet.Address()
+	}
+
+	It("should route by the chain and the htlc contract", func() {
+		Expect(address(wallets.Get(model.Ethereum, wbtc))).Should(Equal(wbtc))
+		Expect(address(wallets.Get(model.EthereumArbitrum, wbtc))).Should(Equal(arbWbtc))
+		_, ok := wallets.Get(model.EthereumArbitrum, usdc)
+		Expect(ok).Should(BeFalse())
+	})
+
+	It("should route by the asset of the atomic swap", func() {
+		Expect(address(wallets.Asset(model.Ethereum, model.Asset(usdc.Hex())))).Should(Equal(usdc))
+		_, ok := wallets.Asset(model.Ethereum, model.Asset("primary"))
+		Expect(ok).Should(BeFalse())
+		_, ok = wallets.Asset(model.Ethereum, model.Asset(arbWbtc.Hex()))
+		Expect(ok).Should(BeFalse())
+	})
+
+	It("should list the wallets of each chain in a stable order", func() {
+		Expect(wallets.Keys(model.Ethereum)).Should(Equal([]ethswap.WalletKey{
+			ethswap.NewWalletKey(model.Ethereum, usdc),
+			ethswap.NewWalletKey(model.Ethereum, wbtc),
+		}))
+		Expect(address(wallets.Chain(model.Ethereum))).Should(Equal(usdc))
+		_, ok := wallets.Chain(model.EthereumSepolia)
+		Expect(ok).Should(BeFalse())
+		Expect(wallets.Chains()).Should(Equal([]model.Chain{model.Ethereum, model.EthereumArbitrum}))
+	})
+})
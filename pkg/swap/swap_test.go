@@ -37,7 +37,7 @@ package swap_test
 // 			Expect(err).To(BeNil())
 // 			aliceBtcWallet, err := btcswap.NewWallet(btcswap.OptionsRegression(), indexer, aliceBtcKey, btc.NewFixFeeEstimator(rand.Intn(18)+2))
 // 			Expect(err).To(BeNil())
-// 			aliceEthWallet, err := ethswap.NewWallet(ethswap.NewOptions(model.EthereumLocalnet, swapAddr), aliceKey, ethClient)
+// 			aliceEthWallet, err := ethswap.NewWallet(ethswap.NewOptions(ethswap.ChainIDs[model.EthereumLocalnet], swapAddr), aliceKey, ethClient)
 // 			Expect(err).To(BeNil())
 
 // 			By("Initialize Bob's wallets ")
@@ -45,7 +45,7 @@ package swap_test
 // 			Expect(err).To(BeNil())
 // 			bobBtcWallet, err := btcswap.NewWallet(btcswap.OptionsRegression(), indexer, bobBtcKey, btc.NewFixFeeEstimator(rand.Intn(18)+2))
 // 			Expect(err).To(BeNil())
-// 			bobEthWallet, err := ethswap.NewWallet(ethswap.NewOptions(model.EthereumLocalnet, swapAddr), bobKey, ethClient)
+// 			bobEthWallet, err := ethswap.NewWallet(ethswap.NewOptions(ethswap.ChainIDs[model.EthereumLocalnet], swapAddr), bobKey, ethClient)
 // 			Expect(err).To(BeNil())
 
 // 			By("Funding both user's bitcoin address")
@@ -147,7 +147,7 @@ package swap_test
 // 			Expect(err).To(BeNil())
 // 			aliceBtcWallet, err := btcswap.NewWallet(btcswap.OptionsRegression(), indexer, aliceBtcKey, btc.NewFixFeeEstimator(rand.Intn(18)+2))
 // 			Expect(err).To(BeNil())
-// 			aliceEthWallet, err := ethswap.NewWallet(ethswap.NewOptions(model.EthereumLocalnet, swapAddr), aliceKey, ethClient)
+// 			aliceEthWallet, err := ethswap.NewWallet(ethswap.NewOptions(ethswap.ChainIDs[model.EthereumLocalnet], swapAddr), aliceKey, ethClient)
 // 			Expect(err).To(BeNil())
 
 // 			By("Initialize Bob's wallets ")
@@ -155,7 +155,7 @@ package swap_test
 // 			Expect(err).To(BeNil())
 // 			bobBtcWallet, err := btcswap.NewWallet(btcswap.OptionsRegression(), indexer, bobBtcKey, btc.NewFixFeeEstimator(rand.Intn(18)+2))
 // 			Expect(err).To(BeNil())
-// 			bobEthWallet, err := ethswap.NewWallet(ethswap.NewOptions(model.EthereumLocalnet, swapAddr), bobKey, ethClient)
+// 			bobEthWallet, err := ethswap.NewWallet(ethswap.NewOptions(ethswap.ChainIDs[model.EthereumLocalnet], swapAddr), bobKey, ethClient)
 // 			Expect(err).To(BeNil())
 
 // 			By("Funding both user's bitcoin address")